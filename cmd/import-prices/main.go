@@ -0,0 +1,72 @@
+// Command import-prices backfills price_history from an end-of-day CSV or JSON file.
+//
+//	go run ./cmd/import-prices -file prices.csv [-format csv|json] [-overwrite]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"stocky-backend/db"
+	"stocky-backend/services"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	filePath := flag.String("file", "", "path to the CSV or JSON price file")
+	format := flag.String("format", "", "file format (csv or json); defaults to the file extension")
+	overwrite := flag.Bool("overwrite", false, "replace prices that already exist for the same symbol and timestamp")
+	flag.Parse()
+
+	if *filePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*filePath)), ".")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		logrus.Warn("No .env file found, using environment variables")
+	}
+
+	if err := db.Initialize(); err != nil {
+		logrus.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	marketCalendar := services.NewMarketCalendar()
+	if err := marketCalendar.LoadHolidays(); err != nil {
+		logrus.Fatalf("Failed to load market holidays: %v", err)
+	}
+
+	file, err := os.Open(*filePath)
+	if err != nil {
+		logrus.Fatalf("Failed to open %s: %v", *filePath, err)
+	}
+	defer file.Close()
+
+	priceService := services.NewPriceService(marketCalendar)
+	importService := services.NewPriceImportService(marketCalendar, priceService)
+	result, err := importService.Import(file, services.PriceImportOptions{
+		Format:    *format,
+		Overwrite: *overwrite,
+	})
+	if err != nil {
+		logrus.Errorf("Price import failed: %v", err)
+	}
+
+	if result != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AnalyticsController handles cross-user analytics endpoints
+type AnalyticsController struct {
+	analyticsService *services.AnalyticsService
+}
+
+// NewAnalyticsController creates a new analytics controller
+func NewAnalyticsController(analyticsService *services.AnalyticsService) *AnalyticsController {
+	return &AnalyticsController{
+		analyticsService: analyticsService,
+	}
+}
+
+// GetTopUsers handles GET /admin/analytics/top-users?limit=
+func (c *AnalyticsController) GetTopUsers(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid limit",
+		})
+		return
+	}
+
+	result, err := c.analyticsService.TopUsers(limit)
+	c.respond(ctx, result, err, "Failed to fetch top users")
+}
+
+// GetDistribution handles GET /admin/analytics/distribution?by=symbol|campaign
+func (c *AnalyticsController) GetDistribution(ctx *gin.Context) {
+	by := strings.ToLower(ctx.DefaultQuery("by", services.DistributionBySymbol))
+	result, err := c.analyticsService.Distribution(by)
+	c.respond(ctx, result, err, "Failed to fetch reward distribution")
+}
+
+// GetNewUsers handles GET /admin/analytics/new-users?from=&to=
+func (c *AnalyticsController) GetNewUsers(ctx *gin.Context) {
+	from, ok := parseDateQuery(ctx, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(ctx, "to")
+	if !ok {
+		return
+	}
+
+	result, err := c.analyticsService.NewUsers(from, to)
+	c.respond(ctx, result, err, "Failed to fetch new users")
+}
+
+// GetOutstanding handles GET /admin/analytics/outstanding
+func (c *AnalyticsController) GetOutstanding(ctx *gin.Context) {
+	result, err := c.analyticsService.Outstanding()
+	c.respond(ctx, result, err, "Failed to fetch outstanding holdings")
+}
+
+// RefreshRollups handles POST /admin/analytics/refresh
+func (c *AnalyticsController) RefreshRollups(ctx *gin.Context) {
+	if err := c.analyticsService.RefreshRollups(); err != nil {
+		logrus.WithError(err).Error("Failed to refresh analytics rollups")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to refresh analytics rollups",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// respond writes an analytics result, mapping invalid queries to 400
+func (c *AnalyticsController) respond(ctx *gin.Context, result map[string]interface{}, err error, message string) {
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		logrus.WithError(err).Error(message)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   message,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// BrokerController handles broker order endpoints
+type BrokerController struct {
+	brokerService *services.BrokerService
+}
+
+// NewBrokerController creates a new broker controller
+func NewBrokerController(brokerService *services.BrokerService) *BrokerController {
+	return &BrokerController{
+		brokerService: brokerService,
+	}
+}
+
+// ListOrders handles GET /admin/broker/orders?status=
+func (c *BrokerController) ListOrders(ctx *gin.Context) {
+	orders, err := c.brokerService.ListOrders(ctx.Query("status"))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch broker orders")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch broker orders",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+	})
+}
+
+// GetOrder handles GET /admin/broker/orders/:id
+func (c *BrokerController) GetOrder(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid order ID",
+		})
+		return
+	}
+
+	detail, err := c.brokerService.GetOrder(uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrBrokerOrderNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Broker order not found",
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to fetch broker order")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch broker order",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// NetPendingRewards handles POST /admin/broker/net
+func (c *BrokerController) NetPendingRewards(ctx *gin.Context) {
+	if err := c.brokerService.NetPendingRewards(); err != nil {
+		logrus.WithError(err).Error("Failed to net pending rewards")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// SyncOrders handles POST /admin/broker/sync
+func (c *BrokerController) SyncOrders(ctx *gin.Context) {
+	if err := c.brokerService.SyncOrders(); err != nil {
+		logrus.WithError(err).Error("Failed to sync broker orders")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
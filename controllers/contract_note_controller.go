@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"stocky-backend/models"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxContractNoteBytes caps the size of an uploaded contract note
+const maxContractNoteBytes = 5 << 20
+
+// ContractNoteController handles contract note import and review endpoints
+type ContractNoteController struct {
+	contractNoteService *services.ContractNoteService
+}
+
+// NewContractNoteController creates a new contract note controller
+func NewContractNoteController(contractNoteService *services.ContractNoteService) *ContractNoteController {
+	return &ContractNoteController{
+		contractNoteService: contractNoteService,
+	}
+}
+
+// ReviewContractTradeRequest represents the optional body for contract trade review endpoints
+type ReviewContractTradeRequest struct {
+	ReviewedBy string `json:"reviewedBy"`
+	Note       string `json:"note"`
+}
+
+// ImportContractNote handles POST /admin/contract-notes/import?contractNote= (multipart field "file").
+// The contract note name defaults to the uploaded file name.
+func (c *ContractNoteController) ImportContractNote(ctx *gin.Context) {
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Missing upload field \"file\"",
+		})
+		return
+	}
+	if fileHeader.Size > maxContractNoteBytes {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"error":   "Contract note is too large",
+		})
+		return
+	}
+
+	contractNote := ctx.Query("contractNote")
+	if contractNote == "" {
+		contractNote = strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Failed to read upload",
+		})
+		return
+	}
+	defer file.Close()
+
+	result, err := c.contractNoteService.Import(file, contractNote)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImportFile) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		logrus.WithError(err).Error("Failed to import contract note")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to import contract note",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// ListTrades handles GET /admin/contract-notes/trades?status=MISMATCH
+func (c *ContractNoteController) ListTrades(ctx *gin.Context) {
+	trades, err := c.contractNoteService.ListTrades(ctx.Query("status"))
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch contract trades")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch contract trades",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"trades": trades,
+	})
+}
+
+// AdjustTrade handles POST /admin/contract-notes/trades/:id/adjust
+func (c *ContractNoteController) AdjustTrade(ctx *gin.Context) {
+	c.reviewTrade(ctx, c.contractNoteService.AdjustTrade)
+}
+
+// AcceptTrade handles POST /admin/contract-notes/trades/:id/accept
+func (c *ContractNoteController) AcceptTrade(ctx *gin.Context) {
+	c.reviewTrade(ctx, c.contractNoteService.AcceptTrade)
+}
+
+// reviewTrade parses a review request and applies the given decision
+func (c *ContractNoteController) reviewTrade(ctx *gin.Context, review func(id uint, reviewer, note string) (*models.ContractTrade, error)) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid contract trade ID",
+		})
+		return
+	}
+
+	var req ReviewContractTradeRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	trade, err := review(uint(id), req.ReviewedBy, req.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrContractTradeNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrContractTradeResolved), errors.Is(err, services.ErrContractTradeCancelled):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		default:
+			logrus.WithError(err).Error("Failed to review contract trade")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to review contract trade",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"trade":   trade,
+	})
+}
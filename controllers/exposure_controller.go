@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/models"
+	"stocky-backend/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// ExposureController handles company exposure endpoints
+type ExposureController struct {
+	exposureService *services.ExposureService
+}
+
+// NewExposureController creates a new exposure controller
+func NewExposureController(exposureService *services.ExposureService) *ExposureController {
+	return &ExposureController{
+		exposureService: exposureService,
+	}
+}
+
+// SetExposureLimitsRequest represents the request body for PUT /admin/exposure/limits/:symbol.
+// An omitted or null limit disables that check.
+type SetExposureLimitsRequest struct {
+	MaxValueINR *decimal.Decimal `json:"maxValueInr"`
+	MaxQuantity *decimal.Decimal `json:"maxQuantity"`
+}
+
+// GetExposure handles GET /admin/exposure
+func (c *ExposureController) GetExposure(ctx *gin.Context) {
+	report, err := c.exposureService.GetExposure()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to compute exposure")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to compute exposure",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// ListAlerts handles GET /admin/exposure/alerts?status=OPEN
+func (c *ExposureController) ListAlerts(ctx *gin.Context) {
+	status := models.ExposureAlertStatus(strings.ToUpper(ctx.DefaultQuery("status", string(models.ExposureAlertOpen))))
+	if status == "ALL" {
+		status = ""
+	}
+
+	alerts, err := c.exposureService.ListExposureAlerts(status)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch exposure alerts")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch exposure alerts",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+	})
+}
+
+// SetLimits handles PUT /admin/exposure/limits/:symbol
+func (c *ExposureController) SetLimits(ctx *gin.Context) {
+	var req SetExposureLimitsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	config, err := c.exposureService.SetExposureLimits(strings.ToUpper(ctx.Param("symbol")), services.ExposureLimits{
+		MaxValueINR: req.MaxValueINR,
+		MaxQuantity: req.MaxQuantity,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownSymbol):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidExposureLimit):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		default:
+			logrus.WithError(err).Error("Failed to save exposure limits")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to save exposure limits",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":             true,
+		"symbol":              config.StockSymbol,
+		"maxExposureInr":      config.MaxExposureINR,
+		"maxExposureQuantity": config.MaxExposureQuantity,
+	})
+}
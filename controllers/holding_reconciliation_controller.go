@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxHoldingStatementBytes caps the size of an uploaded holding statement
+const maxHoldingStatementBytes = 5 << 20
+
+// HoldingReconciliationController handles depository holding reconciliation endpoints
+type HoldingReconciliationController struct {
+	reconciliationService *services.HoldingReconciliationService
+}
+
+// NewHoldingReconciliationController creates a new holding reconciliation controller
+func NewHoldingReconciliationController(reconciliationService *services.HoldingReconciliationService) *HoldingReconciliationController {
+	return &HoldingReconciliationController{
+		reconciliationService: reconciliationService,
+	}
+}
+
+// ImportStatement handles POST /admin/depository/holdings/import?date=YYYY-MM-DD&overwrite=
+// (multipart field "file")
+func (c *HoldingReconciliationController) ImportStatement(ctx *gin.Context) {
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Missing upload field \"file\"",
+		})
+		return
+	}
+	if fileHeader.Size > maxHoldingStatementBytes {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"error":   "Holding statement is too large",
+		})
+		return
+	}
+
+	overwrite := false
+	if value := ctx.Query("overwrite"); value != "" {
+		overwrite, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid overwrite flag",
+			})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Failed to read upload",
+		})
+		return
+	}
+	defer file.Close()
+
+	report, err := c.reconciliationService.Import(file, ctx.Query("date"), filepath.Base(fileHeader.Filename), overwrite)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidImportFile):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrHoldingReconciliationExists):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		default:
+			logrus.WithError(err).Error("Failed to reconcile holding statement")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to reconcile holding statement",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// ListReconciliations handles GET /admin/depository/reconciliations
+func (c *HoldingReconciliationController) ListReconciliations(ctx *gin.Context) {
+	runs, err := c.reconciliationService.ListReconciliations()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch reconciliations")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch reconciliations",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"reconciliations": runs,
+	})
+}
+
+// GetReconciliation handles GET /admin/depository/reconciliations/:date?breaksOnly=true
+func (c *HoldingReconciliationController) GetReconciliation(ctx *gin.Context) {
+	breaksOnly := false
+	if value := ctx.Query("breaksOnly"); value != "" {
+		var err error
+		breaksOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid breaksOnly flag",
+			})
+			return
+		}
+	}
+
+	report, err := c.reconciliationService.GetReconciliation(ctx.Param("date"), breaksOnly)
+	if err != nil {
+		if errors.Is(err, services.ErrHoldingReconciliationNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Holding reconciliation not found",
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to fetch reconciliation")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch reconciliation",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// GetSymbolHistory handles GET /admin/depository/holdings/:symbol/history?limit=
+func (c *HoldingReconciliationController) GetSymbolHistory(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "30"))
+	if err != nil || limit <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid limit",
+		})
+		return
+	}
+
+	symbol := strings.ToUpper(ctx.Param("symbol"))
+	checks, err := c.reconciliationService.GetSymbolHistory(symbol, limit)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch holding history")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch holding history",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"symbol":  symbol,
+		"history": checks,
+	})
+}
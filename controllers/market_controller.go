@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"stocky-backend/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MarketController handles market calendar API endpoints
+type MarketController struct {
+	calendar *services.MarketCalendar
+}
+
+// NewMarketController creates a new market controller
+func NewMarketController(calendar *services.MarketCalendar) *MarketController {
+	return &MarketController{
+		calendar: calendar,
+	}
+}
+
+// GetStatus handles GET /market/status
+func (c *MarketController) GetStatus(ctx *gin.Context) {
+	now := utils.NowUTC()
+	holiday, description := c.calendar.IsHoliday(now)
+
+	response := gin.H{
+		"time":             now.Format(time.RFC3339),
+		"open":             c.calendar.IsMarketOpen(now),
+		"tradingDay":       c.calendar.IsTradingDay(now),
+		"lastSessionClose": c.calendar.LastSessionClose(now).Format(time.RFC3339),
+		"nextSessionOpen":  c.calendar.NextSessionOpen(now).Format(time.RFC3339),
+	}
+	if holiday {
+		response["holiday"] = description
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetHolidays handles GET /market/holidays?year=YYYY
+func (c *MarketController) GetHolidays(ctx *gin.Context) {
+	year := utils.NowUTC().In(c.calendar.Location()).Year()
+	if yearStr := ctx.Query("year"); yearStr != "" {
+		parsed, err := strconv.Atoi(yearStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid year",
+			})
+			return
+		}
+		year = parsed
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"year":     year,
+		"holidays": c.calendar.Holidays(year),
+	})
+}
+
+// SaveHolidays handles POST /market/holidays
+func (c *MarketController) SaveHolidays(ctx *gin.Context) {
+	var entries []services.HolidayFileEntry
+
+	if err := ctx.ShouldBindJSON(&entries); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	count, err := c.calendar.SaveHolidays(entries)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidHoliday) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		logrus.WithError(err).Error("Failed to save market holidays")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to save market holidays",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"saved":   count,
+	})
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"stocky-backend/models"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPriceImportBytes caps the size of an uploaded price file
+const maxPriceImportBytes = 20 << 20
+
+// PriceController handles price administration endpoints
+type PriceController struct {
+	priceService  *services.PriceService
+	importService *services.PriceImportService
+}
+
+// NewPriceController creates a new price controller
+func NewPriceController(priceService *services.PriceService, importService *services.PriceImportService) *PriceController {
+	return &PriceController{
+		priceService:  priceService,
+		importService: importService,
+	}
+}
+
+// ReviewQuarantineRequest represents the optional body for quarantine review endpoints
+type ReviewQuarantineRequest struct {
+	ReviewedBy string `json:"reviewedBy"`
+	Note       string `json:"note"`
+}
+
+// ImportPrices handles POST /admin/prices/import (multipart field "file")
+func (c *PriceController) ImportPrices(ctx *gin.Context) {
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Missing upload field \"file\"",
+		})
+		return
+	}
+	if fileHeader.Size > maxPriceImportBytes {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"error":   "Import file is too large",
+		})
+		return
+	}
+
+	overwrite := false
+	if value := ctx.Query("overwrite"); value != "" {
+		overwrite, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid overwrite flag",
+			})
+			return
+		}
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Failed to read upload",
+		})
+		return
+	}
+	defer file.Close()
+
+	result, err := c.importService.Import(file, services.PriceImportOptions{
+		Format:    format,
+		Overwrite: overwrite,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImportFile) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		logrus.WithError(err).Error("Failed to import prices")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to import prices",
+			"result":  result,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// ListQuarantine handles GET /admin/prices/quarantine?status=PENDING
+func (c *PriceController) ListQuarantine(ctx *gin.Context) {
+	status := models.QuarantineStatus(strings.ToUpper(ctx.DefaultQuery("status", string(models.QuarantineStatusPending))))
+	if status == "ALL" {
+		status = ""
+	}
+
+	entries, err := c.priceService.ListQuarantinedPrices(status)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch quarantined prices")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch quarantined prices",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"prices": entries,
+	})
+}
+
+// ApproveQuarantine handles POST /admin/prices/quarantine/:id/approve
+func (c *PriceController) ApproveQuarantine(ctx *gin.Context) {
+	c.reviewQuarantine(ctx, c.priceService.ApproveQuarantinedPrice)
+}
+
+// RejectQuarantine handles POST /admin/prices/quarantine/:id/reject
+func (c *PriceController) RejectQuarantine(ctx *gin.Context) {
+	c.reviewQuarantine(ctx, c.priceService.RejectQuarantinedPrice)
+}
+
+// reviewQuarantine parses a review request and applies the given decision
+func (c *PriceController) reviewQuarantine(ctx *gin.Context, review func(id uint, reviewer, note string) (*models.PriceQuarantine, error)) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid quarantine ID",
+		})
+		return
+	}
+
+	var req ReviewQuarantineRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request payload: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	entry, err := review(uint(id), req.ReviewedBy, req.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrQuarantineNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrQuarantineResolved):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		default:
+			logrus.WithError(err).Error("Failed to review quarantined price")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to review quarantined price",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"price":   entry,
+	})
+}
@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"stocky-backend/models"
 	"stocky-backend/services"
+	"stocky-backend/utils"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,13 +18,15 @@ import (
 
 // RewardController handles reward-related API endpoints
 type RewardController struct {
-	rewardService *services.RewardService
+	rewardService   *services.RewardService
+	settingsService *services.UserSettingsService
 }
 
 // NewRewardController creates a new reward controller
-func NewRewardController(rewardService *services.RewardService) *RewardController {
+func NewRewardController(rewardService *services.RewardService, settingsService *services.UserSettingsService) *RewardController {
 	return &RewardController{
-		rewardService: rewardService,
+		rewardService:   rewardService,
+		settingsService: settingsService,
 	}
 }
 
@@ -29,6 +36,7 @@ type CreateRewardRequest struct {
 	Symbol    string  `json:"symbol" binding:"required"`
 	Quantity  float64 `json:"quantity" binding:"required,gt=0"`
 	Timestamp string  `json:"timestamp" binding:"required"`
+	Campaign  string  `json:"campaign" binding:"max=50"`
 }
 
 // CreateReward handles POST /reward
@@ -58,10 +66,18 @@ func (c *RewardController) CreateReward(ctx *gin.Context) {
 	quantity := decimal.NewFromFloat(req.Quantity)
 
 	// Create reward
-	err = c.rewardService.CreateReward(req.UserID, req.Symbol, quantity, timestamp)
+	reward, err := c.rewardService.CreateReward(req.UserID, req.Symbol, quantity, timestamp, strings.TrimSpace(req.Campaign))
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create reward")
-		
+
+		if errors.Is(err, services.ErrInsufficientInventory) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
 		// Check if it's a duplicate error
 		if err.Error() == "duplicate reward: identical reward already exists" {
 			ctx.JSON(http.StatusConflict, gin.H{
@@ -79,11 +95,13 @@ func (c *RewardController) CreateReward(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"success": true,
+		"success":  true,
+		"rewardId": reward.ID,
+		"status":   reward.Status,
 	})
 }
 
-// GetTodayStocks handles GET /today-stocks/:userId
+// GetTodayStocks handles GET /today-stocks/:userId?tz=
 func (c *RewardController) GetTodayStocks(ctx *gin.Context) {
 	userIDStr := ctx.Param("userId")
 	userID, err := strconv.Atoi(userIDStr)
@@ -95,7 +113,12 @@ func (c *RewardController) GetTodayStocks(ctx *gin.Context) {
 		return
 	}
 
-	rewards, err := c.rewardService.GetTodayRewards(userID)
+	loc, ok := c.resolveLocation(ctx, userID)
+	if !ok {
+		return
+	}
+
+	rewards, err := c.rewardService.GetTodayRewards(userID, loc)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch today's rewards")
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -108,20 +131,28 @@ func (c *RewardController) GetTodayStocks(ctx *gin.Context) {
 	// Transform rewards to response format
 	rewardsList := make([]map[string]interface{}, 0)
 	for _, reward := range rewards {
-		rewardsList = append(rewardsList, map[string]interface{}{
+		item := map[string]interface{}{
 			"symbol":    reward.StockSymbol,
 			"quantity":  reward.Quantity,
 			"timestamp": reward.Timestamp.Format(time.RFC3339),
-		})
+		}
+		if reward.Campaign != "" {
+			item["campaign"] = reward.Campaign
+		}
+		if reward.Status == models.RewardStatusQueued {
+			item["status"] = reward.Status
+		}
+		rewardsList = append(rewardsList, item)
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"userId":  userID,
-		"rewards": rewardsList,
+		"userId":   userID,
+		"timezone": loc.String(),
+		"rewards":  rewardsList,
 	})
 }
 
-// GetHistoricalINR handles GET /historical-inr/:userId
+// GetHistoricalINR handles GET /historical-inr/:userId?from=&to=&granularity=day|week|month&includeToday=&breakdown=&tz=
 func (c *RewardController) GetHistoricalINR(ctx *gin.Context) {
 	userIDStr := ctx.Param("userId")
 	userID, err := strconv.Atoi(userIDStr)
@@ -133,8 +164,51 @@ func (c *RewardController) GetHistoricalINR(ctx *gin.Context) {
 		return
 	}
 
-	days, err := c.rewardService.GetHistoricalINR(userID)
+	loc, ok := c.resolveLocation(ctx, userID)
+	if !ok {
+		return
+	}
+
+	opts := services.HistoricalOptions{
+		Granularity: strings.ToLower(ctx.DefaultQuery("granularity", services.GranularityDay)),
+		Location:    loc,
+	}
+	if opts.From, ok = parseDateQuery(ctx, "from"); !ok {
+		return
+	}
+	if opts.To, ok = parseDateQuery(ctx, "to"); !ok {
+		return
+	}
+	if value := ctx.Query("includeToday"); value != "" {
+		opts.IncludeToday, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid includeToday flag",
+			})
+			return
+		}
+	}
+	if value := ctx.Query("breakdown"); value != "" {
+		opts.Breakdown, err = strconv.ParseBool(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid breakdown flag",
+			})
+			return
+		}
+	}
+
+	days, err := c.rewardService.GetHistoricalINR(userID, opts)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoricalQuery) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
 		logrus.WithError(err).Error("Failed to fetch historical INR")
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -144,12 +218,59 @@ func (c *RewardController) GetHistoricalINR(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"userId": userID,
-		"days":   days,
+		"userId":      userID,
+		"timezone":    loc.String(),
+		"granularity": opts.Granularity,
+		"days":        days,
 	})
 }
 
-// GetStats handles GET /stats/:userId
+// parseDateQuery reads an optional YYYY-MM-DD query parameter, responding 400 if it is malformed
+func parseDateQuery(ctx *gin.Context, param string) (*time.Time, bool) {
+	value := ctx.Query(param)
+	if value == "" {
+		return nil, true
+	}
+
+	date, err := utils.ParseDateString(value)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   fmt.Sprintf("Invalid %s date, use YYYY-MM-DD", param),
+		})
+		return nil, false
+	}
+	return &date, true
+}
+
+// resolveLocation picks the timezone for a request: the tz query parameter,
+// else the user's saved timezone, else the default. Responds 400 for an unknown tz.
+func (c *RewardController) resolveLocation(ctx *gin.Context, userID int) (*time.Location, bool) {
+	if tz := ctx.Query("tz"); tz != "" {
+		loc, err := utils.LoadTimezone(tz)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid tz, use an IANA timezone such as Asia/Kolkata",
+			})
+			return nil, false
+		}
+		return loc, true
+	}
+
+	loc, err := c.settingsService.GetLocation(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to resolve user timezone")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to resolve user timezone",
+		})
+		return nil, false
+	}
+	return loc, true
+}
+
+// GetStats handles GET /stats/:userId?tz=
 func (c *RewardController) GetStats(ctx *gin.Context) {
 	userIDStr := ctx.Param("userId")
 	userID, err := strconv.Atoi(userIDStr)
@@ -161,7 +282,12 @@ func (c *RewardController) GetStats(ctx *gin.Context) {
 		return
 	}
 
-	stats, err := c.rewardService.GetStats(userID)
+	loc, ok := c.resolveLocation(ctx, userID)
+	if !ok {
+		return
+	}
+
+	stats, err := c.rewardService.GetStats(userID, loc)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to fetch stats")
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"stocky-backend/services"
+	"stocky-backend/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// SaleController handles user sell and capital gains endpoints
+type SaleController struct {
+	saleService         *services.SaleService
+	capitalGainsService *services.CapitalGainsService
+}
+
+// NewSaleController creates a new sale controller
+func NewSaleController(saleService *services.SaleService, capitalGainsService *services.CapitalGainsService) *SaleController {
+	return &SaleController{
+		saleService:         saleService,
+		capitalGainsService: capitalGainsService,
+	}
+}
+
+// SellRequest represents the request body for POST /users/:userId/sell
+type SellRequest struct {
+	Symbol   string  `json:"symbol" binding:"required"`
+	Quantity float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+// Sell handles POST /users/:userId/sell
+func (c *SaleController) Sell(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	var req SellRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	sale, err := c.saleService.Sell(userID, strings.ToUpper(req.Symbol), decimal.NewFromFloat(req.Quantity))
+	if err != nil {
+		if errors.Is(err, services.ErrInsufficientHoldings) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrSaleBelowFees) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		logrus.WithError(err).Error("Failed to sell shares")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to sell shares: " + err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"sale":    sale,
+	})
+}
+
+// ListSales handles GET /users/:userId/sales
+func (c *SaleController) ListSales(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	sales, err := c.saleService.ListSales(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch sales")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch sales",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"userId": userID,
+		"sales":  sales,
+	})
+}
+
+// GetCapitalGains handles GET /users/:userId/capital-gains?fy=2024-25&format=json|csv
+func (c *SaleController) GetCapitalGains(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	format := strings.ToLower(ctx.DefaultQuery("format", "json"))
+	if format != "json" && format != "csv" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid format, use json or csv",
+		})
+		return
+	}
+
+	fy := ctx.DefaultQuery("fy", services.FinancialYearOf(utils.NowUTC()))
+	statement, err := c.capitalGainsService.GetStatement(userID, fy)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFinancialYear) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to build capital gains statement")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to build capital gains statement",
+		})
+		return
+	}
+
+	if format == "csv" {
+		filename := fmt.Sprintf("capital-gains-%d-FY%s.csv", userID, statement.FinancialYear)
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Header("Content-Type", "text/csv")
+		ctx.Status(http.StatusOK)
+		if err := statement.WriteCSV(ctx.Writer); err != nil {
+			logrus.WithError(err).Error("Failed to write capital gains CSV")
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, statement)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// StatementController handles monthly account statement endpoints
+type StatementController struct {
+	statementService *services.StatementService
+}
+
+// NewStatementController creates a new statement controller
+func NewStatementController(statementService *services.StatementService) *StatementController {
+	return &StatementController{
+		statementService: statementService,
+	}
+}
+
+// ListStatements handles GET /users/:userId/statements
+func (c *StatementController) ListStatements(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	statements, err := c.statementService.ListStatements(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch statements")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch statements",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"userId":     userID,
+		"statements": statements,
+	})
+}
+
+// GetStatement handles GET /users/:userId/statements/:month?format=json|csv|html
+func (c *StatementController) GetStatement(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	format := strings.ToLower(ctx.DefaultQuery("format", "json"))
+	if format != "json" && format != "csv" && format != "html" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid format, use json, csv or html",
+		})
+		return
+	}
+
+	month := ctx.Param("month")
+	statement, err := c.statementService.GetStatement(userID, month)
+	if err != nil {
+		if errors.Is(err, services.ErrStatementNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("No statement for user %d in %s", userID, month),
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to fetch statement")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch statement",
+		})
+		return
+	}
+
+	switch format {
+	case "csv":
+		filename := fmt.Sprintf("statement-%d-%s.csv", userID, statement.Month)
+		ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.Data(http.StatusOK, "text/csv", []byte(statement.CSV))
+	case "html":
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(statement.HTML))
+	default:
+		ctx.Data(http.StatusOK, "application/json; charset=utf-8", []byte(statement.Data))
+	}
+}
+
+// GenerateStatements handles POST /admin/statements/generate?month=YYYY-MM&overwrite=false
+func (c *StatementController) GenerateStatements(ctx *gin.Context) {
+	overwrite, err := strconv.ParseBool(ctx.DefaultQuery("overwrite", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid overwrite flag",
+		})
+		return
+	}
+
+	month := ctx.DefaultQuery("month", services.PreviousStatementMonth())
+	result, err := c.statementService.GenerateMonth(month, overwrite)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatementMonth) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to generate statements")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to generate statements",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
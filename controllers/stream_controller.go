@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"stocky-backend/services"
+	"stocky-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultHeartbeatInterval keeps idle streams alive through proxies
+	defaultHeartbeatInterval = 15 * time.Second
+
+	// portfolioDebounce coalesces bursts (e.g. an hourly price update) into one snapshot
+	portfolioDebounce = 500 * time.Millisecond
+
+	// priceReplayPage is how many missed prices are read at a time on reconnect
+	priceReplayPage = 500
+
+	// maxPriceReplay caps how many missed prices are replayed on reconnect;
+	// a longer gap gets a resync event instead
+	maxPriceReplay = 10000
+
+	// reconnectDelayMs is the retry hint sent to clients
+	reconnectDelayMs = 3000
+)
+
+// StreamController handles Server-Sent Events endpoints
+type StreamController struct {
+	priceService  *services.PriceService
+	rewardService *services.RewardService
+	broker        *services.EventBroker
+	heartbeat     time.Duration
+}
+
+// NewStreamController creates a new stream controller
+func NewStreamController(priceService *services.PriceService, rewardService *services.RewardService, broker *services.EventBroker) *StreamController {
+	return &StreamController{
+		priceService:  priceService,
+		rewardService: rewardService,
+		broker:        broker,
+		heartbeat:     utils.DurationFromEnv("SSE_HEARTBEAT_INTERVAL", defaultHeartbeatInterval),
+	}
+}
+
+// StreamPrices handles GET /stream/prices?symbols=TCS,INFY
+// Event IDs are price_history IDs, so a reconnect with Last-Event-ID replays missed prices.
+// When the gap cannot be replayed in full a "resync" event tells the client to reload.
+func (c *StreamController) StreamPrices(ctx *gin.Context) {
+	symbols := make(map[string]bool)
+	if list := ctx.Query("symbols"); list != "" {
+		for _, symbol := range strings.Split(list, ",") {
+			if symbol = strings.ToUpper(strings.TrimSpace(symbol)); symbol != "" {
+				symbols[symbol] = true
+			}
+		}
+	}
+	wanted := func(symbol string) bool {
+		return len(symbols) == 0 || symbols[symbol]
+	}
+
+	// Subscribe before replaying so nothing is missed in between
+	sub := c.broker.Subscribe(func(event services.Event) bool {
+		return event.Price != nil && wanted(event.Price.Symbol)
+	})
+	defer sub.Close()
+
+	c.beginStream(ctx)
+
+	var lastSent uint
+	if lastID, err := strconv.ParseUint(ctx.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+		lastSent = uint(lastID)
+
+		var err error
+		if lastSent, err = c.replayPrices(ctx, lastSent, wanted); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(c.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := writeHeartbeat(ctx); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if event.Price.ID <= lastSent {
+				continue
+			}
+			if err := writeEvent(ctx, strconv.FormatUint(uint64(event.Price.ID), 10), "price", event.Price); err != nil {
+				return
+			}
+			lastSent = event.Price.ID
+		}
+	}
+}
+
+// replayPrices writes the prices recorded after lastSent, a page at a time,
+// and returns the last ID covered. If the gap is longer than maxPriceReplay
+// or cannot be read, a resync event is sent and the live stream continues
+// from there.
+func (c *StreamController) replayPrices(ctx *gin.Context, lastSent uint, wanted func(symbol string) bool) (uint, error) {
+	replayed := 0
+	for {
+		missed, err := c.priceService.GetPricesSince(lastSent, priceReplayPage)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to replay prices")
+			return lastSent, writeResync(ctx, lastSent, "replay failed")
+		}
+
+		for _, p := range missed {
+			if wanted(p.StockSymbol) {
+				event := services.PriceEvent{
+					ID:        p.ID,
+					Symbol:    p.StockSymbol,
+					Price:     p.Price,
+					Currency:  p.Currency,
+					PriceINR:  p.PriceINR,
+					Timestamp: p.Timestamp,
+				}
+				if err := writeEvent(ctx, strconv.FormatUint(uint64(p.ID), 10), "price", event); err != nil {
+					return lastSent, err
+				}
+			}
+			lastSent = p.ID
+		}
+
+		replayed += len(missed)
+		if len(missed) < priceReplayPage {
+			return lastSent, nil
+		}
+		if replayed >= maxPriceReplay {
+			return lastSent, writeResync(ctx, lastSent, "replay truncated")
+		}
+	}
+}
+
+// writeResync tells a client that prices after lastEventId were not replayed
+// and it should reload current prices
+func writeResync(ctx *gin.Context, lastEventID uint, reason string) error {
+	return writeEvent(ctx, strconv.FormatUint(uint64(lastEventID), 10), "resync", gin.H{
+		"lastEventId": lastEventID,
+		"reason":      reason,
+	})
+}
+
+// StreamPortfolio handles GET /stream/portfolio/:userId
+// Each event carries a full portfolio snapshot, so a reconnecting client
+// (with or without Last-Event-ID) is brought up to date by the first event.
+func (c *StreamController) StreamPortfolio(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	sub := c.broker.Subscribe(func(event services.Event) bool {
+		return event.Price != nil || (event.Holdings != nil && event.Holdings.UserID == userID)
+	})
+	defer sub.Close()
+
+	c.beginStream(ctx)
+
+	held, err := c.sendPortfolio(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(c.heartbeat)
+	defer heartbeat.Stop()
+
+	debounce := time.NewTimer(portfolioDebounce)
+	debounce.Stop()
+	pending := false
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := writeHeartbeat(ctx); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if event.Price != nil && !held[event.Price.Symbol] {
+				continue
+			}
+			if !pending {
+				pending = true
+				debounce.Reset(portfolioDebounce)
+			}
+		case <-debounce.C:
+			pending = false
+			if held, err = c.sendPortfolio(ctx, userID); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendPortfolio writes a portfolio snapshot and returns the symbols it holds
+func (c *StreamController) sendPortfolio(ctx *gin.Context, userID int) (map[string]bool, error) {
+	portfolio, err := c.rewardService.GetPortfolio(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to build portfolio snapshot")
+		return nil, err
+	}
+
+	held := make(map[string]bool)
+	if holdings, ok := portfolio["holdings"].([]map[string]interface{}); ok {
+		for _, holding := range holdings {
+			if symbol, ok := holding["symbol"].(string); ok {
+				held[symbol] = true
+			}
+		}
+	}
+
+	id := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return held, writeEvent(ctx, id, "portfolio", portfolio)
+}
+
+// beginStream writes SSE headers and lifts the server write timeout for this response
+func (c *StreamController) beginStream(ctx *gin.Context) {
+	if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logrus.WithError(err).Warn("Failed to clear write deadline for stream")
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	fmt.Fprintf(ctx.Writer, "retry: %d\n\n", reconnectDelayMs)
+	ctx.Writer.Flush()
+}
+
+// writeEvent writes one SSE event with a JSON payload
+func writeEvent(ctx *gin.Context, id, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+		return err
+	}
+	ctx.Writer.Flush()
+	return nil
+}
+
+// writeHeartbeat writes an SSE comment to keep the connection open
+func writeHeartbeat(ctx *gin.Context) error {
+	if _, err := fmt.Fprint(ctx.Writer, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	ctx.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// TransferController handles outbound share transfer endpoints
+type TransferController struct {
+	transferService *services.TransferService
+}
+
+// NewTransferController creates a new transfer controller
+func NewTransferController(transferService *services.TransferService) *TransferController {
+	return &TransferController{
+		transferService: transferService,
+	}
+}
+
+// TransferRequest represents the request body for POST /users/:userId/transfers
+type TransferRequest struct {
+	Symbol       string  `json:"symbol" binding:"required"`
+	Quantity     float64 `json:"quantity" binding:"required,gt=0"`
+	DematAccount string  `json:"dematAccount" binding:"required"`
+}
+
+// RequestTransfer handles POST /users/:userId/transfers
+func (c *TransferController) RequestTransfer(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	var req TransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	transfer, err := c.transferService.RequestTransfer(userID, strings.ToUpper(req.Symbol), decimal.NewFromFloat(req.Quantity), req.DematAccount)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidTransfer):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrInsufficientHoldings):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, services.ErrTransfersDisabled):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		default:
+			logrus.WithError(err).Error("Failed to request transfer")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to request transfer",
+			})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"success":  true,
+		"transfer": transfer,
+	})
+}
+
+// ListTransfers handles GET /users/:userId/transfers
+func (c *TransferController) ListTransfers(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	transfers, err := c.transferService.ListTransfers(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch transfers")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch transfers",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"userId":    userID,
+		"transfers": transfers,
+	})
+}
+
+// GetTransfer handles GET /users/:userId/transfers/:id
+func (c *TransferController) GetTransfer(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid transfer ID",
+		})
+		return
+	}
+
+	transfer, err := c.transferService.GetTransfer(userID, uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrTransferNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Transfer not found",
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to fetch transfer")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch transfer",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, transfer)
+}
+
+// SyncTransfers handles POST /admin/transfers/sync
+func (c *TransferController) SyncTransfers(ctx *gin.Context) {
+	if err := c.transferService.SyncTransfers(); err != nil {
+		logrus.WithError(err).Error("Failed to sync transfers")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
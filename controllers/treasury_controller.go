@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"stocky-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// TreasuryController handles treasury inventory endpoints
+type TreasuryController struct {
+	treasuryService *services.TreasuryService
+}
+
+// NewTreasuryController creates a new treasury controller
+func NewTreasuryController(treasuryService *services.TreasuryService) *TreasuryController {
+	return &TreasuryController{
+		treasuryService: treasuryService,
+	}
+}
+
+// AddLotRequest represents the request body for POST /admin/treasury/lots.
+// Price is per share in the instrument's currency; fees are in INR.
+type AddLotRequest struct {
+	Symbol      string  `json:"symbol" binding:"required"`
+	Quantity    float64 `json:"quantity" binding:"required,gt=0"`
+	Price       float64 `json:"price" binding:"required,gt=0"`
+	FeesINR     float64 `json:"feesInr" binding:"gte=0"`
+	PurchasedAt string  `json:"purchasedAt"`
+	Reference   string  `json:"reference" binding:"max=100"`
+}
+
+// AddLot handles POST /admin/treasury/lots
+func (c *TreasuryController) AddLot(ctx *gin.Context) {
+	var req AddLotRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	purchasedAt := utils.NowUTC()
+	if req.PurchasedAt != "" {
+		var err error
+		if purchasedAt, err = time.Parse(time.RFC3339, req.PurchasedAt); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid purchasedAt format, use RFC3339",
+			})
+			return
+		}
+	}
+
+	lot, issued, err := c.treasuryService.AddLot(services.TreasuryLotInput{
+		Symbol:      strings.ToUpper(req.Symbol),
+		Quantity:    decimal.NewFromFloat(req.Quantity),
+		Price:       decimal.NewFromFloat(req.Price),
+		FeesINR:     decimal.NewFromFloat(req.FeesINR),
+		PurchasedAt: purchasedAt,
+		Reference:   req.Reference,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownSymbol):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		case errors.Is(err, services.ErrInvalidTreasuryLot):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		case lot == nil:
+			logrus.WithError(err).Error("Failed to record treasury lot")
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to record treasury lot",
+			})
+			return
+		}
+		// The lot is saved; queued rewards will be retried with the next lot
+		logrus.WithError(err).Error("Failed to issue queued rewards")
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"lot":           lot,
+		"issuedRewards": issued,
+	})
+}
+
+// ListLots handles GET /admin/treasury/lots?symbol=&open=true
+func (c *TreasuryController) ListLots(ctx *gin.Context) {
+	openOnly, err := strconv.ParseBool(ctx.DefaultQuery("open", "true"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid open flag",
+		})
+		return
+	}
+
+	lots, err := c.treasuryService.ListLots(strings.ToUpper(ctx.Query("symbol")), openOnly)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch treasury lots")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch treasury lots",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"lots": lots,
+	})
+}
+
+// GetInventory handles GET /admin/treasury/inventory
+func (c *TreasuryController) GetInventory(ctx *gin.Context) {
+	inventory, err := c.treasuryService.GetInventory()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch treasury inventory")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch treasury inventory",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"inventory": inventory,
+	})
+}
+
+// ListQueue handles GET /admin/treasury/queue
+func (c *TreasuryController) ListQueue(ctx *gin.Context) {
+	rewards, err := c.treasuryService.ListQueuedRewards()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch queued rewards")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch queued rewards",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"rewards": rewards,
+	})
+}
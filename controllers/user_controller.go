@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"stocky-backend/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UserController handles user settings API endpoints
+type UserController struct {
+	settingsService *services.UserSettingsService
+}
+
+// NewUserController creates a new user controller
+func NewUserController(settingsService *services.UserSettingsService) *UserController {
+	return &UserController{
+		settingsService: settingsService,
+	}
+}
+
+// UpdateSettingsRequest represents the request body for PUT /users/:userId/settings
+type UpdateSettingsRequest struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+// GetSettings handles GET /users/:userId/settings
+func (c *UserController) GetSettings(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	settings, err := c.settingsService.GetSettings(userID)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to fetch user settings")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch user settings",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings handles PUT /users/:userId/settings
+func (c *UserController) UpdateSettings(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request payload: " + err.Error(),
+		})
+		return
+	}
+
+	settings, err := c.settingsService.SetTimezone(userID, req.Timezone)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid timezone, use an IANA timezone such as Asia/Kolkata",
+			})
+			return
+		}
+		logrus.WithError(err).Error("Failed to update user settings")
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update user settings",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, settings)
+}
@@ -67,17 +67,61 @@ func Initialize() error {
 func runMigrations() error {
 	logrus.Info("Running database migrations...")
 
+	// Quarantine prices moved from INR-only to instrument-currency columns
+	if err := renameColumns("price_quarantine", map[string]string{
+		"previous_price_inr": "previous_price",
+		"band_low_inr":       "band_low",
+		"band_high_inr":      "band_high",
+	}); err != nil {
+		return err
+	}
+
 	// Auto-migrate all models
 	err := DB.AutoMigrate(
 		&models.RewardEvent{},
 		&models.LedgerEntry{},
 		&models.PriceHistory{},
 		&models.StockConfig{},
+		&models.MarketHoliday{},
+		&models.PriceQuarantine{},
+		&models.SchedulerJobRun{},
+		&models.FxRate{},
+		&models.UserSettings{},
+		&models.UserRewardRollup{},
+		&models.RewardDistributionRollup{},
+		&models.DailyNewUserRollup{},
+		&models.OutstandingRollup{},
+		&models.ExposureAlert{},
+		&models.TreasuryLot{},
+		&models.TreasuryAllocation{},
+		&models.Sale{},
+		&models.AccountStatement{},
+		&models.Transfer{},
+		&models.BrokerOrder{},
+		&models.BrokerOrderAllocation{},
+		&models.ContractTrade{},
+		&models.HoldingReconciliation{},
+		&models.HoldingCheck{},
 	)
 	if err != nil {
 		return err
 	}
 
+	// Fill native-currency columns on rows written before multi-currency support
+	if err := backfillCurrencyColumns(); err != nil {
+		return err
+	}
+
+	// Fill owner, reference and account columns on reward entries written before them
+	if err := backfillLedgerReferences(); err != nil {
+		return err
+	}
+
+	// Let allocations wait for netting and give older ones their order's symbol
+	if err := backfillBrokerAllocations(); err != nil {
+		return err
+	}
+
 	// Create composite indexes for better query performance
 	if err := createIndexes(); err != nil {
 		return err
@@ -102,9 +146,18 @@ func createIndexes() error {
 	// Composite index for price history lookup
 	DB.Exec("CREATE INDEX IF NOT EXISTS idx_price_symbol_timestamp ON price_history(stock_symbol, timestamp DESC)")
 
+	// Index for time-range scans by the price retention job
+	DB.Exec("CREATE INDEX IF NOT EXISTS idx_price_timestamp ON price_history(timestamp)")
+
 	// Index for ledger entries by type
 	DB.Exec("CREATE INDEX IF NOT EXISTS idx_ledger_entry_type ON ledger_entries(entry_type)")
 
+	// Index for a user's share holdings
+	DB.Exec("CREATE INDEX IF NOT EXISTS idx_ledger_user_stock ON ledger_entries(user_id, stock_symbol) WHERE entry_type = 'STOCK'")
+
+	// At most one open exposure alert per symbol, however many checks run at once
+	DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_exposure_alert_open ON exposure_alerts(stock_symbol) WHERE status = 'OPEN'")
+
 	// Unique constraint for deduplication
 	DB.Exec(`
 		CREATE UNIQUE INDEX IF NOT EXISTS idx_reward_dedup 
@@ -119,21 +172,29 @@ func createIndexes() error {
 func initializeStockConfigs() error {
 	logrus.Info("Initializing stock configurations...")
 
-	stocks := []string{"RELIANCE", "TCS", "INFY", "HDFCBANK", "ICICIBANK", "SBIN", "BHARTIARTL", "ITC", "KOTAKBANK", "LT"}
+	stocks := []struct {
+		symbol   string
+		currency string
+	}{
+		{"RELIANCE", "INR"}, {"TCS", "INR"}, {"INFY", "INR"}, {"HDFCBANK", "INR"}, {"ICICIBANK", "INR"},
+		{"SBIN", "INR"}, {"BHARTIARTL", "INR"}, {"ITC", "INR"}, {"KOTAKBANK", "INR"}, {"LT", "INR"},
+		{"AAPL", "USD"}, {"MSFT", "USD"}, {"GOOGL", "USD"},
+	}
 
-	for _, symbol := range stocks {
+	for _, stock := range stocks {
 		var count int64
-		DB.Model(&models.StockConfig{}).Where("stock_symbol = ?", symbol).Count(&count)
+		DB.Model(&models.StockConfig{}).Where("stock_symbol = ?", stock.symbol).Count(&count)
 
 		if count == 0 {
 			config := models.StockConfig{
-				StockSymbol: symbol,
+				StockSymbol: stock.symbol,
+				Currency:    stock.currency,
 				Multiplier:  mustParseDecimal("1.0"),
 				IsActive:    true,
 				Notes:       "Initial configuration",
 			}
 			if err := DB.Create(&config).Error; err != nil {
-				logrus.Warnf("Failed to create stock config for %s: %v", symbol, err)
+				logrus.Warnf("Failed to create stock config for %s: %v", stock.symbol, err)
 			}
 		}
 	}
@@ -141,6 +202,79 @@ func initializeStockConfigs() error {
 	return nil
 }
 
+// renameColumns renames columns that still exist under their old names
+func renameColumns(table string, renames map[string]string) error {
+	if !DB.Migrator().HasTable(table) {
+		return nil
+	}
+
+	for from, to := range renames {
+		if DB.Migrator().HasColumn(table, from) && !DB.Migrator().HasColumn(table, to) {
+			if err := DB.Migrator().RenameColumn(table, from, to); err != nil {
+				return fmt.Errorf("failed to rename %s.%s: %w", table, from, err)
+			}
+		}
+	}
+	return nil
+}
+
+// backfillCurrencyColumns copies INR amounts into the native-currency columns
+// of rows that predate them. Every such row was recorded in INR.
+func backfillCurrencyColumns() error {
+	statements := []string{
+		"UPDATE price_history SET price = price_inr WHERE price = 0 AND currency = 'INR'",
+		"UPDATE price_quarantine SET price = price_inr WHERE price = 0 AND currency = 'INR'",
+		"UPDATE ledger_entries SET amount_original = amount_inr WHERE amount_original = 0 AND amount_inr <> 0 AND currency = 'INR'",
+	}
+
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to backfill currency columns: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillLedgerReferences attributes ledger entries that predate the
+// user_id, reference and account columns. All such entries were booked by
+// rewards: STOCK to the user, CASH and FEE paid by the company.
+func backfillLedgerReferences() error {
+	statements := []string{
+		"ALTER TABLE ledger_entries ALTER COLUMN reward_event_id DROP NOT NULL",
+		`UPDATE ledger_entries le SET user_id = re.user_id
+		 FROM reward_events re
+		 WHERE le.reward_event_id = re.id AND le.user_id = 0`,
+		"UPDATE ledger_entries SET reference_id = reward_event_id WHERE reference_type = 'REWARD' AND reference_id = 0 AND reward_event_id IS NOT NULL",
+		"UPDATE ledger_entries SET account = 'COMPANY' WHERE reference_type = 'REWARD' AND entry_type IN ('CASH', 'FEE') AND account = 'USER'",
+	}
+
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to backfill ledger references: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillBrokerAllocations migrates broker_order_allocations from one order
+// per reward: order_id becomes optional for rewards pending netting, and rows
+// written before stock_symbol take it from their order
+func backfillBrokerAllocations() error {
+	statements := []string{
+		"ALTER TABLE broker_order_allocations ALTER COLUMN order_id DROP NOT NULL",
+		`UPDATE broker_order_allocations ba SET stock_symbol = bo.stock_symbol
+		 FROM broker_orders bo
+		 WHERE ba.order_id = bo.id AND ba.stock_symbol = ''`,
+	}
+
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to backfill broker allocations: %w", err)
+		}
+	}
+	return nil
+}
+
 // Close closes the database connection
 func Close() error {
 	if DB != nil {
@@ -8,6 +8,7 @@ import (
 	"stocky-backend/db"
 	"stocky-backend/routes"
 	"stocky-backend/services"
+	"stocky-backend/utils"
 	"syscall"
 	"time"
 
@@ -15,6 +16,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// closePriceWindow is how long after a session close its close prices may still be recorded
+const closePriceWindow = time.Hour
+
 func main() {
 	// Initialize logger
 	initLogger()
@@ -32,12 +36,49 @@ func main() {
 	}
 	defer db.Close()
 
-	// Start price update scheduler
-	priceService := services.NewPriceService()
-	startPriceUpdateScheduler(priceService)
+	// Load market calendar (optionally seeding holidays from a file)
+	marketCalendar := services.NewMarketCalendar()
+	if path := os.Getenv("MARKET_HOLIDAYS_FILE"); path != "" {
+		if _, err := marketCalendar.ImportHolidaysFile(path); err != nil {
+			logrus.Errorf("Failed to import market holidays: %v", err)
+		}
+	}
+	if err := marketCalendar.LoadHolidays(); err != nil {
+		logrus.Errorf("Failed to load market holidays: %v", err)
+	}
+
+	priceService := services.NewPriceService(marketCalendar)
+	retentionService := services.NewPriceRetentionService(marketCalendar, services.LoadPriceRetentionConfig())
+	analyticsService := services.NewAnalyticsService(priceService)
+	exposureService := services.NewExposureService(priceService)
+	statementService := services.NewStatementService(priceService, marketCalendar)
+	depository, err := services.LoadDepository()
+	if err != nil {
+		logrus.Fatalf("Failed to initialize depository: %v", err)
+	}
+	transferService := services.NewTransferService(priceService, depository, services.LoadTransferConfig())
+	settlementService := services.NewSettlementService(marketCalendar)
+	brokerConfig := services.LoadBrokerConfig()
+	brokerService := services.NewBrokerService(
+		priceService,
+		services.NewSimulatedBroker(priceService, marketCalendar, brokerConfig.FillDelay, brokerConfig.SlippageBps),
+		marketCalendar,
+		brokerConfig,
+	)
+
+	// Start background jobs (one leader per job across all instances)
+	scheduler := services.NewScheduler()
+	registerJobs(scheduler, priceService, retentionService, analyticsService, exposureService, statementService, transferService, brokerService, settlementService, marketCalendar)
+	scheduler.Start()
+
+	// Relay price and holdings notifications to stream subscribers
+	listenerCtx, stopListener := context.WithCancel(context.Background())
+	defer stopListener()
+	eventBroker := services.NewEventBroker()
+	eventBroker.Start(listenerCtx)
 
 	// Setup router
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(priceService, marketCalendar, eventBroker, analyticsService, exposureService, statementService, transferService, brokerService)
 
 	// Get server port
 	port := os.Getenv("SERVER_PORT")
@@ -77,6 +118,9 @@ func main() {
 		logrus.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Release job leadership so another instance can take over
+	scheduler.Stop()
+
 	logrus.Info("Server exited successfully")
 }
 
@@ -96,25 +140,88 @@ func initLogger() {
 	}
 }
 
-// startPriceUpdateScheduler starts a background scheduler to update prices hourly
-func startPriceUpdateScheduler(priceService *services.PriceService) {
-	logrus.Info("Starting price update scheduler (hourly)")
+// registerJobs registers the background jobs with the scheduler
+func registerJobs(scheduler *services.Scheduler, priceService *services.PriceService, retentionService *services.PriceRetentionService, analyticsService *services.AnalyticsService, exposureService *services.ExposureService, statementService *services.StatementService, transferService *services.TransferService, brokerService *services.BrokerService, settlementService *services.SettlementService, marketCalendar *services.MarketCalendar) {
+	// Price updates run during trading sessions only
+	scheduler.Register(services.Job{
+		Name:      "price-update",
+		Interval:  utils.DurationFromEnv("PRICE_UPDATE_INTERVAL", time.Hour),
+		ShouldRun: marketCalendar.IsMarketOpen,
+		Run:       priceService.UpdateAllPrices,
+	})
 
-	// Update prices immediately on startup
-	go func() {
-		if err := priceService.UpdateAllPrices(); err != nil {
-			logrus.Errorf("Failed to update prices on startup: %v", err)
-		}
-	}()
+	// Close prices are recorded once per session at the close; a leader that
+	// starts well after the close skips that session rather than mis-stamp it
+	scheduler.Register(services.Job{
+		Name:     "price-close",
+		Interval: 24 * time.Hour,
+		Schedule: marketCalendar.LastSessionClose,
+		ShouldRun: func(now time.Time) bool {
+			return now.Sub(marketCalendar.LastSessionClose(now)) < closePriceWindow
+		},
+		Run: priceService.RecordClosePrices,
+	})
 
-	// Schedule hourly updates
-	ticker := time.NewTicker(1 * time.Hour)
-	go func() {
-		for range ticker.C {
-			logrus.Info("Scheduled price update triggered")
-			if err := priceService.UpdateAllPrices(); err != nil {
-				logrus.Errorf("Failed to update prices: %v", err)
-			}
-		}
-	}()
+	// Price history retention compacts old intraday prices
+	scheduler.Register(services.Job{
+		Name:     "price-retention",
+		Interval: utils.DurationFromEnv("PRICE_RETENTION_INTERVAL", 24*time.Hour),
+		Run: func() error {
+			_, err := retentionService.Run()
+			return err
+		},
+	})
+
+	// Analytics rollups back the admin reports
+	scheduler.Register(services.Job{
+		Name:     "analytics-rollup",
+		Interval: utils.DurationFromEnv("ANALYTICS_ROLLUP_INTERVAL", 15*time.Minute),
+		Run:      analyticsService.RefreshRollups,
+	})
+
+	// Exposure checks raise alerts for symbols over their limits
+	scheduler.Register(services.Job{
+		Name:     "exposure-check",
+		Interval: utils.DurationFromEnv("EXPOSURE_CHECK_INTERVAL", 5*time.Minute),
+		Run:      exposureService.CheckExposure,
+	})
+
+	// Monthly statements are written once the month has ended; existing ones are kept
+	scheduler.Register(services.Job{
+		Name:     "monthly-statements",
+		Interval: utils.DurationFromEnv("STATEMENT_JOB_INTERVAL", 24*time.Hour),
+		Run:      statementService.GeneratePreviousMonth,
+	})
+
+	// Transfer sync submits requested transfers and books depository outcomes
+	scheduler.Register(services.Job{
+		Name:     "transfer-sync",
+		Interval: utils.DurationFromEnv("TRANSFER_SYNC_INTERVAL", time.Minute),
+		Run:      transferService.SyncTransfers,
+	})
+
+	// Broker sync places new reward orders and books fills
+	scheduler.Register(services.Job{
+		Name:     "broker-orders",
+		Interval: utils.DurationFromEnv("BROKER_SYNC_INTERVAL", time.Minute),
+		Run:      brokerService.SyncOrders,
+	})
+
+	// Settlement marks T+1 rewarded shares settled as each session opens, so
+	// shares due that day can be transferred during it
+	scheduler.Register(services.Job{
+		Name:     "settlement",
+		Interval: 24 * time.Hour,
+		Schedule: marketCalendar.LastSessionOpen,
+		Run:      settlementService.SettleDue,
+	})
+
+	// Netting batches pending broker rewards into one order per symbol
+	if brokerService.NettingWindow() > 0 {
+		scheduler.Register(services.Job{
+			Name:     "reward-netting",
+			Interval: brokerService.NettingWindow(),
+			Run:      brokerService.NetPendingRewards,
+		})
+	}
 }
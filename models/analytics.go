@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Analytics rollups are rebuilt by the analytics-rollup job so admin reports
+// never aggregate ledger_entries on request. Reward values are INR at grant time.
+
+// UserRewardRollup summarises the rewards granted to one user
+type UserRewardRollup struct {
+	UserID         int             `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	RewardCount    int64           `gorm:"not null" json:"rewardCount"`
+	RewardValueINR decimal.Decimal `gorm:"type:numeric(18,4);not null;index:idx_user_rollup_value" json:"rewardValueInr"`
+	FirstRewardAt  time.Time       `gorm:"not null" json:"firstRewardAt"`
+	RefreshedAt    time.Time       `gorm:"not null" json:"refreshedAt"`
+}
+
+// TableName specifies the table name for UserRewardRollup
+func (UserRewardRollup) TableName() string {
+	return "user_reward_rollups"
+}
+
+// RewardDistributionRollup summarises rewards granted per symbol and campaign
+type RewardDistributionRollup struct {
+	StockSymbol    string          `gorm:"primaryKey;size:20" json:"symbol"`
+	Campaign       string          `gorm:"primaryKey;size:50" json:"campaign"`
+	RewardCount    int64           `gorm:"not null" json:"rewardCount"`
+	UserCount      int64           `gorm:"not null" json:"userCount"`
+	Quantity       decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	RewardValueINR decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"rewardValueInr"`
+	RefreshedAt    time.Time       `gorm:"not null" json:"refreshedAt"`
+}
+
+// TableName specifies the table name for RewardDistributionRollup
+func (RewardDistributionRollup) TableName() string {
+	return "reward_distribution_rollups"
+}
+
+// DailyNewUserRollup counts users whose first reward fell on an exchange-local day
+type DailyNewUserRollup struct {
+	Date        string    `gorm:"primaryKey;size:10" json:"date"`
+	NewUsers    int64     `gorm:"not null" json:"newUsers"`
+	RefreshedAt time.Time `gorm:"not null" json:"refreshedAt"`
+}
+
+// TableName specifies the table name for DailyNewUserRollup
+func (DailyNewUserRollup) TableName() string {
+	return "daily_new_user_rollups"
+}
+
+// OutstandingRollup is the quantity of a symbol held across all users and
+// its value at the price current when the rollup was refreshed
+type OutstandingRollup struct {
+	StockSymbol string          `gorm:"primaryKey;size:20" json:"symbol"`
+	Quantity    decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	PriceINR    decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"priceInr"`
+	ValueINR    decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"valueInr"`
+	RefreshedAt time.Time       `gorm:"not null" json:"refreshedAt"`
+}
+
+// TableName specifies the table name for OutstandingRollup
+func (OutstandingRollup) TableName() string {
+	return "outstanding_rollups"
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BrokerOrderStatus tracks a buy order through the broker
+type BrokerOrderStatus string
+
+const (
+	// BrokerOrderNew orders are recorded but not yet accepted by the broker
+	BrokerOrderNew BrokerOrderStatus = "NEW"
+	// BrokerOrderPlaced orders are working at the broker
+	BrokerOrderPlaced BrokerOrderStatus = "PLACED"
+	// BrokerOrderFilled orders have a fill and adjusted ledger entries
+	BrokerOrderFilled BrokerOrderStatus = "FILLED"
+	// BrokerOrderRejected orders were refused by the broker
+	BrokerOrderRejected BrokerOrderStatus = "REJECTED"
+)
+
+// BrokerOrder is a market buy of shares handed out as rewards. Estimates are
+// what the rewards' ledger entries were booked at; the fill replaces them.
+type BrokerOrder struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	StockSymbol string            `gorm:"not null;size:20" json:"symbol"`
+	Quantity    decimal.Decimal   `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	Status      BrokerOrderStatus `gorm:"type:varchar(20);not null;default:NEW;index:idx_broker_order_status" json:"status"`
+	BrokerRef   string            `gorm:"size:64" json:"brokerRef,omitempty"`
+	// Estimated price per share in the instrument's currency and INR, and estimated INR charges
+	Currency          string          `gorm:"size:3;not null;default:INR" json:"currency"`
+	EstimatedPrice    decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"estimatedPrice"`
+	EstimatedPriceINR decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"estimatedPriceInr"`
+	EstimatedFeesINR  decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"estimatedFeesInr"`
+	// Fill price per share in the instrument's currency, FX rate and actual INR charges
+	FillPrice     decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"fillPrice"`
+	FillFxRate    decimal.NullDecimal `gorm:"type:numeric(18,6)" json:"fillFxRate"`
+	FillPriceINR  decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"fillPriceInr"`
+	BrokerageINR  decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"brokerageInr"`
+	STTINR        decimal.NullDecimal `gorm:"column:stt_inr;type:numeric(18,4)" json:"sttInr"`
+	GSTINR        decimal.NullDecimal `gorm:"column:gst_inr;type:numeric(18,4)" json:"gstInr"`
+	FeesINR       decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"feesInr"`
+	FailureReason string              `gorm:"size:255" json:"failureReason,omitempty"`
+	PlacedAt      time.Time           `gorm:"not null" json:"placedAt"`
+	FilledAt      *time.Time          `json:"filledAt,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+// TableName specifies the table name for BrokerOrder
+func (BrokerOrder) TableName() string {
+	return "broker_orders"
+}
+
+// BrokerOrderAllocation records the shares of an order bought for one reward.
+// Under netting, OrderID is unset until the reward's symbol is batched.
+type BrokerOrderAllocation struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	OrderID       *uint           `gorm:"index:idx_broker_alloc_order" json:"orderId,omitempty"`
+	RewardEventID uint            `gorm:"not null;uniqueIndex:idx_broker_alloc_reward" json:"rewardEventId"`
+	StockSymbol   string          `gorm:"not null;size:20;default:'';index:idx_broker_alloc_symbol" json:"symbol"`
+	Quantity      decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	// Rejections counts the broker's rejected orders for this reward
+	Rejections int `gorm:"not null;default:0" json:"rejections"`
+	// The reward's pro rata share of the fill: cost at the fill price and charges, in INR
+	CostINR   decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"costInr"`
+	FeesINR   decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"feesInr"`
+	CreatedAt time.Time           `json:"createdAt"`
+}
+
+// TableName specifies the table name for BrokerOrderAllocation
+func (BrokerOrderAllocation) TableName() string {
+	return "broker_order_allocations"
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ContractTradeStatus is the reconciliation state of an imported trade
+type ContractTradeStatus string
+
+const (
+	// ContractTradeMatched trades agree with the booked fees
+	ContractTradeMatched ContractTradeStatus = "MATCHED"
+	// ContractTradeMismatch trades differ from the booked fees and await review
+	ContractTradeMismatch ContractTradeStatus = "MISMATCH"
+	// ContractTradeUnmatched trades have no reward or order to match and await review
+	ContractTradeUnmatched ContractTradeStatus = "UNMATCHED"
+	// ContractTradeAdjusted mismatches were fixed with adjustment entries
+	ContractTradeAdjusted ContractTradeStatus = "ADJUSTED"
+	// ContractTradeAccepted trades were reviewed and left as booked
+	ContractTradeAccepted ContractTradeStatus = "ACCEPTED"
+)
+
+// ContractTrade is one trade from a broker contract note, matched to the
+// broker order placed for rewards or the treasury lot the company bought.
+// Adjustment entries for orders carry ReferenceType CONTRACT_NOTE and
+// ReferenceID = ID; lot adjustments change the lot's fees and cost.
+type ContractTrade struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	ContractNote string `gorm:"not null;size:100;uniqueIndex:idx_contract_trade_line,priority:1" json:"contractNote"`
+	// Line is the trade's line in the contract note file
+	Line        int             `gorm:"not null;uniqueIndex:idx_contract_trade_line,priority:2" json:"line"`
+	TradeDate   string          `gorm:"not null;size:10;index:idx_contract_trade_date" json:"tradeDate"`
+	StockSymbol string          `gorm:"not null;size:20" json:"symbol"`
+	Quantity    decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	Price       decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"price"`
+	OrderRef    string          `gorm:"size:64" json:"orderRef,omitempty"`
+	// Actual INR charges from the contract note
+	BrokerageINR decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"brokerageInr"`
+	STTINR       decimal.Decimal `gorm:"column:stt_inr;type:numeric(18,4);not null" json:"sttInr"`
+	GSTINR       decimal.Decimal `gorm:"column:gst_inr;type:numeric(18,4);not null" json:"gstInr"`
+	FeesINR      decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"feesInr"`
+	// The match and the fees booked for it when imported
+	BrokerOrderID *uint               `gorm:"index:idx_contract_trade_order" json:"brokerOrderId,omitempty"`
+	TreasuryLotID *uint               `gorm:"index:idx_contract_trade_lot" json:"treasuryLotId,omitempty"`
+	BookedFeesINR decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"bookedFeesInr"`
+	DifferenceINR decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"differenceInr"`
+	Status        ContractTradeStatus `gorm:"type:varchar(10);not null;index:idx_contract_trade_status" json:"status"`
+	ReviewedBy    string              `gorm:"size:100" json:"reviewedBy,omitempty"`
+	ReviewNote    string              `gorm:"type:text" json:"reviewNote,omitempty"`
+	ReviewedAt    *time.Time          `json:"reviewedAt,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+// TableName specifies the table name for ContractTrade
+func (ContractTrade) TableName() string {
+	return "contract_trades"
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// HoldingCheckStatus is the outcome of reconciling one symbol
+type HoldingCheckStatus string
+
+const (
+	// HoldingCheckMatched symbols agree with the ledger
+	HoldingCheckMatched HoldingCheckStatus = "MATCHED"
+	// HoldingCheckTiming symbols are short only by shares still awaiting settlement
+	HoldingCheckTiming HoldingCheckStatus = "TIMING"
+	// HoldingCheckBreak symbols differ from the ledger
+	HoldingCheckBreak HoldingCheckStatus = "BREAK"
+)
+
+// HoldingReconciliation is one import of the depository holding statement for
+// the company's pool account, compared with the ledger as of StatementDate
+type HoldingReconciliation struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	StatementDate string    `gorm:"not null;size:10;uniqueIndex:idx_holding_recon_date" json:"statementDate"`
+	FileName      string    `gorm:"size:255" json:"fileName,omitempty"`
+	Symbols       int       `gorm:"not null" json:"symbols"`
+	Breaks        int       `gorm:"not null" json:"breaks"`
+	Timing        int       `gorm:"not null" json:"timing"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for HoldingReconciliation
+func (HoldingReconciliation) TableName() string {
+	return "holding_reconciliations"
+}
+
+// HoldingCheck compares one symbol's depository balance with the shares the
+// pool should hold: users' ledger holdings, treasury inventory and shares
+// the company kept from sales and cancelled rewards.
+// Difference = DepositoryQuantity - ExpectedQuantity.
+type HoldingCheck struct {
+	ID               uint   `gorm:"primaryKey" json:"id"`
+	ReconciliationID uint   `gorm:"not null;index:idx_holding_check_recon" json:"reconciliationId"`
+	StatementDate    string `gorm:"not null;size:10;index:idx_holding_check_symbol,priority:2" json:"statementDate"`
+	StockSymbol      string `gorm:"not null;size:20;index:idx_holding_check_symbol,priority:1" json:"symbol"`
+	// Present is false when the symbol was missing from the statement
+	Present            bool               `gorm:"not null" json:"present"`
+	DepositoryQuantity decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"depositoryQuantity"`
+	LedgerQuantity     decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"ledgerQuantity"`
+	UnsettledQuantity  decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"unsettledQuantity"`
+	TreasuryQuantity   decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"treasuryQuantity"`
+	RetainedQuantity   decimal.Decimal    `gorm:"type:numeric(18,6);not null;default:0" json:"retainedQuantity"`
+	ExpectedQuantity   decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"expectedQuantity"`
+	Difference         decimal.Decimal    `gorm:"type:numeric(18,6);not null" json:"difference"`
+	Status             HoldingCheckStatus `gorm:"type:varchar(10);not null;index:idx_holding_check_status" json:"status"`
+	CreatedAt          time.Time          `json:"createdAt"`
+}
+
+// TableName specifies the table name for HoldingCheck
+func (HoldingCheck) TableName() string {
+	return "holding_checks"
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ExposureAlertStatus represents whether an exposure alert is still in breach
+type ExposureAlertStatus string
+
+const (
+	ExposureAlertOpen     ExposureAlertStatus = "OPEN"
+	ExposureAlertResolved ExposureAlertStatus = "RESOLVED"
+)
+
+// ExposureAlert records a symbol whose outstanding reward shares passed a
+// stock_config threshold. At most one alert per symbol is open at a time.
+type ExposureAlert struct {
+	ID            uint                `gorm:"primaryKey" json:"id"`
+	StockSymbol   string              `gorm:"not null;size:20;index:idx_exposure_alert_symbol" json:"stockSymbol"`
+	Quantity      decimal.Decimal     `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	ValueINR      decimal.Decimal     `gorm:"type:numeric(18,4);not null" json:"valueInr"`
+	LimitINR      decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"limitInr"`
+	LimitQuantity decimal.NullDecimal `gorm:"type:numeric(18,6)" json:"limitQuantity"`
+	Reason        string              `gorm:"type:text;not null" json:"reason"`
+	Status        ExposureAlertStatus `gorm:"type:varchar(10);not null;default:OPEN;index:idx_exposure_alert_status" json:"status"`
+	TriggeredAt   time.Time           `gorm:"not null" json:"triggeredAt"`
+	ResolvedAt    *time.Time          `json:"resolvedAt,omitempty"`
+}
+
+// TableName specifies the table name for ExposureAlert
+func (ExposureAlert) TableName() string {
+	return "exposure_alerts"
+}
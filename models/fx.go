@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BaseCurrency is the currency all valuations and ledger totals are reported in
+const BaseCurrency = "INR"
+
+// FxRate stores the INR value of one unit of a foreign currency over time
+type FxRate struct {
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	Currency  string          `gorm:"not null;size:3;index:idx_fx_currency_time" json:"currency"`
+	RateINR   decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"rateInr"`
+	Timestamp time.Time       `gorm:"not null;index:idx_fx_currency_time" json:"timestamp"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// TableName specifies the table name for FxRate
+func (FxRate) TableName() string {
+	return "fx_rates"
+}
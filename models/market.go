@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// MarketHoliday stores an exchange holiday on which no trading session is held
+type MarketHoliday struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Date        string    `gorm:"not null;size:10;uniqueIndex" json:"date"` // YYYY-MM-DD in exchange time
+	Description string    `gorm:"size:100" json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for MarketHoliday
+func (MarketHoliday) TableName() string {
+	return "market_holidays"
+}
@@ -7,16 +7,31 @@ import (
 	"gorm.io/gorm"
 )
 
+// RewardStatus represents whether a reward's shares have been issued
+type RewardStatus string
+
+const (
+	// RewardStatusIssued rewards have drawn their shares from treasury and have ledger entries
+	RewardStatusIssued RewardStatus = "ISSUED"
+	// RewardStatusQueued rewards are waiting for treasury inventory
+	RewardStatusQueued RewardStatus = "QUEUED"
+)
+
 // RewardEvent represents a stock reward given to a user
 type RewardEvent struct {
 	ID          uint            `gorm:"primaryKey" json:"id"`
 	UserID      int             `gorm:"not null;index:idx_user_rewards" json:"userId"`
 	StockSymbol string          `gorm:"not null;size:20;index:idx_stock_symbol" json:"symbol"`
 	Quantity    decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
-	Timestamp   time.Time       `gorm:"not null;index:idx_timestamp" json:"timestamp"`
-	CreatedAt   time.Time       `json:"createdAt"`
-	UpdatedAt   time.Time       `json:"updatedAt"`
-	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"-"`
+	Campaign    string          `gorm:"size:50;not null;default:'';index:idx_reward_campaign" json:"campaign,omitempty"`
+	Status      RewardStatus    `gorm:"type:varchar(10);not null;default:ISSUED;index:idx_reward_status" json:"status"`
+	// Settlement of the reward's shares; SettlementDate is the exchange date (YYYY-MM-DD) they settle on
+	SettlementStatus SettlementStatus `gorm:"type:varchar(10);not null;default:SETTLED;index:idx_reward_settlement" json:"settlementStatus"`
+	SettlementDate   string           `gorm:"size:10;not null;default:''" json:"settlementDate,omitempty"`
+	Timestamp        time.Time        `gorm:"not null;index:idx_timestamp" json:"timestamp"`
+	CreatedAt        time.Time        `json:"createdAt"`
+	UpdatedAt        time.Time        `json:"updatedAt"`
+	DeletedAt        gorm.DeletedAt   `gorm:"index" json:"-"`
 
 	// Relationships
 	LedgerEntries []LedgerEntry `gorm:"foreignKey:RewardEventID" json:"-"`
@@ -27,6 +42,14 @@ func (RewardEvent) TableName() string {
 	return "reward_events"
 }
 
+// SettlementStatus tracks delivery of traded shares (T+1)
+type SettlementStatus string
+
+const (
+	SettlementUnsettled SettlementStatus = "UNSETTLED"
+	SettlementSettled   SettlementStatus = "SETTLED"
+)
+
 // EntryType represents the type of ledger entry
 type EntryType string
 
@@ -36,16 +59,51 @@ const (
 	EntryTypeFee   EntryType = "FEE"
 )
 
-// LedgerEntry represents double-entry accounting for rewards
+// LedgerAccount is the party whose balance an entry moves
+type LedgerAccount string
+
+const (
+	// AccountUser entries are the user's shares and INR cash balance
+	AccountUser LedgerAccount = "USER"
+	// AccountCompany entries are the company's payments on the user's behalf
+	AccountCompany LedgerAccount = "COMPANY"
+)
+
+// ReferenceType names the business event that booked a ledger entry
+type ReferenceType string
+
+const (
+	ReferenceReward   ReferenceType = "REWARD"
+	ReferenceSale     ReferenceType = "SALE"
+	ReferenceTransfer ReferenceType = "TRANSFER"
+	// ReferenceBrokerOrder entries adjust a reward's estimated cost to its order's fill
+	ReferenceBrokerOrder ReferenceType = "BROKER_ORDER"
+	// ReferenceContractNote entries correct a reward's fees to its contract note
+	ReferenceContractNote ReferenceType = "CONTRACT_NOTE"
+)
+
+// LedgerEntry represents double-entry accounting for rewards and user trades
 type LedgerEntry struct {
-	ID             uint            `gorm:"primaryKey" json:"id"`
-	RewardEventID  uint            `gorm:"not null;index:idx_reward_event" json:"rewardEventId"`
-	EntryType      EntryType       `gorm:"type:varchar(10);not null" json:"entryType"`
-	StockSymbol    *string         `gorm:"size:20" json:"stockSymbol,omitempty"`
-	Quantity       decimal.Decimal `gorm:"type:numeric(18,6);not null;default:0" json:"quantity"`
-	AmountINR      decimal.Decimal `gorm:"type:numeric(18,4);not null;default:0" json:"amountInr"`
-	Timestamp      time.Time       `gorm:"not null" json:"timestamp"`
-	CreatedAt      time.Time       `json:"createdAt"`
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID int  `gorm:"not null;default:0;index:idx_ledger_user" json:"userId"`
+	// RewardEventID is set for entries booked by a reward or its reversal
+	RewardEventID *uint           `gorm:"index:idx_reward_event" json:"rewardEventId,omitempty"`
+	ReferenceType ReferenceType   `gorm:"type:varchar(20);not null;default:REWARD;index:idx_ledger_reference,priority:1" json:"referenceType"`
+	ReferenceID   uint            `gorm:"not null;default:0;index:idx_ledger_reference,priority:2" json:"referenceId"`
+	Account       LedgerAccount   `gorm:"type:varchar(10);not null;default:USER" json:"account"`
+	EntryType     EntryType       `gorm:"type:varchar(10);not null" json:"entryType"`
+	StockSymbol   *string         `gorm:"size:20" json:"stockSymbol,omitempty"`
+	Quantity      decimal.Decimal `gorm:"type:numeric(18,6);not null;default:0" json:"quantity"`
+	AmountINR     decimal.Decimal `gorm:"type:numeric(18,4);not null;default:0" json:"amountInr"`
+	// Amount in the instrument's currency and the FX rate used to convert it to AmountINR
+	Currency       string          `gorm:"size:3;not null;default:INR" json:"currency"`
+	AmountOriginal decimal.Decimal `gorm:"type:numeric(18,4);not null;default:0" json:"amountOriginal"`
+	FxRate         decimal.Decimal `gorm:"type:numeric(18,6);not null;default:1" json:"fxRate"`
+	// Settlement of a STOCK entry's shares, as for its reward
+	SettlementStatus SettlementStatus `gorm:"type:varchar(10);not null;default:SETTLED;index:idx_ledger_settlement" json:"settlementStatus"`
+	SettlementDate   string           `gorm:"size:10;not null;default:''" json:"settlementDate,omitempty"`
+	Timestamp        time.Time        `gorm:"not null" json:"timestamp"`
+	CreatedAt        time.Time        `json:"createdAt"`
 
 	// Relationships
 	RewardEvent RewardEvent `gorm:"foreignKey:RewardEventID" json:"-"`
@@ -56,12 +114,26 @@ func (LedgerEntry) TableName() string {
 	return "ledger_entries"
 }
 
-// PriceHistory stores historical stock prices
+// PriceResolution describes how densely a price_history row samples the market
+type PriceResolution string
+
+const (
+	// PriceResolutionRaw is an intraday price as recorded
+	PriceResolutionRaw PriceResolution = "RAW"
+	// PriceResolutionDaily is the single close kept for a compacted day
+	PriceResolutionDaily PriceResolution = "DAILY"
+)
+
+// PriceHistory stores historical stock prices.
+// Price is in the instrument's currency; PriceINR is its INR value when recorded.
 type PriceHistory struct {
 	ID          uint            `gorm:"primaryKey" json:"id"`
 	StockSymbol string          `gorm:"not null;size:20;index:idx_symbol_time" json:"stockSymbol"`
+	Price       decimal.Decimal `gorm:"type:numeric(18,4);not null;default:0" json:"price"`
+	Currency    string          `gorm:"size:3;not null;default:INR" json:"currency"`
 	PriceINR    decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"priceInr"`
 	Timestamp   time.Time       `gorm:"not null;index:idx_symbol_time" json:"timestamp"`
+	Resolution  PriceResolution `gorm:"type:varchar(10);not null;default:RAW" json:"resolution"`
 	CreatedAt   time.Time       `json:"createdAt"`
 }
 
@@ -74,11 +146,22 @@ func (PriceHistory) TableName() string {
 type StockConfig struct {
 	ID          uint            `gorm:"primaryKey" json:"id"`
 	StockSymbol string          `gorm:"not null;size:20;uniqueIndex" json:"stockSymbol"`
+	Currency    string          `gorm:"size:3;not null;default:INR" json:"currency"`
 	Multiplier  decimal.Decimal `gorm:"type:numeric(18,6);not null;default:1" json:"multiplier"`
 	IsActive    bool            `gorm:"not null;default:true" json:"isActive"`
 	Notes       string          `gorm:"type:text" json:"notes,omitempty"`
-	UpdatedAt   time.Time       `json:"updatedAt"`
-	CreatedAt   time.Time       `json:"createdAt"`
+
+	// Price sanity limits (percentages); prices outside them are quarantined
+	MaxPriceMovePct      decimal.Decimal `gorm:"type:numeric(8,4);not null;default:10" json:"maxPriceMovePct"`
+	PriceBandPct         decimal.Decimal `gorm:"type:numeric(8,4);not null;default:20" json:"priceBandPct"`
+	PriceBandWindowHours int             `gorm:"not null;default:72" json:"priceBandWindowHours"`
+
+	// Exposure alert thresholds for shares owed to users; null disables the check
+	MaxExposureINR      decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"maxExposureInr"`
+	MaxExposureQuantity decimal.NullDecimal `gorm:"type:numeric(18,6)" json:"maxExposureQuantity"`
+
+	UpdatedAt time.Time `json:"updatedAt"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 // TableName specifies the table name for StockConfig
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// QuarantineStatus represents the review state of a quarantined price
+type QuarantineStatus string
+
+const (
+	QuarantineStatusPending  QuarantineStatus = "PENDING"
+	QuarantineStatusApproved QuarantineStatus = "APPROVED"
+	QuarantineStatusRejected QuarantineStatus = "REJECTED"
+)
+
+// PriceQuarantine holds a price that failed sanity checks and awaits review.
+// Checks compare prices in the instrument's currency.
+type PriceQuarantine struct {
+	ID            uint                `gorm:"primaryKey" json:"id"`
+	StockSymbol   string              `gorm:"not null;size:20;index:idx_quarantine_symbol" json:"stockSymbol"`
+	Price         decimal.Decimal     `gorm:"type:numeric(18,4);not null;default:0" json:"price"`
+	Currency      string              `gorm:"size:3;not null;default:INR" json:"currency"`
+	PriceINR      decimal.Decimal     `gorm:"type:numeric(18,4);not null" json:"priceInr"`
+	PreviousPrice decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"previousPrice"`
+	BandLow       decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"bandLow"`
+	BandHigh      decimal.NullDecimal `gorm:"type:numeric(18,4)" json:"bandHigh"`
+	Reason        string              `gorm:"type:text;not null" json:"reason"`
+	Status        QuarantineStatus    `gorm:"type:varchar(10);not null;default:PENDING;index:idx_quarantine_status" json:"status"`
+	Timestamp     time.Time           `gorm:"not null" json:"timestamp"`
+	Resolution    PriceResolution     `gorm:"type:varchar(10);not null;default:RAW" json:"resolution"`
+	ReviewedBy    string              `gorm:"size:100" json:"reviewedBy,omitempty"`
+	ReviewNote    string              `gorm:"type:text" json:"reviewNote,omitempty"`
+	ReviewedAt    *time.Time          `json:"reviewedAt,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+// TableName specifies the table name for PriceQuarantine
+func (PriceQuarantine) TableName() string {
+	return "price_quarantine"
+}
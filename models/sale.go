@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Sale records a user selling reward shares back for INR.
+// Its ledger entries carry ReferenceType SALE and ReferenceID = ID.
+type Sale struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      int             `gorm:"not null;index:idx_sale_user" json:"userId"`
+	StockSymbol string          `gorm:"not null;size:20" json:"symbol"`
+	Quantity    decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	// Price per share in the instrument's currency and the FX rate used for PriceINR
+	Price     decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"price"`
+	Currency  string          `gorm:"size:3;not null;default:INR" json:"currency"`
+	FxRate    decimal.Decimal `gorm:"type:numeric(18,6);not null;default:1" json:"fxRate"`
+	PriceINR  decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"priceInr"`
+	GrossINR  decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"grossInr"`
+	FeesINR   decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"feesInr"`
+	NetINR    decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"netInr"`
+	Timestamp time.Time       `gorm:"not null" json:"timestamp"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// TableName specifies the table name for Sale
+func (Sale) TableName() string {
+	return "sales"
+}
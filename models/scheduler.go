@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// SchedulerJobRun records the last run of a background job across all instances
+type SchedulerJobRun struct {
+	JobName      string     `gorm:"primaryKey;size:50" json:"jobName"`
+	LastRunAt    *time.Time `json:"lastRunAt"`
+	LastInstance string     `gorm:"size:100" json:"lastInstance"`
+	LastError    string     `gorm:"type:text" json:"lastError,omitempty"`
+	LastDuration int64      `gorm:"not null;default:0" json:"lastDurationMs"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// TableName specifies the table name for SchedulerJobRun
+func (SchedulerJobRun) TableName() string {
+	return "scheduler_job_runs"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AccountStatement is a user's monthly statement, stored in every format it is served in
+type AccountStatement struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID int  `gorm:"not null;uniqueIndex:idx_statement_user_month,priority:1" json:"userId"`
+	// Month is the calendar month in IST, formatted YYYY-MM
+	Month           string          `gorm:"not null;size:7;uniqueIndex:idx_statement_user_month,priority:2;index:idx_statement_month" json:"month"`
+	OpeningValueINR decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"openingValueInr"`
+	ClosingValueINR decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"closingValueInr"`
+	Data            string          `gorm:"type:text;not null" json:"-"`
+	CSV             string          `gorm:"column:csv;type:text;not null" json:"-"`
+	HTML            string          `gorm:"column:html;type:text;not null" json:"-"`
+	GeneratedAt     time.Time       `gorm:"not null" json:"generatedAt"`
+}
+
+// TableName specifies the table name for AccountStatement
+func (AccountStatement) TableName() string {
+	return "account_statements"
+}
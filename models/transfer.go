@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TransferStatus tracks an outbound transfer through the depository
+type TransferStatus string
+
+const (
+	// TransferRequested transfers are accepted but not yet handed to the depository
+	TransferRequested TransferStatus = "REQUESTED"
+	// TransferProcessing transfers are with the depository
+	TransferProcessing TransferStatus = "PROCESSING"
+	// TransferCompleted transfers have left the user's holdings
+	TransferCompleted TransferStatus = "COMPLETED"
+	// TransferFailed transfers were rejected; their shares are released
+	TransferFailed TransferStatus = "FAILED"
+)
+
+// Transfer moves a user's whole reward shares to their own demat account.
+// Requested and processing transfers hold their quantity against disposals.
+// Ledger entries carry ReferenceType TRANSFER and ReferenceID = ID.
+type Transfer struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      int             `gorm:"not null;index:idx_transfer_user" json:"userId"`
+	StockSymbol string          `gorm:"not null;size:20" json:"symbol"`
+	Quantity    decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	// FractionalQuantity is settled in cash on completion, as a sale
+	FractionalQuantity decimal.Decimal `gorm:"type:numeric(18,6);not null;default:0" json:"fractionalQuantity"`
+	FractionSaleID     *uint           `json:"fractionSaleId,omitempty"`
+	// DematAccount is the receiving depository account (DP ID and client ID)
+	DematAccount  string         `gorm:"not null;size:32" json:"dematAccount"`
+	Status        TransferStatus `gorm:"type:varchar(20);not null;default:REQUESTED;index:idx_transfer_status" json:"status"`
+	DepositoryRef string         `gorm:"size:64" json:"depositoryRef,omitempty"`
+	FailureReason string         `gorm:"size:255" json:"failureReason,omitempty"`
+	RequestedAt   time.Time      `gorm:"not null" json:"requestedAt"`
+	CompletedAt   *time.Time     `json:"completedAt,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+// TableName specifies the table name for Transfer
+func (Transfer) TableName() string {
+	return "transfers"
+}
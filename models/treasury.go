@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TreasuryLot is a block of shares the company bought to hand out as rewards.
+// Rewards draw from the oldest lot with shares remaining (FIFO).
+type TreasuryLot struct {
+	ID                uint            `gorm:"primaryKey" json:"id"`
+	StockSymbol       string          `gorm:"not null;size:20;index:idx_treasury_lot_fifo,priority:1" json:"symbol"`
+	Quantity          decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	RemainingQuantity decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"remainingQuantity"`
+	// Price per share in the instrument's currency and the FX rate used for CostINR
+	Price     decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"price"`
+	Currency  string          `gorm:"size:3;not null;default:INR" json:"currency"`
+	FxRate    decimal.Decimal `gorm:"type:numeric(18,6);not null;default:1" json:"fxRate"`
+	FeesINR   decimal.Decimal `gorm:"type:numeric(18,4);not null;default:0" json:"feesInr"`
+	CostINR   decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"costInr"`
+	Reference string          `gorm:"size:100" json:"reference,omitempty"`
+	// PurchasedAt orders lots for FIFO draws and ageing
+	PurchasedAt time.Time `gorm:"not null;index:idx_treasury_lot_fifo,priority:2" json:"purchasedAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for TreasuryLot
+func (TreasuryLot) TableName() string {
+	return "treasury_lots"
+}
+
+// TreasuryAllocation records the shares a reward drew from one treasury lot
+// and their share of the lot's cost
+type TreasuryAllocation struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	RewardEventID uint            `gorm:"not null;index:idx_treasury_alloc_reward" json:"rewardEventId"`
+	LotID         uint            `gorm:"not null;index:idx_treasury_alloc_lot" json:"lotId"`
+	Quantity      decimal.Decimal `gorm:"type:numeric(18,6);not null" json:"quantity"`
+	CostINR       decimal.Decimal `gorm:"type:numeric(18,4);not null" json:"costInr"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// TableName specifies the table name for TreasuryAllocation
+func (TreasuryAllocation) TableName() string {
+	return "treasury_allocations"
+}
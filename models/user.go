@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSettings stores per-user preferences
+type UserSettings struct {
+	UserID int `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	// Timezone is an IANA name used for "today" and daily valuation boundaries
+	Timezone  string    `gorm:"size:64;not null;default:Asia/Kolkata" json:"timezone"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for UserSettings
+func (UserSettings) TableName() string {
+	return "user_settings"
+}
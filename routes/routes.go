@@ -9,8 +9,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRouter configures all routes and middleware
-func SetupRouter() *gin.Engine {
+// SetupRouter configures all routes and middleware.
+// Shared services are created in main so background jobs and handlers see the same state.
+func SetupRouter(priceService *services.PriceService, marketCalendar *services.MarketCalendar, eventBroker *services.EventBroker, analyticsService *services.AnalyticsService, exposureService *services.ExposureService, statementService *services.StatementService, transferService *services.TransferService, brokerService *services.BrokerService) *gin.Engine {
 	router := gin.New()
 
 	// Middleware
@@ -26,12 +27,31 @@ func SetupRouter() *gin.Engine {
 	router.Use(cors.New(config))
 
 	// Initialize services
-	priceService := services.NewPriceService()
 	ledgerService := services.NewLedgerService()
-	rewardService := services.NewRewardService(priceService, ledgerService)
+	treasuryService := services.NewTreasuryService(priceService, marketCalendar, services.LoadTreasuryConfig())
+	rewardService := services.NewRewardService(priceService, ledgerService, treasuryService, brokerService, marketCalendar)
+	priceImportService := services.NewPriceImportService(marketCalendar, priceService)
+	settingsService := services.NewUserSettingsService()
+	saleService := services.NewSaleService(priceService, ledgerService)
+	capitalGainsService := services.NewCapitalGainsService(ledgerService)
+	contractNoteService := services.NewContractNoteService(marketCalendar)
+	holdingReconciliationService := services.NewHoldingReconciliationService(ledgerService, marketCalendar)
 
 	// Initialize controllers
-	rewardController := controllers.NewRewardController(rewardService)
+	rewardController := controllers.NewRewardController(rewardService, settingsService)
+	userController := controllers.NewUserController(settingsService)
+	saleController := controllers.NewSaleController(saleService, capitalGainsService)
+	marketController := controllers.NewMarketController(marketCalendar)
+	priceController := controllers.NewPriceController(priceService, priceImportService)
+	streamController := controllers.NewStreamController(priceService, rewardService, eventBroker)
+	analyticsController := controllers.NewAnalyticsController(analyticsService)
+	exposureController := controllers.NewExposureController(exposureService)
+	treasuryController := controllers.NewTreasuryController(treasuryService)
+	statementController := controllers.NewStatementController(statementService)
+	transferController := controllers.NewTransferController(transferService)
+	brokerController := controllers.NewBrokerController(brokerService)
+	contractNoteController := controllers.NewContractNoteController(contractNoteService)
+	holdingReconciliationController := controllers.NewHoldingReconciliationController(holdingReconciliationService)
 
 	// API routes
 	api := router.Group("/api")
@@ -45,6 +65,84 @@ func SetupRouter() *gin.Engine {
 		api.GET("/historical-inr/:userId", rewardController.GetHistoricalINR)
 		api.GET("/stats/:userId", rewardController.GetStats)
 		api.GET("/portfolio/:userId", rewardController.GetPortfolio)
+
+		// User settings endpoints
+		api.GET("/users/:userId/settings", userController.GetSettings)
+		api.PUT("/users/:userId/settings", userController.UpdateSettings)
+
+		// User sell endpoints
+		api.POST("/users/:userId/sell", saleController.Sell)
+		api.GET("/users/:userId/sales", saleController.ListSales)
+		api.GET("/users/:userId/capital-gains", saleController.GetCapitalGains)
+
+		// Monthly account statements
+		api.GET("/users/:userId/statements", statementController.ListStatements)
+		api.GET("/users/:userId/statements/:month", statementController.GetStatement)
+
+		// Outbound transfers to the user's demat account
+		api.POST("/users/:userId/transfers", transferController.RequestTransfer)
+		api.GET("/users/:userId/transfers", transferController.ListTransfers)
+		api.GET("/users/:userId/transfers/:id", transferController.GetTransfer)
+
+		// Market calendar endpoints
+		api.GET("/market/status", marketController.GetStatus)
+		api.GET("/market/holidays", marketController.GetHolidays)
+
+		// Server-Sent Events streams
+		api.GET("/stream/prices", streamController.StreamPrices)
+		api.GET("/stream/portfolio/:userId", streamController.StreamPortfolio)
+	}
+
+	// Admin routes (require X-Admin-Key)
+	admin := api.Group("/admin", utils.AdminAuth())
+	{
+		admin.POST("/market/holidays", marketController.SaveHolidays)
+		admin.POST("/prices/import", priceController.ImportPrices)
+		admin.GET("/prices/quarantine", priceController.ListQuarantine)
+		admin.POST("/prices/quarantine/:id/approve", priceController.ApproveQuarantine)
+		admin.POST("/prices/quarantine/:id/reject", priceController.RejectQuarantine)
+
+		// Cross-user analytics, served from rollups
+		admin.GET("/analytics/top-users", analyticsController.GetTopUsers)
+		admin.GET("/analytics/distribution", analyticsController.GetDistribution)
+		admin.GET("/analytics/new-users", analyticsController.GetNewUsers)
+		admin.GET("/analytics/outstanding", analyticsController.GetOutstanding)
+		admin.POST("/analytics/refresh", analyticsController.RefreshRollups)
+
+		// Company exposure to shares owed to users
+		admin.GET("/exposure", exposureController.GetExposure)
+		admin.GET("/exposure/alerts", exposureController.ListAlerts)
+		admin.PUT("/exposure/limits/:symbol", exposureController.SetLimits)
+
+		// Treasury inventory the rewards are drawn from
+		admin.POST("/treasury/lots", treasuryController.AddLot)
+		admin.GET("/treasury/lots", treasuryController.ListLots)
+		admin.GET("/treasury/inventory", treasuryController.GetInventory)
+		admin.GET("/treasury/queue", treasuryController.ListQueue)
+
+		// Monthly statement generation
+		admin.POST("/statements/generate", statementController.GenerateStatements)
+
+		// Poll the depository for transfer outcomes
+		admin.POST("/transfers/sync", transferController.SyncTransfers)
+
+		// Buy orders placed for rewards under broker fulfilment
+		admin.GET("/broker/orders", brokerController.ListOrders)
+		admin.GET("/broker/orders/:id", brokerController.GetOrder)
+		admin.POST("/broker/net", brokerController.NetPendingRewards)
+		admin.POST("/broker/sync", brokerController.SyncOrders)
+
+		// Broker contract notes reconciled against booked fees
+		admin.POST("/contract-notes/import", contractNoteController.ImportContractNote)
+		admin.GET("/contract-notes/trades", contractNoteController.ListTrades)
+		admin.POST("/contract-notes/trades/:id/adjust", contractNoteController.AdjustTrade)
+		admin.POST("/contract-notes/trades/:id/accept", contractNoteController.AcceptTrade)
+
+		// Depository holding statements reconciled against the ledger
+		admin.POST("/depository/holdings/import", holdingReconciliationController.ImportStatement)
+		admin.GET("/depository/holdings/:symbol/history", holdingReconciliationController.GetSymbolHistory)
+		admin.GET("/depository/reconciliations", holdingReconciliationController.ListReconciliations)
+		admin.GET("/depository/reconciliations/:date", holdingReconciliationController.GetReconciliation)
 	}
 
 	// Root endpoint
@@ -58,6 +156,17 @@ func SetupRouter() *gin.Engine {
 				"GET  /api/historical-inr/:userId":    "Get historical INR valuations",
 				"GET  /api/stats/:userId":             "Get user statistics",
 				"GET  /api/portfolio/:userId":         "Get user portfolio",
+				"GET  /api/users/:userId/settings":    "Get user settings",
+				"PUT  /api/users/:userId/settings":    "Update user timezone",
+				"POST /api/users/:userId/sell":        "Sell reward shares for INR",
+				"GET  /api/users/:userId/sales":       "List a user's sales",
+				"GET  /api/users/:userId/capital-gains": "Capital gains statement by financial year",
+				"GET  /api/users/:userId/statements/:month": "Monthly account statement (json, csv or html)",
+				"POST /api/users/:userId/transfers": "Transfer reward shares to a demat account",
+				"GET  /api/market/status":             "Get current market session status",
+				"GET  /api/market/holidays":           "List exchange holidays",
+				"GET  /api/stream/prices":             "Stream price updates (SSE)",
+				"GET  /api/stream/portfolio/:userId":   "Stream portfolio updates (SSE)",
 				"GET  /api/health":                    "Health check",
 			},
 		})
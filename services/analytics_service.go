@@ -0,0 +1,274 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Reward distribution dimensions
+const (
+	DistributionBySymbol   = "symbol"
+	DistributionByCampaign = "campaign"
+)
+
+// ErrInvalidAnalyticsQuery is returned for an unknown dimension or an unusable window
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// AnalyticsService serves cross-user reports from rollup tables.
+// RefreshRollups rebuilds them; reads never touch ledger_entries.
+type AnalyticsService struct {
+	priceService *PriceService
+}
+
+// NewAnalyticsService creates a new analytics service
+func NewAnalyticsService(priceService *PriceService) *AnalyticsService {
+	return &AnalyticsService{
+		priceService: priceService,
+	}
+}
+
+// rewardTotalsCTE is one row per live reward: its user, symbol, campaign,
+// granted quantity and INR value. Fully reversed rewards net to zero and drop out.
+const rewardTotalsCTE = `
+	WITH rewards AS (
+		SELECT re.id, re.user_id, re.stock_symbol, re.campaign, re.timestamp,
+		       SUM(le.quantity) AS quantity, SUM(le.amount_inr) AS value_inr
+		FROM reward_events re
+		JOIN ledger_entries le ON le.reward_event_id = re.id
+		WHERE re.deleted_at IS NULL AND le.entry_type = 'STOCK'
+		GROUP BY re.id
+		HAVING SUM(le.quantity) > 0
+	)
+`
+
+// RefreshRollups rebuilds every analytics rollup in one transaction so
+// readers always see a consistent snapshot
+func (s *AnalyticsService) RefreshRollups() error {
+	refreshedAt := utils.NowUTC()
+
+	var outstanding []models.OutstandingRollup
+	err := db.DB.Raw(`
+		SELECT le.stock_symbol, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.entry_type = 'STOCK' AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		GROUP BY le.stock_symbol
+		HAVING SUM(le.quantity) > 0
+		ORDER BY le.stock_symbol
+	`).Scan(&outstanding).Error
+	if err != nil {
+		return fmt.Errorf("failed to aggregate outstanding holdings: %w", err)
+	}
+
+	symbols := make([]string, len(outstanding))
+	for i, row := range outstanding {
+		symbols[i] = row.StockSymbol
+	}
+	prices := map[string]decimal.Decimal{}
+	if len(symbols) > 0 {
+		if prices, err = s.priceService.GetCurrentPrices(symbols); err != nil {
+			return fmt.Errorf("failed to fetch current prices: %w", err)
+		}
+	}
+	for i := range outstanding {
+		row := &outstanding[i]
+		price, ok := prices[row.StockSymbol]
+		if !ok {
+			logrus.Warnf("No current price for %s, valuing outstanding quantity at zero", row.StockSymbol)
+		}
+		row.PriceINR = price
+		row.ValueINR = utils.RoundINR(price.Mul(row.Quantity))
+		row.RefreshedAt = refreshedAt
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"user_reward_rollups", "reward_distribution_rollups", "daily_new_user_rollups", "outstanding_rollups"} {
+			if err := tx.Exec("DELETE FROM " + table).Error; err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table, err)
+			}
+		}
+
+		if err := tx.Exec(rewardTotalsCTE+`
+			INSERT INTO user_reward_rollups (user_id, reward_count, reward_value_inr, first_reward_at, refreshed_at)
+			SELECT user_id, COUNT(*), SUM(value_inr), MIN(timestamp), ?
+			FROM rewards
+			GROUP BY user_id
+		`, refreshedAt).Error; err != nil {
+			return fmt.Errorf("failed to roll up user rewards: %w", err)
+		}
+
+		if err := tx.Exec(rewardTotalsCTE+`
+			INSERT INTO reward_distribution_rollups (stock_symbol, campaign, reward_count, user_count, quantity, reward_value_inr, refreshed_at)
+			SELECT stock_symbol, campaign, COUNT(*), COUNT(DISTINCT user_id), SUM(quantity), SUM(value_inr), ?
+			FROM rewards
+			GROUP BY stock_symbol, campaign
+		`, refreshedAt).Error; err != nil {
+			return fmt.Errorf("failed to roll up reward distribution: %w", err)
+		}
+
+		if err := tx.Exec(`
+			INSERT INTO daily_new_user_rollups (date, new_users, refreshed_at)
+			SELECT to_char(first_reward_at AT TIME ZONE ?, 'YYYY-MM-DD') AS date, COUNT(*), ?
+			FROM user_reward_rollups
+			GROUP BY 1
+		`, utils.ExchangeTimezone, refreshedAt).Error; err != nil {
+			return fmt.Errorf("failed to roll up new users: %w", err)
+		}
+
+		if len(outstanding) > 0 {
+			if err := tx.Create(&outstanding).Error; err != nil {
+				return fmt.Errorf("failed to save outstanding rollup: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("symbols", len(outstanding)).Info("Analytics rollups refreshed")
+	return nil
+}
+
+// TopUsers returns the users with the highest granted reward value
+func (s *AnalyticsService) TopUsers(limit int) (map[string]interface{}, error) {
+	if limit <= 0 || limit > 1000 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and 1000", ErrInvalidAnalyticsQuery)
+	}
+
+	var users []models.UserRewardRollup
+	err := db.DB.Order("reward_value_inr DESC, user_id").Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch top users: %w", err)
+	}
+
+	return map[string]interface{}{
+		"users":       users,
+		"refreshedAt": s.refreshedAt(&models.UserRewardRollup{}),
+	}, nil
+}
+
+// Distribution returns granted rewards grouped by symbol or by campaign
+func (s *AnalyticsService) Distribution(by string) (map[string]interface{}, error) {
+	var column string
+	switch by {
+	case DistributionBySymbol:
+		column = "stock_symbol"
+	case DistributionByCampaign:
+		column = "campaign"
+	default:
+		return nil, fmt.Errorf("%w: by must be %s or %s", ErrInvalidAnalyticsQuery, DistributionBySymbol, DistributionByCampaign)
+	}
+
+	var rows []struct {
+		Key            string
+		RewardCount    int64
+		UserCount      int64
+		Quantity       decimal.Decimal
+		RewardValueINR decimal.Decimal
+	}
+	// Users are counted per symbol+campaign, so a user rewarded in several is
+	// counted in each; the per-group user count is an upper bound
+	err := db.DB.Model(&models.RewardDistributionRollup{}).
+		Select(column + " AS key, SUM(reward_count) AS reward_count, SUM(user_count) AS user_count, SUM(quantity) AS quantity, SUM(reward_value_inr) AS reward_value_inr").
+		Group(column).
+		Order("reward_value_inr DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reward distribution: %w", err)
+	}
+
+	items := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		item := map[string]interface{}{
+			by:               row.Key,
+			"rewardCount":    row.RewardCount,
+			"userCount":      row.UserCount,
+			"rewardValueInr": row.RewardValueINR,
+		}
+		if by == DistributionBySymbol {
+			item["quantity"] = row.Quantity
+		}
+		items = append(items, item)
+	}
+
+	return map[string]interface{}{
+		"by":           by,
+		"distribution": items,
+		"refreshedAt":  s.refreshedAt(&models.RewardDistributionRollup{}),
+	}, nil
+}
+
+// NewUsers returns the number of first-time rewarded users per exchange day
+// between two optional dates (inclusive)
+func (s *AnalyticsService) NewUsers(from, to *time.Time) (map[string]interface{}, error) {
+	if from != nil && to != nil && from.After(*to) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidAnalyticsQuery)
+	}
+
+	query := db.DB.Order("date")
+	if from != nil {
+		query = query.Where("date >= ?", utils.GetDateString(*from))
+	}
+	if to != nil {
+		query = query.Where("date <= ?", utils.GetDateString(*to))
+	}
+
+	var days []models.DailyNewUserRollup
+	if err := query.Find(&days).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch new users: %w", err)
+	}
+
+	total := int64(0)
+	for _, day := range days {
+		total += day.NewUsers
+	}
+
+	return map[string]interface{}{
+		"days":        days,
+		"totalUsers":  total,
+		"timezone":    utils.ExchangeTimezone,
+		"refreshedAt": s.refreshedAt(&models.DailyNewUserRollup{}),
+	}, nil
+}
+
+// Outstanding returns the quantity and value of rewarded stock still held
+// across all users
+func (s *AnalyticsService) Outstanding() (map[string]interface{}, error) {
+	var symbols []models.OutstandingRollup
+	if err := db.DB.Find(&symbols).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch outstanding holdings: %w", err)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].ValueINR.GreaterThan(symbols[j].ValueINR) })
+
+	total := decimal.Zero
+	for _, symbol := range symbols {
+		total = total.Add(symbol.ValueINR)
+	}
+
+	return map[string]interface{}{
+		"symbols":       symbols,
+		"totalValueInr": total,
+		"refreshedAt":   s.refreshedAt(&models.OutstandingRollup{}),
+	}, nil
+}
+
+// refreshedAt returns when a rollup table was last rebuilt, or nil if it is empty
+func (s *AnalyticsService) refreshedAt(model interface{}) *time.Time {
+	var refreshedAt *time.Time
+	if err := db.DB.Model(model).Select("MAX(refreshed_at)").Scan(&refreshedAt).Error; err != nil {
+		logrus.WithError(err).Warn("Failed to read rollup refresh time")
+		return nil
+	}
+	return refreshedAt
+}
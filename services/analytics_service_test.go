@@ -0,0 +1,64 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRefreshRollupsSkipsDeletedRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "ANLTEST"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(100),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(100),
+		Timestamp:   now,
+	})
+
+	var deleted models.RewardEvent
+	for _, quantity := range []int64{2, 3} {
+		reward := models.RewardEvent{
+			UserID:      fixtureUserID,
+			StockSymbol: symbol,
+			Quantity:    decimal.NewFromInt(quantity),
+			Timestamp:   now.Add(-time.Hour),
+		}
+		mustCreate(t, &reward)
+		entries := rewardLedgerEntries(&reward, newQuote(symbol, "INR", decimal.NewFromInt(100), decimal.NewFromInt(1), reward.Timestamp))
+		mustCreate(t, &entries)
+		deleted = reward
+	}
+	if err := db.DB.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewAnalyticsService(NewPriceService(NewMarketCalendar()))
+	if err := service.RefreshRollups(); err != nil {
+		t.Fatalf("RefreshRollups: %v", err)
+	}
+
+	var outstanding models.OutstandingRollup
+	if err := db.DB.Where("stock_symbol = ?", symbol).First(&outstanding).Error; err != nil {
+		t.Fatalf("outstanding rollup: %v", err)
+	}
+	if !outstanding.Quantity.Equal(decimal.NewFromInt(2)) || !outstanding.ValueINR.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("outstanding = %s shares worth %s, want 2 worth 200", outstanding.Quantity, outstanding.ValueINR)
+	}
+
+	var distribution []models.RewardDistributionRollup
+	if err := db.DB.Where("stock_symbol = ?", symbol).Find(&distribution).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(distribution) != 1 || distribution[0].RewardCount != 1 || !distribution[0].Quantity.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("distribution = %+v, want one reward of 2 shares", distribution)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// BrokerOrderRequest is a market buy order sent to the broker
+type BrokerOrderRequest struct {
+	OrderID  uint
+	Symbol   string
+	Quantity decimal.Decimal
+	PlacedAt time.Time
+}
+
+// BrokerFill is the execution of an order: the price per share in the
+// instrument's currency, the FX rate to INR and the INR charges
+type BrokerFill struct {
+	Price        decimal.Decimal
+	Currency     string
+	FxRate       decimal.Decimal
+	BrokerageINR decimal.Decimal
+	STTINR       decimal.Decimal
+	GSTINR       decimal.Decimal
+	FilledAt     time.Time
+}
+
+// PriceINR returns the fill price converted to INR
+func (f BrokerFill) PriceINR() decimal.Decimal {
+	return utils.RoundINR(f.Price.Mul(f.FxRate))
+}
+
+// FeesINR returns the total charges
+func (f BrokerFill) FeesINR() decimal.Decimal {
+	return f.BrokerageINR.Add(f.STTINR).Add(f.GSTINR)
+}
+
+// BrokerOrderUpdate is the broker's view of a placed order. Fill is set once
+// the order has executed; Rejected orders carry a Reason.
+type BrokerOrderUpdate struct {
+	Fill     *BrokerFill
+	Rejected bool
+	Reason   string
+}
+
+// Broker executes buy orders. PlaceOrder must be idempotent per OrderID, as
+// orders are resubmitted after errors.
+type Broker interface {
+	// PlaceOrder submits an order and returns the broker's reference
+	PlaceOrder(order BrokerOrderRequest) (string, error)
+	// PollOrder reports the state of a placed order
+	PollOrder(ref string, order BrokerOrderRequest) (BrokerOrderUpdate, error)
+}
+
+// SimulatedBroker fills every order at the current price during a trading
+// session, once a delay has passed since placement (or since the next session
+// opened, for orders placed while the market was closed). The price is moved
+// against the buyer by a random slippage of up to SlippageBps basis points.
+// Charges are computed with CalculateFees on the fill price.
+type SimulatedBroker struct {
+	priceService *PriceService
+	calendar     *MarketCalendar
+	fillDelay    time.Duration
+	slippageBps  int
+}
+
+// NewSimulatedBroker creates a simulated broker
+func NewSimulatedBroker(priceService *PriceService, calendar *MarketCalendar, fillDelay time.Duration, slippageBps int) *SimulatedBroker {
+	return &SimulatedBroker{
+		priceService: priceService,
+		calendar:     calendar,
+		fillDelay:    fillDelay,
+		slippageBps:  slippageBps,
+	}
+}
+
+// PlaceOrder accepts the order; the simulation keeps no state
+func (b *SimulatedBroker) PlaceOrder(order BrokerOrderRequest) (string, error) {
+	return fmt.Sprintf("SIM-%d", order.OrderID), nil
+}
+
+// PollOrder fills the order once it is due
+func (b *SimulatedBroker) PollOrder(ref string, order BrokerOrderRequest) (BrokerOrderUpdate, error) {
+	if !b.fillDue(order.PlacedAt, utils.NowUTC()) {
+		return BrokerOrderUpdate{}, nil
+	}
+
+	quote, err := b.priceService.GetCurrentQuote(order.Symbol)
+	if err != nil {
+		return BrokerOrderUpdate{}, fmt.Errorf("failed to get stock price: %w", err)
+	}
+
+	slippage := decimal.Zero
+	if b.slippageBps > 0 {
+		slippage = decimal.NewFromInt(int64(rand.Intn(b.slippageBps + 1))).Div(decimal.NewFromInt(10000))
+	}
+	fill := BrokerFill{
+		Price:    quote.Price.Mul(decimal.NewFromInt(1).Add(slippage)).Round(4),
+		Currency: quote.Currency,
+		FxRate:   quote.FxRate,
+		FilledAt: utils.NowUTC(),
+	}
+	fill.BrokerageINR, fill.STTINR, fill.GSTINR, _ = utils.CalculateFees(fill.PriceINR(), order.Quantity)
+
+	return BrokerOrderUpdate{Fill: &fill}, nil
+}
+
+// fillDue reports whether an order placed at placedAt can fill at now: the
+// market is open and the delay has run from placement, or from the next
+// session open when placed outside a session
+func (b *SimulatedBroker) fillDue(placedAt, now time.Time) bool {
+	if !b.calendar.IsMarketOpen(now) {
+		return false
+	}
+	start := placedAt
+	if !b.calendar.IsMarketOpen(placedAt) {
+		start = b.calendar.NextSessionOpen(placedAt)
+	}
+	return !now.Before(start.Add(b.fillDelay))
+}
@@ -0,0 +1,625 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reward fulfilment modes
+const (
+	// FulfillTreasury draws rewards from treasury inventory lots
+	FulfillTreasury = "treasury"
+	// FulfillBroker buys each reward's shares through the broker
+	FulfillBroker = "broker"
+)
+
+// maxOrderRejections is how many rejected orders a reward is re-queued after
+// before it is held for manual follow-up
+const maxOrderRejections = 3
+
+// BrokerConfig controls how rewards are fulfilled and the simulated broker
+type BrokerConfig struct {
+	// Fulfillment is FulfillTreasury or FulfillBroker
+	Fulfillment string
+	// FillDelay is how long simulated orders take to fill
+	FillDelay time.Duration
+	// SlippageBps is the largest adverse slippage of a simulated fill
+	SlippageBps int
+	// NettingWindow batches rewards per symbol into one order every window; zero orders each reward
+	NettingWindow time.Duration
+}
+
+// LoadBrokerConfig reads REWARD_FULFILLMENT and BROKER_* environment variables
+func LoadBrokerConfig() BrokerConfig {
+	mode := strings.ToLower(os.Getenv("REWARD_FULFILLMENT"))
+	switch mode {
+	case FulfillTreasury, FulfillBroker:
+	case "":
+		mode = FulfillTreasury
+	default:
+		logrus.Warnf("Invalid REWARD_FULFILLMENT %q, using %s", mode, FulfillTreasury)
+		mode = FulfillTreasury
+	}
+	return BrokerConfig{
+		Fulfillment:   mode,
+		FillDelay:     utils.NonNegativeDurationFromEnv("BROKER_FILL_DELAY", 30*time.Second),
+		SlippageBps:   utils.NonNegativeIntFromEnv("BROKER_SLIPPAGE_BPS", 10),
+		NettingWindow: utils.NonNegativeDurationFromEnv("BROKER_NETTING_WINDOW", 15*time.Minute),
+	}
+}
+
+// ErrBrokerOrderNotFound is returned when a broker order does not exist
+var ErrBrokerOrderNotFound = errors.New("broker order not found")
+
+// BrokerService places buy orders for rewards and books their fills
+type BrokerService struct {
+	priceService *PriceService
+	broker       Broker
+	calendar     *MarketCalendar
+	config       BrokerConfig
+}
+
+// NewBrokerService creates a new broker service
+func NewBrokerService(priceService *PriceService, broker Broker, calendar *MarketCalendar, config BrokerConfig) *BrokerService {
+	return &BrokerService{
+		priceService: priceService,
+		broker:       broker,
+		calendar:     calendar,
+		config:       config,
+	}
+}
+
+// PlacesRewardOrders reports whether rewards are bought through the broker
+func (s *BrokerService) PlacesRewardOrders() bool {
+	return s.config.Fulfillment == FulfillBroker
+}
+
+// NettingWindow returns how often pending rewards are batched into orders;
+// zero means each reward is ordered on its own
+func (s *BrokerService) NettingWindow() time.Duration {
+	return s.config.NettingWindow
+}
+
+// orderRewardInTx records a reward's buy. With netting the reward waits as a
+// pending allocation for the next batch and no order is returned; otherwise
+// it gets its own order, sent once the transaction commits.
+func (s *BrokerService) orderRewardInTx(tx *gorm.DB, reward *models.RewardEvent, quote Quote) (*models.BrokerOrder, error) {
+	allocation := models.BrokerOrderAllocation{
+		RewardEventID: reward.ID,
+		StockSymbol:   reward.StockSymbol,
+		Quantity:      reward.Quantity,
+	}
+
+	var order *models.BrokerOrder
+	if s.config.NettingWindow == 0 {
+		var err error
+		if order, err = createOrderInTx(tx, reward.StockSymbol, reward.Quantity, quote); err != nil {
+			return nil, err
+		}
+		allocation.OrderID = &order.ID
+	}
+
+	if err := tx.Create(&allocation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create order allocation: %w", err)
+	}
+	return order, nil
+}
+
+// createOrderInTx records a new buy order with its estimated price and charges
+func createOrderInTx(tx *gorm.DB, symbol string, quantity decimal.Decimal, quote Quote) (*models.BrokerOrder, error) {
+	_, _, _, fees := utils.CalculateFees(quote.PriceINR, quantity)
+	order := models.BrokerOrder{
+		StockSymbol:       symbol,
+		Quantity:          quantity,
+		Status:            models.BrokerOrderNew,
+		Currency:          quote.Currency,
+		EstimatedPrice:    quote.Price,
+		EstimatedPriceINR: quote.PriceINR,
+		EstimatedFeesINR:  fees,
+		PlacedAt:          utils.NowUTC(),
+	}
+	if err := tx.Create(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to create broker order: %w", err)
+	}
+	return &order, nil
+}
+
+// NetPendingRewards batches each symbol's pending rewards into one order and
+// sends it. Allocations of rewards cancelled while pending are dropped.
+func (s *BrokerService) NetPendingRewards() error {
+	var symbols []string
+	err := db.DB.Model(&models.BrokerOrderAllocation{}).
+		Distinct("stock_symbol").
+		Where("order_id IS NULL").
+		Order("stock_symbol").
+		Pluck("stock_symbol", &symbols).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch pending symbols: %w", err)
+	}
+
+	var failed int
+	for _, symbol := range symbols {
+		order, err := s.netSymbol(symbol)
+		if err != nil {
+			logrus.WithError(err).WithField("symbol", symbol).Error("Failed to batch pending rewards")
+			failed++
+			continue
+		}
+		if order == nil {
+			continue
+		}
+		if err := s.SubmitOrder(order); err != nil {
+			logrus.WithError(err).WithField("orderId", order.ID).Warn("Failed to submit broker order")
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to batch %d of %d symbols", failed, len(symbols))
+	}
+	return nil
+}
+
+// netSymbol creates one order for a symbol's pending allocations and links them to it
+func (s *BrokerService) netSymbol(symbol string) (*models.BrokerOrder, error) {
+	quote, err := s.priceService.GetCurrentQuote(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock price: %w", err)
+	}
+
+	var order *models.BrokerOrder
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Rewards cancelled before batching need no shares
+		err := tx.Where("order_id IS NULL AND stock_symbol = ? AND reward_event_id IN (?)", symbol,
+			tx.Unscoped().Model(&models.RewardEvent{}).Select("id").Where("deleted_at IS NOT NULL"),
+		).Delete(&models.BrokerOrderAllocation{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to drop cancelled allocations: %w", err)
+		}
+
+		var pending []models.BrokerOrderAllocation
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id IS NULL AND stock_symbol = ?", symbol).
+			Find(&pending).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock pending allocations: %w", err)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		total := decimal.Zero
+		ids := make([]uint, len(pending))
+		for i, allocation := range pending {
+			total = total.Add(allocation.Quantity)
+			ids[i] = allocation.ID
+		}
+
+		if order, err = createOrderInTx(tx, symbol, total, quote); err != nil {
+			return err
+		}
+		return tx.Model(&models.BrokerOrderAllocation{}).Where("id IN ?", ids).Update("order_id", order.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if order != nil {
+		logrus.WithFields(logrus.Fields{
+			"orderId":  order.ID,
+			"symbol":   symbol,
+			"quantity": order.Quantity,
+		}).Info("Pending rewards netted into broker order")
+	}
+	return order, nil
+}
+
+// SubmitOrder sends a new order to the broker and marks it placed. A failed
+// submission leaves the order NEW for the sync job to retry.
+func (s *BrokerService) SubmitOrder(order *models.BrokerOrder) error {
+	ref, err := s.broker.PlaceOrder(brokerOrderRequest(order))
+	if err != nil {
+		return fmt.Errorf("failed to place order: %w", err)
+	}
+
+	result := db.DB.Model(&models.BrokerOrder{}).
+		Where("id = ? AND status = ?", order.ID, models.BrokerOrderNew).
+		Updates(map[string]interface{}{
+			"status":     models.BrokerOrderPlaced,
+			"broker_ref": ref,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark order placed: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		order.Status = models.BrokerOrderPlaced
+		order.BrokerRef = ref
+	}
+	return nil
+}
+
+// brokerOrderRequest converts an order to the broker's request
+func brokerOrderRequest(order *models.BrokerOrder) BrokerOrderRequest {
+	return BrokerOrderRequest{
+		OrderID:  order.ID,
+		Symbol:   order.StockSymbol,
+		Quantity: order.Quantity,
+		PlacedAt: order.PlacedAt,
+	}
+}
+
+// SyncOrders submits new orders and books the fills of placed ones
+func (s *BrokerService) SyncOrders() error {
+	var orders []models.BrokerOrder
+	err := db.DB.Where("status IN ?", []models.BrokerOrderStatus{models.BrokerOrderNew, models.BrokerOrderPlaced}).
+		Order("id").
+		Find(&orders).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch open orders: %w", err)
+	}
+
+	var failed int
+	for i := range orders {
+		if err := s.sync(&orders[i]); err != nil {
+			logrus.WithError(err).WithField("orderId", orders[i].ID).Error("Failed to sync broker order")
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d of %d broker orders", failed, len(orders))
+	}
+	return nil
+}
+
+// sync moves one open order on as far as the broker allows
+func (s *BrokerService) sync(order *models.BrokerOrder) error {
+	if order.Status == models.BrokerOrderNew {
+		return s.SubmitOrder(order)
+	}
+
+	update, err := s.broker.PollOrder(order.BrokerRef, brokerOrderRequest(order))
+	if err != nil {
+		return fmt.Errorf("failed to poll order: %w", err)
+	}
+
+	switch {
+	case update.Fill != nil:
+		return s.applyFill(order.ID, *update.Fill)
+	case update.Rejected:
+		return s.reject(order.ID, update.Reason)
+	}
+	return nil
+}
+
+// splitINR splits an INR amount over weights pro rata, rounding each share
+// with RoundINR; the last share takes the rounding so the shares sum to total
+func splitINR(total decimal.Decimal, weights []decimal.Decimal) []decimal.Decimal {
+	shares := make([]decimal.Decimal, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	sum := decimal.Zero
+	for _, weight := range weights {
+		sum = sum.Add(weight)
+	}
+
+	left := total
+	for i, weight := range weights[:len(weights)-1] {
+		if sum.IsPositive() {
+			shares[i] = utils.RoundINR(total.Mul(weight).Div(sum))
+		}
+		left = left.Sub(shares[i])
+	}
+	shares[len(shares)-1] = left
+	return shares
+}
+
+// applyFill records an order's fill and books, for each reward it bought,
+// CASH and FEE adjustments that bring the reward's estimated company cost to
+// its share of the actual cost. Each reward pays the fill price; the order's
+// charges are split pro rata by quantity, the last reward taking the rounding.
+// The rewards' shares settle T+1 from the fill's trade date.
+func (s *BrokerService) applyFill(orderID uint, fill BrokerFill) error {
+	priceINR := fill.PriceINR()
+	fees := fill.FeesINR()
+	settlementDate := s.calendar.SettlementDate(fill.FilledAt)
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.BrokerOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return fmt.Errorf("failed to lock order: %w", err)
+		}
+		if order.Status != models.BrokerOrderPlaced {
+			return nil
+		}
+
+		var allocations []models.BrokerOrderAllocation
+		if err := tx.Where("order_id = ?", orderID).Order("id").Find(&allocations).Error; err != nil {
+			return fmt.Errorf("failed to fetch order allocations: %w", err)
+		}
+
+		quantities := make([]decimal.Decimal, len(allocations))
+		for i, allocation := range allocations {
+			quantities[i] = allocation.Quantity
+		}
+		allocFees := splitINR(fees, quantities)
+
+		var entries []models.LedgerEntry
+		for i, allocation := range allocations {
+			adjustments, err := fillAdjustmentEntries(tx, &order, allocation, fill, priceINR, allocFees[i])
+			if err != nil {
+				return err
+			}
+			entries = append(entries, adjustments...)
+
+			err = tx.Model(&allocation).Updates(map[string]interface{}{
+				"cost_inr": utils.RoundINR(priceINR.Mul(allocation.Quantity)),
+				"fees_inr": allocFees[i],
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to record allocation fill: %w", err)
+			}
+		}
+
+		if len(entries) > 0 {
+			if err := tx.Create(&entries).Error; err != nil {
+				return fmt.Errorf("failed to create fill adjustments: %w", err)
+			}
+		}
+
+		rewardIDs := make([]uint, len(allocations))
+		for i, allocation := range allocations {
+			rewardIDs[i] = allocation.RewardEventID
+		}
+		if err := setSettlementDateInTx(tx, rewardIDs, settlementDate); err != nil {
+			return err
+		}
+
+		filledAt := fill.FilledAt
+		return tx.Model(&order).Updates(map[string]interface{}{
+			"status":         models.BrokerOrderFilled,
+			"fill_price":     fill.Price,
+			"fill_fx_rate":   fill.FxRate,
+			"fill_price_inr": priceINR,
+			"brokerage_inr":  fill.BrokerageINR,
+			"stt_inr":        fill.STTINR,
+			"gst_inr":        fill.GSTINR,
+			"fees_inr":       fees,
+			"filled_at":      &filledAt,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"orderId":  orderID,
+		"price":    fill.Price,
+		"priceInr": priceINR,
+		"feesInr":  fees,
+	}).Info("Broker order filled")
+
+	return nil
+}
+
+// setSettlementDateInTx dates the settlement of rewards whose shares were
+// awaiting a fill, along with their STOCK entries
+func setSettlementDateInTx(tx *gorm.DB, rewardIDs []uint, settlementDate string) error {
+	err := tx.Model(&models.RewardEvent{}).
+		Where("id IN ? AND settlement_status = ? AND settlement_date = ''", rewardIDs, models.SettlementUnsettled).
+		Update("settlement_date", settlementDate).Error
+	if err != nil {
+		return fmt.Errorf("failed to date reward settlement: %w", err)
+	}
+	err = tx.Model(&models.LedgerEntry{}).
+		Where("reward_event_id IN ? AND entry_type = ? AND settlement_status = ? AND settlement_date = ''",
+			rewardIDs, models.EntryTypeStock, models.SettlementUnsettled).
+		Update("settlement_date", settlementDate).Error
+	if err != nil {
+		return fmt.Errorf("failed to date entry settlement: %w", err)
+	}
+	return nil
+}
+
+// fillAdjustmentEntries returns the company CASH and FEE entries that move a
+// reward's booked cost (estimate plus any earlier adjustments) to its actual cost
+func fillAdjustmentEntries(tx *gorm.DB, order *models.BrokerOrder, allocation models.BrokerOrderAllocation, fill BrokerFill, priceINR, feesINR decimal.Decimal) ([]models.LedgerEntry, error) {
+	var reward models.RewardEvent
+	err := tx.Where("id = ?", allocation.RewardEventID).First(&reward).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Cancelled rewards keep their reversed estimate; the shares stay with the
+		// company and the holding reconciliation expects them as retained
+		logrus.WithField("rewardId", allocation.RewardEventID).Warn("Reward cancelled before fill, no adjustment booked")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reward: %w", err)
+	}
+
+	var booked []struct {
+		EntryType      models.EntryType
+		AmountINR      decimal.Decimal
+		AmountOriginal decimal.Decimal
+	}
+	err = tx.Model(&models.LedgerEntry{}).
+		Select("entry_type, SUM(amount_inr) AS amount_inr, SUM(amount_original) AS amount_original").
+		Where("reward_event_id = ? AND account = ? AND entry_type IN ?", reward.ID, models.AccountCompany,
+			[]models.EntryType{models.EntryTypeCash, models.EntryTypeFee}).
+		Group("entry_type").
+		Scan(&booked).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch booked cost: %w", err)
+	}
+	bookedINR := map[models.EntryType]decimal.Decimal{}
+	bookedOriginal := map[models.EntryType]decimal.Decimal{}
+	for _, b := range booked {
+		bookedINR[b.EntryType] = b.AmountINR
+		bookedOriginal[b.EntryType] = b.AmountOriginal
+	}
+
+	rewardID := reward.ID
+	symbol := reward.StockSymbol
+	entry := func(entryType models.EntryType) models.LedgerEntry {
+		return models.LedgerEntry{
+			UserID:        reward.UserID,
+			RewardEventID: &rewardID,
+			ReferenceType: models.ReferenceBrokerOrder,
+			ReferenceID:   order.ID,
+			Account:       models.AccountCompany,
+			EntryType:     entryType,
+			StockSymbol:   &symbol,
+			Quantity:      decimal.Zero,
+			Currency:      models.BaseCurrency,
+			FxRate:        decimal.NewFromInt(1),
+			Timestamp:     fill.FilledAt,
+		}
+	}
+
+	var entries []models.LedgerEntry
+
+	// CASH: company outflow at the fill price
+	actualINR := utils.RoundINR(priceINR.Mul(allocation.Quantity)).Neg()
+	actualOriginal := utils.RoundINR(fill.Price.Mul(allocation.Quantity)).Neg()
+	if delta := actualINR.Sub(bookedINR[models.EntryTypeCash]); !delta.IsZero() {
+		cash := entry(models.EntryTypeCash)
+		cash.AmountINR = delta
+		cash.Currency = fill.Currency
+		cash.AmountOriginal = actualOriginal.Sub(bookedOriginal[models.EntryTypeCash])
+		cash.FxRate = fill.FxRate
+		entries = append(entries, cash)
+	}
+
+	// FEE: company outflow for the actual charges
+	if delta := feesINR.Neg().Sub(bookedINR[models.EntryTypeFee]); !delta.IsZero() {
+		fee := entry(models.EntryTypeFee)
+		fee.AmountINR = delta
+		fee.AmountOriginal = delta
+		entries = append(entries, fee)
+	}
+
+	return entries, nil
+}
+
+// reject marks a placed order rejected and re-queues its rewards as pending
+// allocations for the next order; without netting they are re-ordered at
+// once. A reward rejected maxOrderRejections times stays on the rejected order
+// for manual follow-up.
+func (s *BrokerService) reject(orderID uint, reason string) error {
+	reason = utils.TruncateString(reason, 255)
+
+	var order models.BrokerOrder
+	var requeued, held int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch order: %w", err)
+		}
+		if order.Status != models.BrokerOrderPlaced {
+			return nil
+		}
+
+		err = tx.Model(&order).Updates(map[string]interface{}{
+			"status":         models.BrokerOrderRejected,
+			"failure_reason": reason,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to mark order rejected: %w", err)
+		}
+
+		err = tx.Model(&models.BrokerOrderAllocation{}).
+			Where("order_id = ?", orderID).
+			Update("rejections", gorm.Expr("rejections + 1")).Error
+		if err != nil {
+			return fmt.Errorf("failed to count rejection: %w", err)
+		}
+
+		result := tx.Model(&models.BrokerOrderAllocation{}).
+			Where("order_id = ? AND rejections < ?", orderID, maxOrderRejections).
+			Update("order_id", nil)
+		if result.Error != nil {
+			return fmt.Errorf("failed to re-queue allocations: %w", result.Error)
+		}
+		requeued = result.RowsAffected
+
+		return tx.Model(&models.BrokerOrderAllocation{}).Where("order_id = ?", orderID).Count(&held).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	fields := logrus.Fields{
+		"orderId":  orderID,
+		"reason":   reason,
+		"requeued": requeued,
+		"held":     held,
+	}
+	if held > 0 {
+		logrus.WithFields(fields).Error("Broker rejected order, rewards held for manual follow-up")
+	} else {
+		logrus.WithFields(fields).Warn("Broker rejected order, rewards re-queued")
+	}
+
+	if requeued > 0 && s.config.NettingWindow == 0 {
+		if _, err := s.netSymbol(order.StockSymbol); err != nil {
+			return fmt.Errorf("failed to re-order rejected rewards: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListOrders returns broker orders, newest first, optionally filtered by status
+func (s *BrokerService) ListOrders(status string) ([]models.BrokerOrder, error) {
+	query := db.DB.Order("placed_at DESC").Limit(500)
+	if status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+
+	var orders []models.BrokerOrder
+	if err := query.Find(&orders).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch broker orders: %w", err)
+	}
+	return orders, nil
+}
+
+// BrokerOrderDetail is an order with its per-reward allocations and the ledger
+// entries booked against it
+type BrokerOrderDetail struct {
+	Order         models.BrokerOrder             `json:"order"`
+	Allocations   []models.BrokerOrderAllocation `json:"allocations"`
+	LedgerEntries []models.LedgerEntry           `json:"ledgerEntries"`
+}
+
+// GetOrder returns an order with its allocations and ledger entries
+func (s *BrokerService) GetOrder(orderID uint) (*BrokerOrderDetail, error) {
+	var detail BrokerOrderDetail
+	err := db.DB.First(&detail.Order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBrokerOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch broker order: %w", err)
+	}
+
+	if err := db.DB.Where("order_id = ?", orderID).Order("id").Find(&detail.Allocations).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch order allocations: %w", err)
+	}
+	err = db.DB.Where("reference_type = ? AND reference_id = ?", models.ReferenceBrokerOrder, orderID).
+		Order("id").
+		Find(&detail.LedgerEntries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch order ledger entries: %w", err)
+	}
+	return &detail, nil
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// stubBroker accepts every order and reports a fixed update when polled
+type stubBroker struct {
+	placed []BrokerOrderRequest
+	update BrokerOrderUpdate
+}
+
+func (b *stubBroker) PlaceOrder(order BrokerOrderRequest) (string, error) {
+	b.placed = append(b.placed, order)
+	return "STUB", nil
+}
+
+func (b *stubBroker) PollOrder(ref string, order BrokerOrderRequest) (BrokerOrderUpdate, error) {
+	return b.update, nil
+}
+
+func decimals(values ...string) []decimal.Decimal {
+	out := make([]decimal.Decimal, len(values))
+	for i, value := range values {
+		out[i] = decimal.RequireFromString(value)
+	}
+	return out
+}
+
+func TestSplitINR(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   string
+		weights []decimal.Decimal
+		want    []decimal.Decimal
+	}{
+		{"single", "25.37", decimals("3"), decimals("25.37")},
+		{"even", "30", decimals("1", "2"), decimals("10", "20")},
+		{"last takes rounding", "10", decimals("1", "1", "1"), decimals("3.3333", "3.3333", "3.3334")},
+		{"fractional weights", "1.00", decimals("0.5", "0.25", "0.25"), decimals("0.5", "0.25", "0.25")},
+		{"zero weights", "5", decimals("0", "0"), decimals("0", "5")},
+		{"negative total", "-7", decimals("1", "2"), decimals("-2.3333", "-4.6667")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total := decimal.RequireFromString(tt.total)
+			got := splitINR(total, tt.weights)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d shares, want %d", len(got), len(tt.want))
+			}
+			sum := decimal.Zero
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("share %d = %s, want %s", i, got[i], tt.want[i])
+				}
+				sum = sum.Add(got[i])
+			}
+			if !sum.Equal(total) {
+				t.Errorf("shares sum to %s, want %s", sum, total)
+			}
+		})
+	}
+}
+
+func TestNetPendingRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	calendar := NewMarketCalendar()
+	broker := &stubBroker{}
+	service := NewBrokerService(NewPriceService(calendar), broker, calendar, BrokerConfig{Fulfillment: FulfillBroker, NettingWindow: time.Minute})
+
+	now := utils.NowUTC()
+	var allocations []models.BrokerOrderAllocation
+	for i, quantity := range []string{"1.5", "2", "4"} {
+		reward := models.RewardEvent{
+			UserID:      fixtureUserID + i,
+			StockSymbol: "INFY",
+			Quantity:    decimal.RequireFromString(quantity),
+			Status:      models.RewardStatusIssued,
+			Timestamp:   now,
+		}
+		mustCreate(t, &reward)
+		allocation := models.BrokerOrderAllocation{RewardEventID: reward.ID, StockSymbol: "INFY", Quantity: reward.Quantity}
+		mustCreate(t, &allocation)
+		allocations = append(allocations, allocation)
+
+		// The last reward is cancelled before the batch runs
+		if i == 2 {
+			if err := db.DB.Delete(&reward).Error; err != nil {
+				t.Fatalf("failed to cancel reward: %v", err)
+			}
+		}
+	}
+
+	if err := service.NetPendingRewards(); err != nil {
+		t.Fatalf("NetPendingRewards: %v", err)
+	}
+
+	if len(broker.placed) != 1 {
+		t.Fatalf("placed %d orders, want 1", len(broker.placed))
+	}
+	if want := decimal.RequireFromString("3.5"); !broker.placed[0].Quantity.Equal(want) {
+		t.Errorf("order quantity = %s, want %s", broker.placed[0].Quantity, want)
+	}
+
+	var order models.BrokerOrder
+	if err := db.DB.First(&order, broker.placed[0].OrderID).Error; err != nil {
+		t.Fatalf("failed to reload order: %v", err)
+	}
+	if order.Status != models.BrokerOrderPlaced {
+		t.Errorf("order status = %s, want %s", order.Status, models.BrokerOrderPlaced)
+	}
+
+	for i, allocation := range allocations {
+		var stored models.BrokerOrderAllocation
+		err := db.DB.Where("id = ?", allocation.ID).Limit(1).Find(&stored).Error
+		if err != nil {
+			t.Fatalf("failed to reload allocation: %v", err)
+		}
+		if i == 2 {
+			if stored.ID != 0 {
+				t.Errorf("cancelled reward's allocation was kept")
+			}
+			continue
+		}
+		if stored.OrderID == nil || *stored.OrderID != order.ID {
+			t.Errorf("allocation %d not linked to order %d", i, order.ID)
+		}
+	}
+
+	// A second run has nothing left to batch
+	if err := service.NetPendingRewards(); err != nil {
+		t.Fatalf("NetPendingRewards: %v", err)
+	}
+	if len(broker.placed) != 1 {
+		t.Errorf("second run placed %d orders, want none", len(broker.placed)-1)
+	}
+}
+
+func TestSyncOrdersBooksFill(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	now := utils.NowUTC()
+	order := models.BrokerOrder{
+		StockSymbol:       "INFY",
+		Quantity:          decimal.NewFromInt(3),
+		Status:            models.BrokerOrderPlaced,
+		BrokerRef:         "STUB",
+		Currency:          "INR",
+		EstimatedPrice:    decimal.NewFromInt(1500),
+		EstimatedPriceINR: decimal.NewFromInt(1500),
+		EstimatedFeesINR:  decimal.RequireFromString("6"),
+		PlacedAt:          now,
+	}
+	mustCreate(t, &order)
+
+	// Two rewards booked at the estimate: 1 and 2 shares
+	var rewards []models.RewardEvent
+	for i, quantity := range []int64{1, 2} {
+		reward := models.RewardEvent{
+			UserID:           fixtureUserID + i,
+			StockSymbol:      "INFY",
+			Quantity:         decimal.NewFromInt(quantity),
+			Status:           models.RewardStatusIssued,
+			SettlementStatus: models.SettlementUnsettled,
+			Timestamp:        now,
+		}
+		mustCreate(t, &reward)
+		rewards = append(rewards, reward)
+		mustCreate(t, &models.BrokerOrderAllocation{OrderID: &order.ID, RewardEventID: reward.ID, StockSymbol: "INFY", Quantity: reward.Quantity})
+
+		symbol := "INFY"
+		for _, entry := range []models.LedgerEntry{
+			{Account: models.AccountUser, EntryType: models.EntryTypeStock, Quantity: reward.Quantity, AmountINR: decimal.NewFromInt(1500 * quantity), SettlementStatus: models.SettlementUnsettled},
+			{Account: models.AccountCompany, EntryType: models.EntryTypeCash, AmountINR: decimal.NewFromInt(-1500 * quantity)},
+			{Account: models.AccountCompany, EntryType: models.EntryTypeFee, AmountINR: decimal.NewFromInt(-2 * quantity)},
+		} {
+			entry.UserID = reward.UserID
+			entry.RewardEventID = &reward.ID
+			entry.ReferenceType = models.ReferenceReward
+			entry.ReferenceID = reward.ID
+			entry.StockSymbol = &symbol
+			entry.AmountOriginal = entry.AmountINR
+			entry.Timestamp = now
+			mustCreate(t, &entry)
+		}
+	}
+
+	broker := &stubBroker{update: BrokerOrderUpdate{Fill: &BrokerFill{
+		Price:        decimal.NewFromInt(1510),
+		Currency:     "INR",
+		FxRate:       decimal.NewFromInt(1),
+		BrokerageINR: decimal.RequireFromString("1.359"),
+		STTINR:       decimal.RequireFromString("4.53"),
+		GSTINR:       decimal.RequireFromString("0.2446"),
+		FilledAt:     now,
+	}}}
+	calendar := NewMarketCalendar()
+	service := NewBrokerService(NewPriceService(calendar), broker, calendar, BrokerConfig{Fulfillment: FulfillBroker})
+
+	if err := service.SyncOrders(); err != nil {
+		t.Fatalf("SyncOrders: %v", err)
+	}
+
+	if err := db.DB.First(&order, order.ID).Error; err != nil {
+		t.Fatalf("failed to reload order: %v", err)
+	}
+	if order.Status != models.BrokerOrderFilled || order.FilledAt == nil {
+		t.Fatalf("order status = %s, want %s", order.Status, models.BrokerOrderFilled)
+	}
+	if want := decimal.RequireFromString("6.1336"); !order.FeesINR.Decimal.Equal(want) {
+		t.Errorf("order fees = %s, want %s", order.FeesINR.Decimal, want)
+	}
+
+	// Each reward's company cost now matches its share of the fill
+	wantCash := decimals("-1510", "-3020")
+	wantFees := decimals("-2.0445", "-4.0891")
+	for i, reward := range rewards {
+		var booked []struct {
+			EntryType models.EntryType
+			AmountINR decimal.Decimal
+		}
+		err := db.DB.Model(&models.LedgerEntry{}).
+			Select("entry_type, SUM(amount_inr) AS amount_inr").
+			Where("reward_event_id = ? AND account = ?", reward.ID, models.AccountCompany).
+			Group("entry_type").
+			Scan(&booked).Error
+		if err != nil {
+			t.Fatalf("failed to fetch booked cost: %v", err)
+		}
+		for _, b := range booked {
+			want := wantCash[i]
+			if b.EntryType == models.EntryTypeFee {
+				want = wantFees[i]
+			}
+			if !b.AmountINR.Equal(want) {
+				t.Errorf("reward %d %s = %s, want %s", i, b.EntryType, b.AmountINR, want)
+			}
+		}
+	}
+
+	// The rewards' shares settle T+1 from the fill
+	wantSettlement := calendar.SettlementDate(now)
+	for i, reward := range rewards {
+		if err := db.DB.First(&reward, reward.ID).Error; err != nil {
+			t.Fatalf("failed to reload reward: %v", err)
+		}
+		if reward.SettlementDate != wantSettlement {
+			t.Errorf("reward %d settlement date = %q, want %q", i, reward.SettlementDate, wantSettlement)
+		}
+		var stock models.LedgerEntry
+		err := db.DB.Where("reward_event_id = ? AND entry_type = ?", reward.ID, models.EntryTypeStock).First(&stock).Error
+		if err != nil {
+			t.Fatalf("failed to fetch stock entry: %v", err)
+		}
+		if stock.SettlementDate != wantSettlement {
+			t.Errorf("reward %d stock entry settlement date = %q, want %q", i, stock.SettlementDate, wantSettlement)
+		}
+	}
+
+	// A filled order is not polled again
+	if err := service.SyncOrders(); err != nil {
+		t.Fatalf("SyncOrders: %v", err)
+	}
+}
+
+func TestRejectRequeuesRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "REJTEST"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(500),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(500),
+		Timestamp:   now,
+	})
+	order := models.BrokerOrder{
+		StockSymbol:       symbol,
+		Quantity:          decimal.NewFromInt(2),
+		Status:            models.BrokerOrderPlaced,
+		BrokerRef:         "STUB",
+		Currency:          "INR",
+		EstimatedPrice:    decimal.NewFromInt(500),
+		EstimatedPriceINR: decimal.NewFromInt(500),
+		PlacedAt:          now,
+	}
+	mustCreate(t, &order)
+	reward := models.RewardEvent{
+		UserID:           fixtureUserID,
+		StockSymbol:      symbol,
+		Quantity:         decimal.NewFromInt(2),
+		Status:           models.RewardStatusIssued,
+		SettlementStatus: models.SettlementUnsettled,
+		Timestamp:        now,
+	}
+	mustCreate(t, &reward)
+	mustCreate(t, &models.BrokerOrderAllocation{OrderID: &order.ID, RewardEventID: reward.ID, StockSymbol: symbol, Quantity: reward.Quantity})
+
+	calendar := NewMarketCalendar()
+	service := NewBrokerService(NewPriceService(calendar), &stubBroker{}, calendar, BrokerConfig{Fulfillment: FulfillBroker})
+
+	// Without netting each rejection re-orders the reward at once, until it
+	// has been rejected maxOrderRejections times
+	orderID := order.ID
+	for attempt := 1; attempt <= maxOrderRejections; attempt++ {
+		if err := service.reject(orderID, "insufficient funds"); err != nil {
+			t.Fatalf("reject: %v", err)
+		}
+		var rejected models.BrokerOrder
+		if err := db.DB.First(&rejected, orderID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if rejected.Status != models.BrokerOrderRejected || rejected.FailureReason != "insufficient funds" {
+			t.Errorf("order %d = %s (%q), want REJECTED", orderID, rejected.Status, rejected.FailureReason)
+		}
+
+		var allocation models.BrokerOrderAllocation
+		if err := db.DB.Where("reward_event_id = ?", reward.ID).First(&allocation).Error; err != nil {
+			t.Fatal(err)
+		}
+		if allocation.Rejections != attempt {
+			t.Errorf("rejections = %d, want %d", allocation.Rejections, attempt)
+		}
+		if attempt == maxOrderRejections {
+			if allocation.OrderID == nil || *allocation.OrderID != orderID {
+				t.Errorf("allocation order = %v, want it held on rejected order %d", allocation.OrderID, orderID)
+			}
+			break
+		}
+
+		if allocation.OrderID == nil || *allocation.OrderID == orderID {
+			t.Fatalf("allocation order = %v, want a new order", allocation.OrderID)
+		}
+		var next models.BrokerOrder
+		if err := db.DB.First(&next, *allocation.OrderID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if next.Status != models.BrokerOrderNew || !next.Quantity.Equal(reward.Quantity) {
+			t.Fatalf("next order = %s for %s shares, want NEW for %s", next.Status, next.Quantity, reward.Quantity)
+		}
+		if err := service.SubmitOrder(&next); err != nil {
+			t.Fatalf("SubmitOrder: %v", err)
+		}
+		orderID = next.ID
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"stocky-backend/utils"
+	"testing"
+	"time"
+)
+
+func TestSimulatedBrokerFillDue(t *testing.T) {
+	broker := NewSimulatedBroker(nil, NewMarketCalendar(), 30*time.Second, 10)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04:05", value, utils.ISTLocation())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	// 2024-05-03 is a Friday
+	tests := []struct {
+		name     string
+		placedAt string
+		now      string
+		want     bool
+	}{
+		{"within the delay", "2024-05-03 10:00:00", "2024-05-03 10:00:10", false},
+		{"after the delay", "2024-05-03 10:00:00", "2024-05-03 10:01:00", true},
+		{"market closed since", "2024-05-03 10:00:00", "2024-05-03 16:00:00", false},
+		{"delay runs past the close", "2024-05-03 15:29:50", "2024-05-03 15:30:10", false},
+		{"placed after the close, weekend", "2024-05-03 18:00:00", "2024-05-04 11:00:00", false},
+		{"placed after the close, delay from the open", "2024-05-03 18:00:00", "2024-05-06 09:15:10", false},
+		{"placed after the close, next session", "2024-05-03 18:00:00", "2024-05-06 09:16:00", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := broker.fillDue(at(tt.placedAt), at(tt.now)); got != tt.want {
+				t.Errorf("fillDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
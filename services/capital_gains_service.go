@@ -0,0 +1,344 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Capital gain classes
+const (
+	GainShortTerm = "STCG"
+	GainLongTerm  = "LTCG"
+)
+
+// Holding periods after which a gain is long term: listed Indian equity after
+// 12 months, other (foreign) shares after 24 months
+const (
+	longTermMonthsListed  = 12
+	longTermMonthsForeign = 24
+)
+
+// ErrInvalidFinancialYear is returned for a financial year that cannot be parsed
+var ErrInvalidFinancialYear = errors.New("invalid financial year")
+
+// CapitalGainLine is the part of one sale matched to one acquisition lot
+type CapitalGainLine struct {
+	SaleID        uint            `json:"saleId"`
+	RewardEventID uint            `json:"rewardEventId"`
+	Symbol        string          `json:"symbol"`
+	Currency      string          `json:"currency"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	AcquiredAt    time.Time       `json:"acquiredAt"`
+	SoldAt        time.Time       `json:"soldAt"`
+	HoldingDays   int             `json:"holdingDays"`
+	CostINR       decimal.Decimal `json:"costInr"`
+	ProceedsINR   decimal.Decimal `json:"proceedsInr"`
+	ExpensesINR   decimal.Decimal `json:"expensesInr"`
+	GainINR       decimal.Decimal `json:"gainInr"`
+	Term          string          `json:"term"`
+}
+
+// CapitalGainsSummary totals a statement by class
+type CapitalGainsSummary struct {
+	ProceedsINR decimal.Decimal `json:"proceedsInr"`
+	CostINR     decimal.Decimal `json:"costInr"`
+	ExpensesINR decimal.Decimal `json:"expensesInr"`
+	STCGINR     decimal.Decimal `json:"stcgInr"`
+	LTCGINR     decimal.Decimal `json:"ltcgInr"`
+}
+
+// CapitalGainsStatement lists a user's realised gains for one financial year
+type CapitalGainsStatement struct {
+	UserID        int                 `json:"userId"`
+	FinancialYear string              `json:"financialYear"`
+	From          string              `json:"from"`
+	To            string              `json:"to"`
+	Lines         []CapitalGainLine   `json:"lines"`
+	Summary       CapitalGainsSummary `json:"summary"`
+}
+
+// CapitalGainsService builds capital gains statements from the ledger
+type CapitalGainsService struct {
+	ledgerService *LedgerService
+}
+
+// NewCapitalGainsService creates a new capital gains service
+func NewCapitalGainsService(ledgerService *LedgerService) *CapitalGainsService {
+	return &CapitalGainsService{
+		ledgerService: ledgerService,
+	}
+}
+
+// FinancialYearOf returns the Indian financial year (e.g. "2024-25") containing t
+func FinancialYearOf(t time.Time) string {
+	local := t.In(utils.ISTLocation())
+	start := local.Year()
+	if local.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// ParseFinancialYear parses "2024-25" (or just "2024") into the financial
+// year's bounds: 1 April 00:00 IST inclusive to the next 1 April exclusive
+func ParseFinancialYear(fy string) (string, time.Time, time.Time, error) {
+	parts := strings.SplitN(strings.TrimSpace(fy), "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 2000 || start > 2100 {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("%w: %q, use YYYY-YY", ErrInvalidFinancialYear, fy)
+	}
+	if len(parts) == 2 {
+		end, err := strconv.Atoi(parts[1])
+		if err != nil || end != (start+1)%100 {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("%w: %q, use YYYY-YY", ErrInvalidFinancialYear, fy)
+		}
+	}
+
+	ist := utils.ISTLocation()
+	from := time.Date(start, time.April, 1, 0, 0, 0, 0, ist)
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100), from, from.AddDate(1, 0, 0), nil
+}
+
+// disposal is a STOCK debit not booked by a reward, e.g. a sale
+type disposal struct {
+	ReferenceType models.ReferenceType
+	ReferenceID   uint
+	StockSymbol   string
+	Quantity      decimal.Decimal
+	Timestamp     time.Time
+}
+
+// GetStatement matches every disposal up to the end of the financial year to
+// the user's reward lots, oldest first, and returns the sales that fall in the
+// year. Cost is the lot's reward-time STOCK amount; proceeds and expenses are
+// the sale's gross INR and fees, apportioned by quantity (see matchDisposals).
+func (s *CapitalGainsService) GetStatement(userID int, financialYear string) (*CapitalGainsStatement, error) {
+	label, from, to, err := ParseFinancialYear(financialYear)
+	if err != nil {
+		return nil, err
+	}
+
+	lots, err := s.ledgerService.GetUserAcquiredLots(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var disposals []disposal
+	err = db.DB.Raw(`
+		SELECT reference_type, reference_id, stock_symbol, -quantity AS quantity, timestamp
+		FROM ledger_entries
+		WHERE user_id = ?
+		  AND entry_type = 'STOCK'
+		  AND stock_symbol IS NOT NULL
+		  AND reward_event_id IS NULL
+		  AND quantity < 0
+		  AND timestamp < ?
+		ORDER BY timestamp, id
+	`, userID, to).Scan(&disposals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch disposals: %w", err)
+	}
+
+	var sales []models.Sale
+	err = db.DB.Where("user_id = ? AND timestamp >= ? AND timestamp < ?", userID, from, to).Find(&sales).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sales: %w", err)
+	}
+	salesByID := make(map[uint]models.Sale, len(sales))
+	for _, sale := range sales {
+		salesByID[sale.ID] = sale
+	}
+
+	statement := &CapitalGainsStatement{
+		UserID:        userID,
+		FinancialYear: label,
+		From:          utils.GetDateString(from),
+		To:            utils.GetDateString(to.AddDate(0, 0, -1)),
+		Lines:         []CapitalGainLine{},
+		Summary: CapitalGainsSummary{
+			ProceedsINR: decimal.Zero,
+			CostINR:     decimal.Zero,
+			ExpensesINR: decimal.Zero,
+			STCGINR:     decimal.Zero,
+			LTCGINR:     decimal.Zero,
+		},
+	}
+
+	for _, line := range matchDisposals(userID, lots, disposals, salesByID) {
+		statement.addLine(line)
+	}
+
+	return statement, nil
+}
+
+// lotMatch is the part of a disposal taken from one lot
+type lotMatch struct {
+	lot      Lot
+	quantity decimal.Decimal
+	cost     decimal.Decimal
+}
+
+// matchDisposals takes each disposal from the oldest lots of its symbol
+// acquired by then and returns lines for the sales among them. A lot's cost
+// is apportioned by quantity, the disposal that empties it taking what is
+// left; a sale's proceeds and expenses are split over its lots with splitINR,
+// so lines add up to the lot and sale totals.
+func matchDisposals(userID int, lots []Lot, disposals []disposal, sales map[uint]models.Sale) []CapitalGainLine {
+	// Lots are consumed in place; remaining and remainingCost track what is left of each
+	remaining := make([]decimal.Decimal, len(lots))
+	remainingCost := make([]decimal.Decimal, len(lots))
+	for i, lot := range lots {
+		remaining[i] = lot.Quantity
+		remainingCost[i] = lot.CostINR
+	}
+
+	var lines []CapitalGainLine
+	for _, d := range disposals {
+		needed := d.Quantity
+		var matches []lotMatch
+		for i := range lots {
+			if !needed.IsPositive() {
+				break
+			}
+			lot := lots[i]
+			if lot.StockSymbol != d.StockSymbol || !remaining[i].IsPositive() || lot.AcquiredAt.After(d.Timestamp) {
+				continue
+			}
+
+			take := decimal.Min(needed, remaining[i])
+			cost := remainingCost[i]
+			if take.LessThan(remaining[i]) {
+				cost = utils.RoundINR(lot.CostINR.Mul(take).Div(lot.Quantity))
+			}
+			remaining[i] = remaining[i].Sub(take)
+			remainingCost[i] = remainingCost[i].Sub(cost)
+			needed = needed.Sub(take)
+			matches = append(matches, lotMatch{lot: lot, quantity: take, cost: cost})
+		}
+
+		if needed.IsPositive() {
+			logrus.WithFields(logrus.Fields{
+				"userId":        userID,
+				"symbol":        d.StockSymbol,
+				"referenceType": d.ReferenceType,
+				"referenceId":   d.ReferenceID,
+				"unmatched":     needed,
+			}).Warn("Disposal exceeds acquired lots, unmatched quantity left out of capital gains")
+		}
+
+		sale, taxable := sales[d.ReferenceID]
+		if !taxable || d.ReferenceType != models.ReferenceSale || len(matches) == 0 {
+			continue
+		}
+
+		// An unmatched remainder keeps its share of the sale out of the lines
+		weights := make([]decimal.Decimal, 0, len(matches)+1)
+		for _, m := range matches {
+			weights = append(weights, m.quantity)
+		}
+		if needed.IsPositive() {
+			weights = append(weights, needed)
+		}
+		proceeds := splitINR(sale.GrossINR, weights)
+		expenses := splitINR(sale.FeesINR, weights)
+
+		for i, m := range matches {
+			lines = append(lines, capitalGainLine(sale, m.lot, m.quantity, m.cost, proceeds[i], expenses[i]))
+		}
+	}
+	return lines
+}
+
+// capitalGainLine values the part of a sale matched to a lot
+func capitalGainLine(sale models.Sale, lot Lot, quantity, cost, proceeds, expenses decimal.Decimal) CapitalGainLine {
+	return CapitalGainLine{
+		SaleID:        sale.ID,
+		RewardEventID: lot.RewardEventID,
+		Symbol:        sale.StockSymbol,
+		Currency:      sale.Currency,
+		Quantity:      quantity,
+		AcquiredAt:    lot.AcquiredAt,
+		SoldAt:        sale.Timestamp,
+		HoldingDays:   int(sale.Timestamp.Sub(lot.AcquiredAt).Hours() / 24),
+		CostINR:       cost,
+		ProceedsINR:   proceeds,
+		ExpensesINR:   expenses,
+		GainINR:       proceeds.Sub(expenses).Sub(cost),
+		Term:          gainTerm(sale.Currency, lot.AcquiredAt, sale.Timestamp),
+	}
+}
+
+// gainTerm classes a holding as long term once it is held for more than the
+// period for its market, measured in calendar months in IST
+func gainTerm(currency string, acquiredAt, soldAt time.Time) string {
+	months := longTermMonthsListed
+	if currency != models.BaseCurrency {
+		months = longTermMonthsForeign
+	}
+
+	ist := utils.ISTLocation()
+	if soldAt.In(ist).After(acquiredAt.In(ist).AddDate(0, months, 0)) {
+		return GainLongTerm
+	}
+	return GainShortTerm
+}
+
+// addLine appends a line and adds it to the summary
+func (st *CapitalGainsStatement) addLine(line CapitalGainLine) {
+	st.Lines = append(st.Lines, line)
+	st.Summary.ProceedsINR = st.Summary.ProceedsINR.Add(line.ProceedsINR)
+	st.Summary.CostINR = st.Summary.CostINR.Add(line.CostINR)
+	st.Summary.ExpensesINR = st.Summary.ExpensesINR.Add(line.ExpensesINR)
+	if line.Term == GainLongTerm {
+		st.Summary.LTCGINR = st.Summary.LTCGINR.Add(line.GainINR)
+	} else {
+		st.Summary.STCGINR = st.Summary.STCGINR.Add(line.GainINR)
+	}
+}
+
+// WriteCSV writes the statement's lines followed by STCG and LTCG totals
+func (st *CapitalGainsStatement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{
+		"sale_id", "reward_event_id", "symbol", "currency", "quantity", "acquired_at", "sold_at",
+		"holding_days", "cost_inr", "proceeds_inr", "expenses_inr", "gain_inr", "term",
+	}}
+	for _, line := range st.Lines {
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(line.SaleID), 10),
+			strconv.FormatUint(uint64(line.RewardEventID), 10),
+			line.Symbol,
+			line.Currency,
+			line.Quantity.String(),
+			line.AcquiredAt.UTC().Format(time.RFC3339),
+			line.SoldAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(line.HoldingDays),
+			line.CostINR.StringFixed(4),
+			line.ProceedsINR.StringFixed(4),
+			line.ExpensesINR.StringFixed(4),
+			line.GainINR.StringFixed(4),
+			line.Term,
+		})
+	}
+	rows = append(rows,
+		[]string{"total", "", "", "", "", "", "", "", st.Summary.CostINR.StringFixed(4), st.Summary.ProceedsINR.StringFixed(4), st.Summary.ExpensesINR.StringFixed(4), "", ""},
+		[]string{GainShortTerm, "", "", "", "", "", "", "", "", "", "", st.Summary.STCGINR.StringFixed(4), GainShortTerm},
+		[]string{GainLongTerm, "", "", "", "", "", "", "", "", "", "", st.Summary.LTCGINR.StringFixed(4), GainLongTerm},
+	)
+
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write capital gains csv: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseFinancialYear(t *testing.T) {
+	ist := utils.ISTLocation()
+	tests := []struct {
+		input string
+		label string
+		from  time.Time
+	}{
+		{"2024-25", "2024-25", time.Date(2024, time.April, 1, 0, 0, 0, 0, ist)},
+		{" 2024 ", "2024-25", time.Date(2024, time.April, 1, 0, 0, 0, 0, ist)},
+		{"2099-00", "2099-00", time.Date(2099, time.April, 1, 0, 0, 0, 0, ist)},
+	}
+	for _, tt := range tests {
+		label, from, to, err := ParseFinancialYear(tt.input)
+		if err != nil {
+			t.Errorf("ParseFinancialYear(%q): %v", tt.input, err)
+			continue
+		}
+		if label != tt.label || !from.Equal(tt.from) || !to.Equal(tt.from.AddDate(1, 0, 0)) {
+			t.Errorf("ParseFinancialYear(%q) = %s %s %s", tt.input, label, from, to)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "2024-26", "2024-2025", "1999-00", "2024-xx"} {
+		if _, _, _, err := ParseFinancialYear(input); !errors.Is(err, ErrInvalidFinancialYear) {
+			t.Errorf("ParseFinancialYear(%q) err = %v, want ErrInvalidFinancialYear", input, err)
+		}
+	}
+}
+
+func TestFinancialYearOf(t *testing.T) {
+	tests := []struct {
+		at   string
+		want string
+	}{
+		// 23:30 IST on 31 March
+		{"2024-03-31T18:00:00Z", "2023-24"},
+		// 01:30 IST on 1 April
+		{"2024-03-31T20:00:00Z", "2024-25"},
+		{"2025-01-15T00:00:00Z", "2024-25"},
+		{"1999-12-31T00:00:00Z", "1999-00"},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		if got := FinancialYearOf(at); got != tt.want {
+			t.Errorf("FinancialYearOf(%s) = %s, want %s", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestGainTerm(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, utils.ISTLocation())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	acquired := at("2023-05-10 10:00")
+
+	tests := []struct {
+		name     string
+		currency string
+		soldAt   string
+		want     string
+	}{
+		{"listed, exactly 12 months", "INR", "2024-05-10 10:00", GainShortTerm},
+		{"listed, over 12 months", "INR", "2024-05-10 10:01", GainLongTerm},
+		{"foreign, over 12 months", "USD", "2024-05-11 10:00", GainShortTerm},
+		{"foreign, exactly 24 months", "USD", "2025-05-10 10:00", GainShortTerm},
+		{"foreign, over 24 months", "USD", "2025-05-11 10:00", GainLongTerm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gainTerm(tt.currency, acquired, at(tt.soldAt)); got != tt.want {
+				t.Errorf("gainTerm = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDisposals(t *testing.T) {
+	day := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	lots := []Lot{
+		{RewardEventID: 1, StockSymbol: "TCS", Quantity: decimal.NewFromInt(3), CostINR: decimal.NewFromInt(100), AcquiredAt: day("2023-01-10")},
+		{RewardEventID: 2, StockSymbol: "INFY", Quantity: decimal.NewFromInt(5), CostINR: decimal.NewFromInt(500), AcquiredAt: day("2023-02-10")},
+		{RewardEventID: 3, StockSymbol: "TCS", Quantity: decimal.NewFromInt(2), CostINR: decimal.NewFromInt(50), AcquiredAt: day("2023-06-10")},
+		{RewardEventID: 4, StockSymbol: "TCS", Quantity: decimal.NewFromInt(4), CostINR: decimal.NewFromInt(40), AcquiredAt: day("2024-06-01")},
+	}
+	sales := map[uint]models.Sale{
+		10: {ID: 10, StockSymbol: "TCS", Currency: "INR", Quantity: decimal.NewFromInt(1), GrossINR: decimal.NewFromInt(300), FeesINR: decimal.NewFromInt(1), Timestamp: day("2023-03-01")},
+		11: {ID: 11, StockSymbol: "TCS", Currency: "INR", Quantity: decimal.NewFromInt(3), GrossINR: decimal.NewFromInt(1000), FeesINR: decimal.NewFromInt(1), Timestamp: day("2024-05-15")},
+	}
+	disposals := []disposal{
+		{ReferenceType: models.ReferenceSale, ReferenceID: 10, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1), Timestamp: day("2023-03-01")},
+		// A transfer consumes its lot but is not a taxable sale
+		{ReferenceType: models.ReferenceTransfer, ReferenceID: 10, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1), Timestamp: day("2023-04-01")},
+		// Spans the rest of the first lot and all of the second; the
+		// 2024-06 lot is acquired later and cannot be matched
+		{ReferenceType: models.ReferenceSale, ReferenceID: 11, StockSymbol: "TCS", Quantity: decimal.NewFromInt(3), Timestamp: day("2024-05-15")},
+	}
+
+	lines := matchDisposals(fixtureUserID, lots, disposals, sales)
+
+	type lineWant struct {
+		saleID, rewardEventID              uint
+		quantity, cost, proceeds, expenses string
+		term                               string
+	}
+	want := []lineWant{
+		{10, 1, "1", "33.3333", "300", "1", GainShortTerm},
+		{11, 1, "1", "33.3334", "333.3333", "0.3333", GainLongTerm},
+		{11, 3, "2", "50", "666.6667", "0.6667", GainShortTerm},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i, w := range want {
+		line := lines[i]
+		if line.SaleID != w.saleID || line.RewardEventID != w.rewardEventID ||
+			!line.Quantity.Equal(decimal.RequireFromString(w.quantity)) ||
+			!line.CostINR.Equal(decimal.RequireFromString(w.cost)) ||
+			!line.ProceedsINR.Equal(decimal.RequireFromString(w.proceeds)) ||
+			!line.ExpensesINR.Equal(decimal.RequireFromString(w.expenses)) ||
+			line.Term != w.term {
+			t.Errorf("line %d = sale %d lot %d %s cost %s proceeds %s expenses %s %s, want %+v", i,
+				line.SaleID, line.RewardEventID, line.Quantity, line.CostINR, line.ProceedsINR, line.ExpensesINR, line.Term, w)
+		}
+	}
+
+	// The first lot's cost is fully used across its three disposals
+	// (the transfer took 33.3333 without a line)
+	if total := lines[0].CostINR.Add(decimal.RequireFromString("33.3333")).Add(lines[1].CostINR); !total.Equal(lots[0].CostINR) {
+		t.Errorf("first lot cost used = %s, want %s", total, lots[0].CostINR)
+	}
+}
+
+func TestMatchDisposalsUnmatched(t *testing.T) {
+	acquired := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	soldAt := acquired.AddDate(0, 2, 0)
+	lots := []Lot{{RewardEventID: 1, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1), CostINR: decimal.NewFromInt(10), AcquiredAt: acquired}}
+	sales := map[uint]models.Sale{
+		5: {ID: 5, StockSymbol: "TCS", Currency: "INR", Quantity: decimal.NewFromInt(2), GrossINR: decimal.NewFromInt(100), FeesINR: decimal.NewFromInt(2), Timestamp: soldAt},
+	}
+	disposals := []disposal{{ReferenceType: models.ReferenceSale, ReferenceID: 5, StockSymbol: "TCS", Quantity: decimal.NewFromInt(2), Timestamp: soldAt}}
+
+	lines := matchDisposals(fixtureUserID, lots, disposals, sales)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	// Only the matched share's part of the sale is reported
+	if !lines[0].ProceedsINR.Equal(decimal.NewFromInt(50)) || !lines[0].ExpensesINR.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("line proceeds %s expenses %s, want 50 and 1", lines[0].ProceedsINR, lines[0].ExpensesINR)
+	}
+	if !lines[0].GainINR.Equal(decimal.NewFromInt(39)) {
+		t.Errorf("gain = %s, want 39", lines[0].GainINR)
+	}
+}
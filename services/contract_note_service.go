@@ -0,0 +1,538 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// contractFeeTolerance is the largest fee difference treated as rounding
+var contractFeeTolerance = decimal.NewFromFloat(0.01)
+
+// contractMatchLookback is how long before a trade date an order or lot may
+// have been recorded, covering the longest run of non-trading days
+const contractMatchLookback = 10 * 24 * time.Hour
+
+var (
+	// ErrContractTradeNotFound is returned when a contract trade does not exist
+	ErrContractTradeNotFound = errors.New("contract trade not found")
+
+	// ErrContractTradeResolved is returned when reviewing a trade that is not awaiting review
+	ErrContractTradeResolved = errors.New("contract trade is not awaiting review")
+
+	// ErrContractTradeCancelled is returned when adjusting a trade whose rewards were all cancelled
+	ErrContractTradeCancelled = errors.New("contract trade's rewards were cancelled")
+)
+
+// ContractNoteRowError describes a rejected contract note row
+type ContractNoteRowError struct {
+	Row    int    `json:"row"`
+	Symbol string `json:"symbol,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ContractNoteImportResult summarises a contract note import
+type ContractNoteImportResult struct {
+	ContractNote string                 `json:"contractNote"`
+	Matched      int                    `json:"matched"`
+	Mismatched   int                    `json:"mismatched"`
+	Unmatched    int                    `json:"unmatched"`
+	Skipped      int                    `json:"skipped"`
+	Rejected     int                    `json:"rejected"`
+	Errors       []ContractNoteRowError `json:"errors,omitempty"`
+}
+
+// ContractNoteService imports broker contract notes and reconciles their
+// charges against the fees booked for rewards
+type ContractNoteService struct {
+	calendar *MarketCalendar
+}
+
+// NewContractNoteService creates a new contract note service
+func NewContractNoteService(calendar *MarketCalendar) *ContractNoteService {
+	return &ContractNoteService{
+		calendar: calendar,
+	}
+}
+
+// Import reads a contract note CSV with columns trade_date, symbol, quantity,
+// price, brokerage, stt and gst (plus optional side and order_ref). Each buy
+// is matched by symbol, quantity and exchange date to a broker order, or else
+// to a treasury lot purchase, and its charges compared with the fees booked.
+// Rows already imported for the same contract note are skipped.
+func (s *ContractNoteService) Import(r io.Reader, contractNote string) (*ContractNoteImportResult, error) {
+	contractNote = strings.TrimSpace(contractNote)
+	if contractNote == "" || len(contractNote) > 100 {
+		return nil, fmt.Errorf("%w: contract note name must be 1-100 characters", ErrInvalidImportFile)
+	}
+
+	rows, err := parseContractNote(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ContractNoteImportResult{ContractNote: contractNote}
+	for _, row := range rows {
+		trade, reason := validateContractRow(row, contractNote)
+		if reason != "" {
+			result.reject(row, reason)
+			continue
+		}
+
+		status, err := s.importTrade(trade)
+		if err != nil {
+			return nil, err
+		}
+		switch status {
+		case "":
+			result.Skipped++
+		case models.ContractTradeMatched:
+			result.Matched++
+		case models.ContractTradeMismatch:
+			result.Mismatched++
+		case models.ContractTradeUnmatched:
+			result.Unmatched++
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"contractNote": contractNote,
+		"matched":      result.Matched,
+		"mismatched":   result.Mismatched,
+		"unmatched":    result.Unmatched,
+		"skipped":      result.Skipped,
+		"rejected":     result.Rejected,
+	}).Info("Contract note imported")
+
+	return result, nil
+}
+
+// reject records a rejected row, keeping at most maxReportedImportErrors reasons
+func (r *ContractNoteImportResult) reject(row contractNoteRow, reason string) {
+	r.Rejected++
+	if len(r.Errors) < maxReportedImportErrors {
+		r.Errors = append(r.Errors, ContractNoteRowError{Row: row.Row, Symbol: row.Symbol, Reason: reason})
+	}
+}
+
+// contractNoteRow is a raw contract note line before validation
+type contractNoteRow struct {
+	Row       int
+	TradeDate string
+	Symbol    string
+	Side      string
+	Quantity  string
+	Price     string
+	Brokerage string
+	STT       string
+	GST       string
+	OrderRef  string
+}
+
+// parseContractNote reads the CSV rows by header name
+func parseContractNote(r io.Reader) ([]contractNoteRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImportFile)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"trade_date", "symbol", "quantity", "price", "brokerage", "stt", "gst"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must include %s", ErrInvalidImportFile, required)
+		}
+	}
+
+	field := func(fields []string, name string) string {
+		col, ok := columns[name]
+		if !ok || col >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[col])
+	}
+
+	var rows []contractNoteRow
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+
+		rows = append(rows, contractNoteRow{
+			Row:       line,
+			TradeDate: field(fields, "trade_date"),
+			Symbol:    field(fields, "symbol"),
+			Side:      field(fields, "side"),
+			Quantity:  field(fields, "quantity"),
+			Price:     field(fields, "price"),
+			Brokerage: field(fields, "brokerage"),
+			STT:       field(fields, "stt"),
+			GST:       field(fields, "gst"),
+			OrderRef:  field(fields, "order_ref"),
+		})
+	}
+	return rows, nil
+}
+
+// validateContractRow converts a row to a trade, or returns why it was rejected
+func validateContractRow(row contractNoteRow, contractNote string) (models.ContractTrade, string) {
+	trade := models.ContractTrade{
+		ContractNote: contractNote,
+		Line:         row.Row,
+		StockSymbol:  strings.ToUpper(row.Symbol),
+		OrderRef:     row.OrderRef,
+	}
+
+	if err := utils.ValidateStockSymbol(trade.StockSymbol); err != nil {
+		return trade, err.Error()
+	}
+	if side := strings.ToUpper(row.Side); side != "" && side != "BUY" && side != "B" {
+		return trade, "only buy trades are reconciled"
+	}
+	if len(trade.OrderRef) > 64 {
+		return trade, "order_ref is longer than 64 characters"
+	}
+
+	date, err := time.Parse("2006-01-02", row.TradeDate)
+	if err != nil {
+		return trade, "invalid trade_date, use YYYY-MM-DD"
+	}
+	trade.TradeDate = utils.GetDateString(date)
+
+	decimals := []struct {
+		name  string
+		raw   string
+		value *decimal.Decimal
+	}{
+		{"quantity", row.Quantity, &trade.Quantity},
+		{"price", row.Price, &trade.Price},
+		{"brokerage", row.Brokerage, &trade.BrokerageINR},
+		{"stt", row.STT, &trade.STTINR},
+		{"gst", row.GST, &trade.GSTINR},
+	}
+	for _, d := range decimals {
+		value, err := decimal.NewFromString(d.raw)
+		if err != nil || value.IsNegative() {
+			return trade, fmt.Sprintf("invalid %s %q", d.name, d.raw)
+		}
+		*d.value = value
+	}
+	if !trade.Quantity.IsPositive() || !trade.Price.IsPositive() {
+		return trade, "quantity and price must be positive"
+	}
+
+	trade.Quantity = utils.RoundQuantity(trade.Quantity)
+	trade.FeesINR = trade.BrokerageINR.Add(trade.STTINR).Add(trade.GSTINR)
+	return trade, ""
+}
+
+// importTrade matches and stores one trade. It returns the trade's status, or
+// "" when the row was imported before.
+func (s *ContractNoteService) importTrade(trade models.ContractTrade) (models.ContractTradeStatus, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		err := tx.Model(&models.ContractTrade{}).
+			Where("contract_note = ? AND line = ?", trade.ContractNote, trade.Line).
+			Count(&existing).Error
+		if err != nil {
+			return fmt.Errorf("failed to check contract trade: %w", err)
+		}
+		if existing > 0 {
+			return nil
+		}
+
+		// Serialise matching per symbol so two imports cannot claim the same order or lot
+		key := advisoryLockKey(dataLockNamespace, "contract-match:"+trade.StockSymbol)
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", key).Error; err != nil {
+			return fmt.Errorf("failed to lock contract matching: %w", err)
+		}
+
+		booked, matched, err := s.matchContractTrade(tx, &trade)
+		if err != nil {
+			return err
+		}
+
+		if !matched {
+			trade.Status = models.ContractTradeUnmatched
+		} else {
+			difference := trade.FeesINR.Sub(booked)
+			trade.BookedFeesINR = decimal.NewNullDecimal(booked)
+			trade.DifferenceINR = decimal.NewNullDecimal(difference)
+			trade.Status = models.ContractTradeMatched
+			if difference.Abs().GreaterThan(contractFeeTolerance) {
+				trade.Status = models.ContractTradeMismatch
+			}
+		}
+
+		if err := tx.Create(&trade).Error; err != nil {
+			return fmt.Errorf("failed to save contract trade: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if trade.Status == models.ContractTradeMismatch {
+		logrus.WithFields(logrus.Fields{
+			"contractTradeId": trade.ID,
+			"symbol":          trade.StockSymbol,
+			"feesInr":         trade.FeesINR,
+			"bookedFeesInr":   trade.BookedFeesINR.Decimal,
+		}).Warn("Contract note charges differ from booked fees")
+	}
+	return trade.Status, nil
+}
+
+// matchContractTrade links a trade to the oldest unclaimed broker order, or
+// else treasury lot purchase, with its symbol and quantity that traded on its
+// trade date, and returns the charges booked for it. Orders trade on their
+// fill's exchange date; orders and lots recorded outside a session trade in
+// the next one.
+func (s *ContractNoteService) matchContractTrade(tx *gorm.DB, trade *models.ContractTrade) (decimal.Decimal, bool, error) {
+	to, err := time.ParseInLocation("2006-01-02", trade.TradeDate, s.calendar.Location())
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("failed to parse trade date: %w", err)
+	}
+	to = to.AddDate(0, 0, 1)
+	from := to.Add(-contractMatchLookback)
+
+	var orders []models.BrokerOrder
+	err = tx.Where("stock_symbol = ? AND quantity = ? AND status IN ? AND placed_at >= ? AND placed_at < ?",
+		trade.StockSymbol, trade.Quantity,
+		[]models.BrokerOrderStatus{models.BrokerOrderPlaced, models.BrokerOrderFilled}, from, to).
+		Where("id NOT IN (?)", tx.Model(&models.ContractTrade{}).Select("broker_order_id").Where("broker_order_id IS NOT NULL")).
+		Order("placed_at, id").
+		Find(&orders).Error
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("failed to match broker order: %w", err)
+	}
+	for _, order := range orders {
+		if s.orderTradeDate(order) != trade.TradeDate {
+			continue
+		}
+		trade.BrokerOrderID = &order.ID
+
+		var rewardIDs []uint
+		err := tx.Model(&models.BrokerOrderAllocation{}).Where("order_id = ?", order.ID).Pluck("reward_event_id", &rewardIDs).Error
+		if err != nil {
+			return decimal.Zero, false, fmt.Errorf("failed to fetch order allocations: %w", err)
+		}
+		booked, err := bookedFeesINR(tx, rewardIDs)
+		return booked, true, err
+	}
+
+	var lots []models.TreasuryLot
+	err = tx.Where("stock_symbol = ? AND quantity = ? AND purchased_at >= ? AND purchased_at < ?",
+		trade.StockSymbol, trade.Quantity, from, to).
+		Where("id NOT IN (?)", tx.Model(&models.ContractTrade{}).Select("treasury_lot_id").Where("treasury_lot_id IS NOT NULL")).
+		Order("purchased_at, id").
+		Find(&lots).Error
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("failed to match treasury lot: %w", err)
+	}
+	for _, lot := range lots {
+		if s.calendar.TradeDate(lot.PurchasedAt) != trade.TradeDate {
+			continue
+		}
+		trade.TreasuryLotID = &lot.ID
+		return lot.FeesINR, true, nil
+	}
+	return decimal.Zero, false, nil
+}
+
+// orderTradeDate returns the exchange date an order traded on: its fill's,
+// or for an order not yet filled the session it was placed for
+func (s *ContractNoteService) orderTradeDate(order models.BrokerOrder) string {
+	if order.FilledAt != nil {
+		return s.calendar.TradeDate(*order.FilledAt)
+	}
+	return s.calendar.TradeDate(order.PlacedAt)
+}
+
+// bookedFeesINR returns the company FEE booked for rewards, estimates plus
+// earlier adjustments, as a positive amount
+func bookedFeesINR(tx *gorm.DB, rewardIDs []uint) (decimal.Decimal, error) {
+	if len(rewardIDs) == 0 {
+		return decimal.Zero, nil
+	}
+
+	var booked decimal.NullDecimal
+	err := tx.Model(&models.LedgerEntry{}).
+		Select("SUM(amount_inr)").
+		Where("reward_event_id IN ? AND account = ? AND entry_type = ?", rewardIDs, models.AccountCompany, models.EntryTypeFee).
+		Scan(&booked).Error
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to fetch booked fees: %w", err)
+	}
+	return booked.Decimal.Neg(), nil
+}
+
+// ListTrades returns contract trades, newest first, optionally filtered by status
+func (s *ContractNoteService) ListTrades(status string) ([]models.ContractTrade, error) {
+	query := db.DB.Order("trade_date DESC, id DESC").Limit(500)
+	if status != "" {
+		query = query.Where("status = ?", strings.ToUpper(status))
+	}
+
+	var trades []models.ContractTrade
+	if err := query.Find(&trades).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch contract trades: %w", err)
+	}
+	return trades, nil
+}
+
+// AdjustTrade fixes a mismatch. For a broker order it books company FEE
+// entries for the difference, split over the order's rewards by quantity; for
+// a treasury lot it moves the lot's fees and cost by the difference, which
+// prices draws made after the adjustment.
+func (s *ContractNoteService) AdjustTrade(id uint, reviewer, note string) (*models.ContractTrade, error) {
+	return s.reviewTrade(id, models.ContractTradeAdjusted, reviewer, note, func(tx *gorm.DB, trade *models.ContractTrade) error {
+		if trade.Status != models.ContractTradeMismatch {
+			return fmt.Errorf("%w: only mismatched trades can be adjusted", ErrContractTradeResolved)
+		}
+
+		if trade.TreasuryLotID != nil {
+			entry := lotFeeAdjustment(trade, utils.NowUTC())
+			if err := tx.Create(&entry).Error; err != nil {
+				return fmt.Errorf("failed to create fee adjustment: %w", err)
+			}
+			return nil
+		}
+
+		var rewards []models.RewardEvent
+		err := tx.Where("id IN (?)", tx.Model(&models.BrokerOrderAllocation{}).Select("reward_event_id").Where("order_id = ?", *trade.BrokerOrderID)).
+			Order("id").
+			Find(&rewards).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch trade rewards: %w", err)
+		}
+		if len(rewards) == 0 {
+			return ErrContractTradeCancelled
+		}
+
+		entries := contractFeeAdjustments(trade, rewards, utils.NowUTC())
+		if err := tx.Create(&entries).Error; err != nil {
+			return fmt.Errorf("failed to create fee adjustments: %w", err)
+		}
+		return nil
+	})
+}
+
+// contractFeeAdjustments returns the company FEE entries that book a trade's
+// fee difference, split over its rewards by quantity
+func contractFeeAdjustments(trade *models.ContractTrade, rewards []models.RewardEvent, now time.Time) []models.LedgerEntry {
+	quantities := make([]decimal.Decimal, len(rewards))
+	for i, reward := range rewards {
+		quantities[i] = reward.Quantity
+	}
+	shares := splitINR(trade.DifferenceINR.Decimal, quantities)
+
+	entries := make([]models.LedgerEntry, 0, len(rewards))
+	for i := range rewards {
+		rewardID := rewards[i].ID
+		symbol := rewards[i].StockSymbol
+		entries = append(entries, models.LedgerEntry{
+			UserID:         rewards[i].UserID,
+			RewardEventID:  &rewardID,
+			ReferenceType:  models.ReferenceContractNote,
+			ReferenceID:    trade.ID,
+			Account:        models.AccountCompany,
+			EntryType:      models.EntryTypeFee,
+			StockSymbol:    &symbol,
+			Quantity:       decimal.Zero,
+			AmountINR:      shares[i].Neg(),
+			Currency:       models.BaseCurrency,
+			AmountOriginal: shares[i].Neg(),
+			FxRate:         decimal.NewFromInt(1),
+			Timestamp:      now,
+		})
+	}
+	return entries
+}
+
+// lotFeeAdjustment returns the company FEE entry that books a treasury lot
+// trade's fee difference. The lot itself is left as recorded.
+func lotFeeAdjustment(trade *models.ContractTrade, now time.Time) models.LedgerEntry {
+	symbol := trade.StockSymbol
+	return models.LedgerEntry{
+		ReferenceType:  models.ReferenceContractNote,
+		ReferenceID:    trade.ID,
+		Account:        models.AccountCompany,
+		EntryType:      models.EntryTypeFee,
+		StockSymbol:    &symbol,
+		Quantity:       decimal.Zero,
+		AmountINR:      trade.DifferenceINR.Decimal.Neg(),
+		Currency:       models.BaseCurrency,
+		AmountOriginal: trade.DifferenceINR.Decimal.Neg(),
+		FxRate:         decimal.NewFromInt(1),
+		Timestamp:      now,
+	}
+}
+
+// AcceptTrade closes a mismatched or unmatched trade without adjustments
+func (s *ContractNoteService) AcceptTrade(id uint, reviewer, note string) (*models.ContractTrade, error) {
+	return s.reviewTrade(id, models.ContractTradeAccepted, reviewer, note, nil)
+}
+
+// reviewTrade moves a trade awaiting review to a final status inside a transaction
+func (s *ContractNoteService) reviewTrade(id uint, status models.ContractTradeStatus, reviewer, note string, apply func(tx *gorm.DB, trade *models.ContractTrade) error) (*models.ContractTrade, error) {
+	var trade models.ContractTrade
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&trade, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrContractTradeNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch contract trade: %w", err)
+		}
+		if trade.Status != models.ContractTradeMismatch && trade.Status != models.ContractTradeUnmatched {
+			return ErrContractTradeResolved
+		}
+
+		if apply != nil {
+			if err := apply(tx, &trade); err != nil {
+				return err
+			}
+		}
+
+		reviewedAt := utils.NowUTC()
+		trade.Status = status
+		trade.ReviewedBy = reviewer
+		trade.ReviewNote = note
+		trade.ReviewedAt = &reviewedAt
+		return tx.Save(&trade).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"contractTradeId": trade.ID,
+		"symbol":          trade.StockSymbol,
+		"status":          status,
+		"reviewedBy":      reviewer,
+	}).Info("Contract trade reviewed")
+
+	return &trade, nil
+}
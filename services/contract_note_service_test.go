@@ -0,0 +1,205 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestValidateContractRow(t *testing.T) {
+	valid := contractNoteRow{
+		Row:       2,
+		TradeDate: "2024-05-02",
+		Symbol:    "tcs",
+		Side:      "BUY",
+		Quantity:  "3.1234567",
+		Price:     "3850.50",
+		Brokerage: "20",
+		STT:       "11.55",
+		GST:       "3.60",
+		OrderRef:  "SIM-42",
+	}
+
+	trade, reason := validateContractRow(valid, "CN-1")
+	if reason != "" {
+		t.Fatalf("valid row rejected: %s", reason)
+	}
+	if trade.StockSymbol != "TCS" || trade.TradeDate != "2024-05-02" || trade.Line != 2 || trade.ContractNote != "CN-1" {
+		t.Errorf("unexpected trade %+v", trade)
+	}
+	if want := decimal.RequireFromString("3.123457"); !trade.Quantity.Equal(want) {
+		t.Errorf("quantity = %s, want %s", trade.Quantity, want)
+	}
+	if want := decimal.RequireFromString("35.15"); !trade.FeesINR.Equal(want) {
+		t.Errorf("fees = %s, want %s", trade.FeesINR, want)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(row *contractNoteRow)
+		reason string
+	}{
+		{"sell", func(row *contractNoteRow) { row.Side = "SELL" }, "only buy"},
+		{"short side code accepted", func(row *contractNoteRow) { row.Side = "b" }, ""},
+		{"blank side accepted", func(row *contractNoteRow) { row.Side = "" }, ""},
+		{"missing symbol", func(row *contractNoteRow) { row.Symbol = "" }, "symbol"},
+		{"bad date", func(row *contractNoteRow) { row.TradeDate = "02/05/2024" }, "trade_date"},
+		{"negative charge", func(row *contractNoteRow) { row.STT = "-1" }, "invalid stt"},
+		{"bad price", func(row *contractNoteRow) { row.Price = "abc" }, "invalid price"},
+		{"zero quantity", func(row *contractNoteRow) { row.Quantity = "0" }, "must be positive"},
+		{"long order ref", func(row *contractNoteRow) { row.OrderRef = strings.Repeat("X", 65) }, "order_ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := valid
+			tt.modify(&row)
+			_, reason := validateContractRow(row, "CN-1")
+			if tt.reason == "" && reason != "" {
+				t.Errorf("rejected with %q, want accepted", reason)
+			}
+			if tt.reason != "" && !strings.Contains(reason, tt.reason) {
+				t.Errorf("reason = %q, want it to mention %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestOrderTradeDate(t *testing.T) {
+	service := NewContractNoteService(NewMarketCalendar())
+	ist := utils.ISTLocation()
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, ist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	// 2024-05-03 is a Friday
+	tests := []struct {
+		name     string
+		placedAt time.Time
+		filledAt *time.Time
+		want     string
+	}{
+		{"placed in session, unfilled", at("2024-05-03 10:00"), nil, "2024-05-03"},
+		{"placed before the open", at("2024-05-03 08:00"), nil, "2024-05-03"},
+		{"placed after the close trades next session", at("2024-05-03 18:00"), nil, "2024-05-06"},
+		{"placed at the weekend", at("2024-05-04 11:00"), nil, "2024-05-06"},
+		{"fill date wins", at("2024-05-03 18:00"), timePtr(at("2024-05-06 09:20")), "2024-05-06"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.BrokerOrder{PlacedAt: tt.placedAt, FilledAt: tt.filledAt}
+			if got := service.orderTradeDate(order); got != tt.want {
+				t.Errorf("orderTradeDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestContractFeeAdjustments(t *testing.T) {
+	trade := &models.ContractTrade{
+		ID:            7,
+		DifferenceINR: decimal.NewNullDecimal(decimal.RequireFromString("10")),
+	}
+	rewards := []models.RewardEvent{
+		{ID: 1, UserID: 11, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1)},
+		{ID: 2, UserID: 12, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1)},
+		{ID: 3, UserID: 13, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1)},
+	}
+
+	entries := contractFeeAdjustments(trade, rewards, utils.NowUTC())
+	want := decimals("-3.3333", "-3.3333", "-3.3334")
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if !entry.AmountINR.Equal(want[i]) {
+			t.Errorf("entry %d amount = %s, want %s", i, entry.AmountINR, want[i])
+		}
+		if entry.UserID != rewards[i].UserID || *entry.RewardEventID != rewards[i].ID {
+			t.Errorf("entry %d booked to user %d reward %d", i, entry.UserID, *entry.RewardEventID)
+		}
+		if entry.ReferenceType != models.ReferenceContractNote || entry.ReferenceID != trade.ID {
+			t.Errorf("entry %d references %s/%d", i, entry.ReferenceType, entry.ReferenceID)
+		}
+		if entry.Account != models.AccountCompany || entry.EntryType != models.EntryTypeFee {
+			t.Errorf("entry %d is %s %s, want company FEE", i, entry.Account, entry.EntryType)
+		}
+	}
+}
+
+func TestImportContractNoteMatchesLot(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	calendar := NewMarketCalendar()
+	purchasedAt, _ := time.ParseInLocation("2006-01-02 15:04", "2024-05-03 18:00", calendar.Location())
+	lot := models.TreasuryLot{
+		StockSymbol:       "HDFCBANK",
+		Quantity:          decimal.NewFromInt(7),
+		RemainingQuantity: decimal.NewFromInt(7),
+		Price:             decimal.NewFromInt(1500),
+		FeesINR:           decimal.RequireFromString("30"),
+		CostINR:           decimal.RequireFromString("10530"),
+		PurchasedAt:       purchasedAt,
+	}
+	mustCreate(t, &lot)
+
+	// Bought after Friday's close, so it trades on Monday
+	note := "trade_date,symbol,quantity,price,brokerage,stt,gst\n" +
+		"2024-05-06,HDFCBANK,7,1500,20,10.5,3.6\n"
+	service := NewContractNoteService(calendar)
+	result, err := service.Import(strings.NewReader(note), "CN-TEST")
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Mismatched != 1 {
+		t.Fatalf("result = %+v, want one mismatch", result)
+	}
+
+	trades, err := service.ListTrades(string(models.ContractTradeMismatch))
+	if err != nil || len(trades) == 0 {
+		t.Fatalf("ListTrades: %v", err)
+	}
+	trade := trades[0]
+	if trade.TreasuryLotID == nil || *trade.TreasuryLotID != lot.ID {
+		t.Fatalf("trade not matched to lot %d", lot.ID)
+	}
+	if want := decimal.RequireFromString("4.1"); !trade.DifferenceINR.Decimal.Equal(want) {
+		t.Errorf("difference = %s, want %s", trade.DifferenceINR.Decimal, want)
+	}
+
+	if _, err := service.AdjustTrade(trade.ID, "ops", ""); err != nil {
+		t.Fatalf("AdjustTrade: %v", err)
+	}
+
+	// The difference is booked as a company FEE; the lot keeps its recorded cost
+	if err := db.DB.First(&lot, lot.ID).Error; err != nil {
+		t.Fatalf("failed to reload lot: %v", err)
+	}
+	if want := decimal.RequireFromString("10530"); !lot.CostINR.Equal(want) {
+		t.Errorf("lot cost = %s, want %s", lot.CostINR, want)
+	}
+	var entries []models.LedgerEntry
+	err = db.DB.Where("reference_type = ? AND reference_id = ?", models.ReferenceContractNote, trade.ID).Find(&entries).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Account != models.AccountCompany || entries[0].EntryType != models.EntryTypeFee ||
+		!entries[0].AmountINR.Equal(decimal.RequireFromString("-4.1")) {
+		t.Errorf("entries = %+v, want one company FEE of -4.1", entries)
+	}
+}
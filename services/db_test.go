@@ -0,0 +1,37 @@
+package services
+
+import (
+	"os"
+	"stocky-backend/db"
+	"sync"
+	"testing"
+)
+
+// Database tests need a scratch Postgres database in DATABASE_URL. Fixtures
+// are written inside a transaction that is rolled back afterwards.
+
+var initDBOnce sync.Once
+
+// beginTestTx points db.DB at a fresh transaction and returns the function
+// that rolls it back, skipping the test when no database is configured
+func beginTestTx(tb testing.TB) func() {
+	tb.Helper()
+
+	if os.Getenv("DATABASE_URL") == "" {
+		tb.Skip("DATABASE_URL not set")
+	}
+
+	var initErr error
+	initDBOnce.Do(func() { initErr = db.Initialize() })
+	if initErr != nil {
+		tb.Fatalf("failed to initialize database: %v", initErr)
+	}
+
+	root := db.DB
+	tx := root.Begin()
+	db.DB = tx
+	return func() {
+		tx.Rollback()
+		db.DB = root
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// DepositoryStatus is the depository's view of a delivery instruction
+type DepositoryStatus string
+
+const (
+	DepositoryPending   DepositoryStatus = "PENDING"
+	DepositoryCompleted DepositoryStatus = "COMPLETED"
+	DepositoryFailed    DepositoryStatus = "FAILED"
+)
+
+// DepositoryInstruction asks the depository to deliver shares to a demat account
+type DepositoryInstruction struct {
+	TransferID   uint            `json:"transferId"`
+	UserID       int             `json:"userId"`
+	Symbol       string          `json:"symbol"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	DematAccount string          `json:"dematAccount"`
+	RequestedAt  time.Time       `json:"requestedAt"`
+}
+
+// DepositoryResult is the outcome of an instruction
+type DepositoryResult struct {
+	Status DepositoryStatus `json:"status"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+// Depository delivers shares out of the company's account. Submit must be
+// idempotent per transfer, as instructions are resubmitted after errors.
+type Depository interface {
+	// Submit hands over an instruction and returns the depository's reference
+	Submit(instruction DepositoryInstruction) (string, error)
+	// Status reports the outcome of a submitted instruction
+	Status(ref string) (DepositoryResult, error)
+}
+
+// FileDepository is a stand-in for a depository participant, for development
+// and tests. It writes instructions to <dir>/outbox/<ref>.json and reads
+// outcomes from <dir>/responses/<ref>.json; an instruction without a response
+// is pending.
+type FileDepository struct {
+	dir string
+}
+
+// NewFileDepository creates a file depository rooted at dir
+func NewFileDepository(dir string) (*FileDepository, error) {
+	for _, sub := range []string{"outbox", "responses"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create depository directory: %w", err)
+		}
+	}
+	return &FileDepository{dir: dir}, nil
+}
+
+// LoadDepository returns the file depository at DEPOSITORY_DIR, or nil when
+// no depository is configured and transfers are disabled
+func LoadDepository() (Depository, error) {
+	dir := os.Getenv("DEPOSITORY_DIR")
+	if dir == "" {
+		logrus.Warn("DEPOSITORY_DIR not set, transfers are disabled")
+		return nil, nil
+	}
+	return NewFileDepository(dir)
+}
+
+// Submit writes the instruction to the outbox
+func (d *FileDepository) Submit(instruction DepositoryInstruction) (string, error) {
+	ref := fmt.Sprintf("TRF-%d", instruction.TransferID)
+	data, err := json.MarshalIndent(instruction, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode instruction: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "outbox", ref+".json"), data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write instruction: %w", err)
+	}
+	return ref, nil
+}
+
+// Status reads the instruction's response file, if any
+func (d *FileDepository) Status(ref string) (DepositoryResult, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, "responses", ref+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return DepositoryResult{Status: DepositoryPending}, nil
+	}
+	if err != nil {
+		return DepositoryResult{}, fmt.Errorf("failed to read depository response: %w", err)
+	}
+
+	var result DepositoryResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return DepositoryResult{}, fmt.Errorf("failed to parse depository response %s: %w", ref, err)
+	}
+	switch result.Status {
+	case DepositoryPending, DepositoryCompleted, DepositoryFailed:
+		return result, nil
+	default:
+		return DepositoryResult{}, fmt.Errorf("unknown depository status %q for %s", result.Status, ref)
+	}
+}
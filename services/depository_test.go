@@ -0,0 +1,63 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFileDepository(t *testing.T) {
+	dir := t.TempDir()
+	depository, err := NewFileDepository(dir)
+	if err != nil {
+		t.Fatalf("NewFileDepository: %v", err)
+	}
+
+	ref, err := depository.Submit(DepositoryInstruction{
+		TransferID:   12,
+		UserID:       1,
+		Symbol:       "TCS",
+		Quantity:     decimal.NewFromInt(2),
+		DematAccount: "IN30012345678901",
+		RequestedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if ref != "TRF-12" {
+		t.Errorf("ref = %s, want TRF-12", ref)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outbox", "TRF-12.json")); err != nil {
+		t.Errorf("instruction not written: %v", err)
+	}
+
+	respond := func(body string) {
+		if err := os.WriteFile(filepath.Join(dir, "responses", ref+".json"), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := depository.Status(ref)
+	if err != nil || result.Status != DepositoryPending {
+		t.Errorf("Status without response = %v, %v; want PENDING", result, err)
+	}
+
+	respond(`{"status": "FAILED", "reason": "account closed"}`)
+	result, err = depository.Status(ref)
+	if err != nil || result.Status != DepositoryFailed || result.Reason != "account closed" {
+		t.Errorf("Status = %v, %v; want FAILED with reason", result, err)
+	}
+
+	respond(`{"status": "LOST"}`)
+	if _, err := depository.Status(ref); err == nil {
+		t.Error("unknown status accepted")
+	}
+
+	respond(`not json`)
+	if _, err := depository.Status(ref); err == nil {
+		t.Error("malformed response accepted")
+	}
+}
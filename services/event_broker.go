@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"stocky-backend/db"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Postgres NOTIFY channels used to fan events out to every instance
+const (
+	PriceEventsChannel    = "stocky_prices"
+	HoldingsEventsChannel = "stocky_holdings"
+)
+
+const (
+	// subscriberBuffer is how many events a slow subscriber may fall behind by
+	subscriberBuffer = 64
+
+	// listenerRetryDelay is the pause before re-establishing a lost LISTEN connection
+	listenerRetryDelay = 5 * time.Second
+)
+
+// PriceEvent is published whenever a price is recorded in price_history
+type PriceEvent struct {
+	ID        uint            `json:"id"`
+	Symbol    string          `json:"symbol"`
+	Price     decimal.Decimal `json:"price"`
+	Currency  string          `json:"currency"`
+	PriceINR  decimal.Decimal `json:"priceInr"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// HoldingsEvent is published whenever a user's ledger holdings change
+type HoldingsEvent struct {
+	UserID int    `json:"userId"`
+	Reason string `json:"reason"`
+}
+
+// Event is a decoded notification delivered to subscribers
+type Event struct {
+	Channel  string
+	Price    *PriceEvent
+	Holdings *HoldingsEvent
+}
+
+// Subscription receives events until it is closed. Events is closed when the
+// broker drops a subscriber that fell too far behind.
+type Subscription struct {
+	Events <-chan Event
+
+	events chan Event
+	filter func(Event) bool
+	broker *EventBroker
+}
+
+// Close unsubscribes
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// EventBroker relays Postgres notifications to in-process subscribers.
+// Writers publish with pg_notify (transactional, so holdings events are only
+// seen once the reward commits) and every instance LISTENs, so streams work
+// no matter which replica recorded the change.
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewEventBroker creates a new event broker
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for events matching filter (nil matches all)
+func (b *EventBroker) Subscribe(filter func(Event) bool) *Subscription {
+	events := make(chan Event, subscriberBuffer)
+	sub := &Subscription{
+		Events: events,
+		events: events,
+		filter: filter,
+		broker: b,
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (b *EventBroker) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// dispatch delivers an event to every matching subscriber
+func (b *EventBroker) dispatch(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Drop lagging subscribers; clients reconnect with Last-Event-ID
+			logrus.Warn("Dropping slow event subscriber")
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Start listens for notifications until ctx is cancelled, reconnecting on failure
+func (b *EventBroker) Start(ctx context.Context) {
+	go func() {
+		for {
+			err := b.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.WithError(err).Warn("Event listener disconnected, retrying")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(listenerRetryDelay):
+			}
+		}
+	}()
+}
+
+// listen holds a dedicated connection in LISTEN mode and dispatches notifications
+func (b *EventBroker) listen(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pgConn := stdConn.Conn()
+
+		for _, channel := range []string{PriceEventsChannel, HoldingsEventsChannel} {
+			if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", channel, err)
+			}
+		}
+		logrus.Info("Event listener connected")
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			event, err := decodeEvent(notification.Channel, notification.Payload)
+			if err != nil {
+				logrus.WithError(err).Warn("Ignoring malformed notification")
+				continue
+			}
+			b.dispatch(event)
+		}
+	})
+}
+
+// decodeEvent parses a notification payload
+func decodeEvent(channel, payload string) (Event, error) {
+	event := Event{Channel: channel}
+
+	switch channel {
+	case PriceEventsChannel:
+		event.Price = &PriceEvent{}
+		return event, json.Unmarshal([]byte(payload), event.Price)
+	case HoldingsEventsChannel:
+		event.Holdings = &HoldingsEvent{}
+		return event, json.Unmarshal([]byte(payload), event.Holdings)
+	default:
+		return event, fmt.Errorf("unknown channel %q", channel)
+	}
+}
+
+// notify publishes a payload with pg_notify on the given connection or transaction
+func notify(tx *gorm.DB, channel string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", channel, string(data)).Error
+}
+
+// notifyHoldingsChanged tells stream subscribers a user's holdings changed.
+// Inside a transaction the notification is delivered on commit.
+func notifyHoldingsChanged(tx *gorm.DB, userID int, reason string) error {
+	return notify(tx, HoldingsEventsChannel, HoldingsEvent{UserID: userID, Reason: reason})
+}
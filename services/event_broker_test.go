@@ -0,0 +1,69 @@
+package services
+
+import "testing"
+
+func TestDecodeEvent(t *testing.T) {
+	event, err := decodeEvent(PriceEventsChannel, `{"id": 7, "symbol": "TCS", "price": "3850.5", "currency": "INR"}`)
+	if err != nil {
+		t.Fatalf("decodeEvent: %v", err)
+	}
+	if event.Price == nil || event.Price.ID != 7 || event.Price.Symbol != "TCS" || event.Price.Price.String() != "3850.5" {
+		t.Errorf("price event = %+v", event.Price)
+	}
+
+	event, err = decodeEvent(HoldingsEventsChannel, `{"userId": 42, "reason": "reward"}`)
+	if err != nil {
+		t.Fatalf("decodeEvent: %v", err)
+	}
+	if event.Holdings == nil || event.Holdings.UserID != 42 || event.Holdings.Reason != "reward" {
+		t.Errorf("holdings event = %+v", event.Holdings)
+	}
+
+	if _, err := decodeEvent("other", `{}`); err == nil {
+		t.Error("unknown channel decoded without error")
+	}
+	if _, err := decodeEvent(PriceEventsChannel, `not json`); err == nil {
+		t.Error("bad payload decoded without error")
+	}
+}
+
+func TestEventBrokerDispatch(t *testing.T) {
+	broker := NewEventBroker()
+	all := broker.Subscribe(nil)
+	defer all.Close()
+	holdings := broker.Subscribe(func(event Event) bool { return event.Holdings != nil })
+	defer holdings.Close()
+
+	broker.dispatch(Event{Channel: PriceEventsChannel, Price: &PriceEvent{ID: 1}})
+	broker.dispatch(Event{Channel: HoldingsEventsChannel, Holdings: &HoldingsEvent{UserID: 2}})
+
+	if got := len(all.Events); got != 2 {
+		t.Errorf("unfiltered subscriber got %d events, want 2", got)
+	}
+	if got := len(holdings.Events); got != 1 {
+		t.Fatalf("filtered subscriber got %d events, want 1", got)
+	}
+	if event := <-holdings.Events; event.Holdings == nil || event.Holdings.UserID != 2 {
+		t.Errorf("filtered subscriber got %+v", event)
+	}
+}
+
+func TestEventBrokerDropsSlowSubscriber(t *testing.T) {
+	broker := NewEventBroker()
+	sub := broker.Subscribe(nil)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		broker.dispatch(Event{Channel: PriceEventsChannel, Price: &PriceEvent{ID: uint(i)}})
+	}
+
+	received := 0
+	for range sub.Events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before the drop, want %d", received, subscriberBuffer)
+	}
+
+	// Closing after the drop is harmless
+	sub.Close()
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUnknownSymbol is returned when a symbol has no stock_config row
+	ErrUnknownSymbol = errors.New("unknown stock symbol")
+
+	// ErrInvalidExposureLimit is returned for a negative or zero threshold
+	ErrInvalidExposureLimit = errors.New("invalid exposure limit")
+)
+
+// SymbolExposure is the number of shares of a symbol the company owes users
+// and their current INR value
+type SymbolExposure struct {
+	Symbol        string              `json:"symbol"`
+	Quantity      decimal.Decimal     `json:"quantity"`
+	PriceINR      decimal.Decimal     `json:"priceInr"`
+	ValueINR      decimal.Decimal     `json:"valueInr"`
+	LimitINR      decimal.NullDecimal `json:"limitInr"`
+	LimitQuantity decimal.NullDecimal `json:"limitQuantity"`
+	Breached      bool                `json:"breached"`
+	Reason        string              `json:"reason,omitempty"`
+}
+
+// ExposureReport is the company's outstanding reward share exposure. Symbols
+// that could not be priced are listed in Unpriced and left out of the total.
+type ExposureReport struct {
+	Symbols       []SymbolExposure `json:"symbols"`
+	Unpriced      []string         `json:"unpriced"`
+	TotalValueINR decimal.Decimal  `json:"totalValueInr"`
+	GeneratedAt   time.Time        `json:"generatedAt"`
+}
+
+// ExposureLimits are the alert thresholds for one symbol; nil disables a check
+type ExposureLimits struct {
+	MaxValueINR *decimal.Decimal
+	MaxQuantity *decimal.Decimal
+}
+
+// ExposureService reports outstanding reward shares and raises alerts when
+// a symbol passes its configured thresholds
+type ExposureService struct {
+	priceService *PriceService
+}
+
+// NewExposureService creates a new exposure service
+func NewExposureService(priceService *PriceService) *ExposureService {
+	return &ExposureService{
+		priceService: priceService,
+	}
+}
+
+// GetExposure sums STOCK entries across all users and values each symbol at
+// its current price. Symbols with a threshold are listed even when nothing is
+// owed; a symbol without a price is skipped and reported rather than failing
+// the whole report.
+func (s *ExposureService) GetExposure() (*ExposureReport, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT le.stock_symbol, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.entry_type = 'STOCK' AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		GROUP BY le.stock_symbol
+		HAVING SUM(le.quantity) > 0
+	`).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate outstanding shares: %w", err)
+	}
+
+	var configs []models.StockConfig
+	err = db.DB.Where("max_exposure_inr IS NOT NULL OR max_exposure_quantity IS NOT NULL").
+		Find(&configs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exposure limits: %w", err)
+	}
+
+	quantities := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		quantities[row.StockSymbol] = row.Quantity
+	}
+	limits := make(map[string]models.StockConfig, len(configs))
+	for _, config := range configs {
+		limits[config.StockSymbol] = config
+		if _, ok := quantities[config.StockSymbol]; !ok {
+			quantities[config.StockSymbol] = decimal.Zero
+		}
+	}
+
+	report := &ExposureReport{
+		Symbols:       make([]SymbolExposure, 0, len(quantities)),
+		Unpriced:      []string{},
+		TotalValueINR: decimal.Zero,
+		GeneratedAt:   utils.NowUTC(),
+	}
+	symbols := holdingSymbols(quantities)
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		exposure := SymbolExposure{
+			Symbol:   symbol,
+			Quantity: quantities[symbol],
+		}
+		if exposure.Quantity.IsPositive() {
+			price, err := s.priceService.GetCurrentPrice(symbol)
+			if err != nil {
+				logrus.WithError(err).WithField("symbol", symbol).Warn("Skipping unpriced symbol in exposure")
+				report.Unpriced = append(report.Unpriced, symbol)
+				continue
+			}
+			exposure.PriceINR = price
+			exposure.ValueINR = utils.RoundINR(price.Mul(exposure.Quantity))
+		}
+		if config, ok := limits[symbol]; ok {
+			exposure.LimitINR = config.MaxExposureINR
+			exposure.LimitQuantity = config.MaxExposureQuantity
+		}
+		exposure.Reason = exposure.breach()
+		exposure.Breached = exposure.Reason != ""
+
+		report.Symbols = append(report.Symbols, exposure)
+		report.TotalValueINR = report.TotalValueINR.Add(exposure.ValueINR)
+	}
+
+	return report, nil
+}
+
+// breach describes which threshold the exposure exceeds, or "" if none
+func (e SymbolExposure) breach() string {
+	var reasons []string
+	if e.LimitINR.Valid && e.ValueINR.GreaterThan(e.LimitINR.Decimal) {
+		reasons = append(reasons, fmt.Sprintf("value %s INR exceeds limit %s INR",
+			e.ValueINR.StringFixed(2), e.LimitINR.Decimal.StringFixed(2)))
+	}
+	if e.LimitQuantity.Valid && e.Quantity.GreaterThan(e.LimitQuantity.Decimal) {
+		reasons = append(reasons, fmt.Sprintf("quantity %s exceeds limit %s",
+			e.Quantity.String(), e.LimitQuantity.Decimal.String()))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// CheckExposure opens an alert for each symbol newly over a threshold and
+// resolves open alerts for symbols back within their limits. Alerts of
+// unpriced symbols are left as they are until a price is available.
+func (s *ExposureService) CheckExposure() error {
+	report, err := s.GetExposure()
+	if err != nil {
+		return err
+	}
+
+	now := utils.NowUTC()
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var open []models.ExposureAlert
+		if err := tx.Where("status = ?", models.ExposureAlertOpen).Find(&open).Error; err != nil {
+			return fmt.Errorf("failed to fetch open exposure alerts: %w", err)
+		}
+		openBySymbol := make(map[string]models.ExposureAlert, len(open))
+		for _, alert := range open {
+			openBySymbol[alert.StockSymbol] = alert
+		}
+		for _, symbol := range report.Unpriced {
+			delete(openBySymbol, symbol)
+		}
+
+		for _, exposure := range report.Symbols {
+			alert, isOpen := openBySymbol[exposure.Symbol]
+			delete(openBySymbol, exposure.Symbol)
+
+			if !exposure.Breached {
+				if isOpen {
+					if err := resolveExposureAlert(tx, alert, now); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if isOpen {
+				continue
+			}
+
+			alert = models.ExposureAlert{
+				StockSymbol:   exposure.Symbol,
+				Quantity:      exposure.Quantity,
+				ValueINR:      exposure.ValueINR,
+				LimitINR:      exposure.LimitINR,
+				LimitQuantity: exposure.LimitQuantity,
+				Reason:        exposure.Reason,
+				Status:        models.ExposureAlertOpen,
+				TriggeredAt:   now,
+			}
+			// A concurrent check (the job, or a limit change) may have opened
+			// the alert since we looked; the unique open-alert index keeps one
+			result := tx.Clauses(clause.OnConflict{
+				Columns:     []clause.Column{{Name: "stock_symbol"}},
+				TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status = 'OPEN'"}}},
+				DoNothing:   true,
+			}).Create(&alert)
+			if result.Error != nil {
+				return fmt.Errorf("failed to save exposure alert: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"alertId":  alert.ID,
+				"symbol":   exposure.Symbol,
+				"quantity": exposure.Quantity,
+				"valueInr": exposure.ValueINR,
+			}).Warnf("Exposure limit breached: %s", exposure.Reason)
+		}
+
+		// Symbols no longer owed at all
+		for _, alert := range openBySymbol {
+			if err := resolveExposureAlert(tx, alert, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolveExposureAlert closes an open alert
+func resolveExposureAlert(tx *gorm.DB, alert models.ExposureAlert, now time.Time) error {
+	err := tx.Model(&alert).Updates(map[string]interface{}{
+		"status":      models.ExposureAlertResolved,
+		"resolved_at": now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to resolve exposure alert: %w", err)
+	}
+	logrus.WithField("symbol", alert.StockSymbol).Info("Exposure back within limits")
+	return nil
+}
+
+// ListExposureAlerts returns alerts, newest first, optionally filtered by status
+func (s *ExposureService) ListExposureAlerts(status models.ExposureAlertStatus) ([]models.ExposureAlert, error) {
+	query := db.DB.Order("triggered_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var alerts []models.ExposureAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch exposure alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// SetExposureLimits replaces a symbol's thresholds and re-checks exposure so
+// the new limits take effect at once
+func (s *ExposureService) SetExposureLimits(symbol string, limits ExposureLimits) (*models.StockConfig, error) {
+	for _, limit := range []*decimal.Decimal{limits.MaxValueINR, limits.MaxQuantity} {
+		if limit != nil && !limit.IsPositive() {
+			return nil, fmt.Errorf("%w: limits must be positive", ErrInvalidExposureLimit)
+		}
+	}
+
+	var config models.StockConfig
+	err := db.DB.Where("stock_symbol = ?", symbol).First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownSymbol
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stock config: %w", err)
+	}
+
+	config.MaxExposureINR = nullDecimal(limits.MaxValueINR)
+	config.MaxExposureQuantity = nullDecimal(limits.MaxQuantity)
+	err = db.DB.Model(&config).Updates(map[string]interface{}{
+		"max_exposure_inr":      config.MaxExposureINR,
+		"max_exposure_quantity": config.MaxExposureQuantity,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save exposure limits: %w", err)
+	}
+
+	if err := s.CheckExposure(); err != nil {
+		logrus.WithError(err).Warn("Failed to re-check exposure after limit change")
+	}
+	return &config, nil
+}
+
+// nullDecimal converts an optional decimal to a nullable column value
+func nullDecimal(value *decimal.Decimal) decimal.NullDecimal {
+	if value == nil {
+		return decimal.NullDecimal{}
+	}
+	return decimal.NewNullDecimal(*value)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSymbolExposureBreach(t *testing.T) {
+	limit := func(value string) decimal.NullDecimal {
+		return decimal.NewNullDecimal(decimal.RequireFromString(value))
+	}
+
+	tests := []struct {
+		name     string
+		exposure SymbolExposure
+		want     string
+	}{
+		{"no limits", SymbolExposure{Quantity: decimal.NewFromInt(10), ValueINR: decimal.NewFromInt(1000)}, ""},
+		{
+			"within limits",
+			SymbolExposure{Quantity: decimal.NewFromInt(10), ValueINR: decimal.NewFromInt(1000), LimitINR: limit("1000"), LimitQuantity: limit("10")},
+			"",
+		},
+		{
+			"value over",
+			SymbolExposure{Quantity: decimal.NewFromInt(10), ValueINR: decimal.RequireFromString("1000.5"), LimitINR: limit("1000")},
+			"value 1000.50 INR exceeds limit 1000.00 INR",
+		},
+		{
+			"both over",
+			SymbolExposure{Quantity: decimal.RequireFromString("10.5"), ValueINR: decimal.NewFromInt(2000), LimitINR: limit("1000"), LimitQuantity: limit("10")},
+			"value 2000.00 INR exceeds limit 1000.00 INR; quantity 10.5 exceeds limit 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.exposure.breach(); got != tt.want {
+				t.Errorf("breach() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExposureOpensOneAlert(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	symbol := "ITC"
+	mustCreate(t, &models.LedgerEntry{
+		UserID:        fixtureUserID,
+		ReferenceType: models.ReferenceSale,
+		Account:       models.AccountUser,
+		EntryType:     models.EntryTypeStock,
+		StockSymbol:   &symbol,
+		Quantity:      decimal.NewFromInt(5),
+		AmountINR:     decimal.NewFromInt(2000),
+		Timestamp:     utils.NowUTC(),
+	})
+
+	service := NewExposureService(NewPriceService(NewMarketCalendar()))
+	maxQuantity := decimal.NewFromInt(1)
+	if _, err := service.SetExposureLimits(symbol, ExposureLimits{MaxQuantity: &maxQuantity}); err != nil {
+		t.Fatalf("SetExposureLimits: %v", err)
+	}
+	if err := service.CheckExposure(); err != nil {
+		t.Fatalf("CheckExposure: %v", err)
+	}
+
+	var open int64
+	db.DB.Model(&models.ExposureAlert{}).
+		Where("stock_symbol = ? AND status = ?", symbol, models.ExposureAlertOpen).
+		Count(&open)
+	if open != 1 {
+		t.Fatalf("open alerts = %d, want 1", open)
+	}
+
+	// A second open alert for the symbol is refused by the database
+	duplicate := models.ExposureAlert{
+		StockSymbol: symbol,
+		Reason:      "duplicate",
+		Status:      models.ExposureAlertOpen,
+		TriggeredAt: utils.NowUTC(),
+	}
+	if err := db.DB.Create(&duplicate).Error; err == nil {
+		t.Error("second open alert was saved, want a unique violation")
+	}
+}
+
+func TestGetExposureSkipsDeletedRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "EXPTEST"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(100),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(100),
+		Timestamp:   now,
+	})
+
+	var deleted models.RewardEvent
+	for _, quantity := range []int64{2, 3} {
+		reward := models.RewardEvent{
+			UserID:      fixtureUserID,
+			StockSymbol: symbol,
+			Quantity:    decimal.NewFromInt(quantity),
+			Timestamp:   now,
+		}
+		mustCreate(t, &reward)
+		entries := rewardLedgerEntries(&reward, newQuote(symbol, "INR", decimal.NewFromInt(100), decimal.NewFromInt(1), now))
+		mustCreate(t, &entries)
+		deleted = reward
+	}
+	if err := db.DB.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewExposureService(NewPriceService(NewMarketCalendar())).GetExposure()
+	if err != nil {
+		t.Fatalf("GetExposure: %v", err)
+	}
+	for _, exposure := range report.Symbols {
+		if exposure.Symbol == symbol {
+			if !exposure.Quantity.Equal(decimal.NewFromInt(2)) {
+				t.Errorf("exposure quantity = %s, want 2", exposure.Quantity)
+			}
+			return
+		}
+	}
+	t.Errorf("no exposure reported for %s", symbol)
+}
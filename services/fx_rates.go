@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownCurrency is returned when no FX rate can be found or generated for a currency
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// instrumentCurrency returns the trading currency configured for a symbol (INR if unset)
+func instrumentCurrency(symbol string) (string, error) {
+	var currencies []string
+	err := db.DB.Model(&models.StockConfig{}).
+		Where("stock_symbol = ?", symbol).
+		Limit(1).
+		Pluck("currency", &currencies).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to load stock currency: %w", err)
+	}
+	if len(currencies) == 0 || currencies[0] == "" {
+		return models.BaseCurrency, nil
+	}
+	return currencies[0], nil
+}
+
+// GetCurrentFxRate returns the latest INR rate for a currency, generating one if none is stored
+func (s *PriceService) GetCurrentFxRate(currency string) (decimal.Decimal, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == models.BaseCurrency {
+		return decimal.NewFromInt(1), nil
+	}
+
+	var rate models.FxRate
+	err := db.DB.Where("currency = ?", currency).
+		Order("timestamp DESC").
+		First(&rate).Error
+	if err == nil {
+		return rate.RateINR, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, fmt.Errorf("failed to fetch FX rate: %w", err)
+	}
+
+	generated := s.generator.GenerateFxRate(currency)
+	if !generated.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownCurrency, currency)
+	}
+	if err := s.SaveFxRate(currency, generated); err != nil {
+		logrus.Warnf("Failed to save generated FX rate: %v", err)
+	}
+	return generated, nil
+}
+
+// GetFxRateAt returns the INR rate for a currency in force at a specific time
+func (s *PriceService) GetFxRateAt(currency string, timestamp time.Time) (decimal.Decimal, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == models.BaseCurrency {
+		return decimal.NewFromInt(1), nil
+	}
+
+	var rate models.FxRate
+	err := db.DB.Where("currency = ? AND timestamp <= ?", currency, timestamp).
+		Order("timestamp DESC").
+		First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Warnf("No FX rate found for %s at %v, using current rate", currency, timestamp)
+			return s.GetCurrentFxRate(currency)
+		}
+		return decimal.Zero, fmt.Errorf("failed to fetch historical FX rate: %w", err)
+	}
+
+	return rate.RateINR, nil
+}
+
+// SaveFxRate records a new INR rate for a currency
+func (s *PriceService) SaveFxRate(currency string, rate decimal.Decimal) error {
+	fxRate := models.FxRate{
+		Currency:  strings.ToUpper(currency),
+		RateINR:   rate.Round(6),
+		Timestamp: utils.NowUTC(),
+	}
+
+	if err := db.DB.Create(&fxRate).Error; err != nil {
+		return fmt.Errorf("failed to save FX rate: %w", err)
+	}
+
+	// Cached quotes carry INR values converted at the old rate
+	s.cache.invalidateAll()
+	return nil
+}
+
+// UpdateAllFxRates generates and saves new rates for every currency an instrument trades in
+func (s *PriceService) UpdateAllFxRates() error {
+	var currencies []string
+	err := db.DB.Model(&models.StockConfig{}).
+		Where("currency <> ?", models.BaseCurrency).
+		Distinct().
+		Pluck("currency", &currencies).Error
+	if err != nil {
+		return fmt.Errorf("failed to load instrument currencies: %w", err)
+	}
+
+	for _, currency := range currencies {
+		rate := s.generator.GenerateFxRate(currency)
+		if !rate.IsPositive() {
+			logrus.Warnf("No FX rate available for %s", currency)
+			continue
+		}
+		if err := s.SaveFxRate(currency, rate); err != nil {
+			logrus.Errorf("Failed to save FX rate for %s: %v", currency, err)
+		}
+	}
+
+	logrus.Infof("Updated FX rates for %d currencies", len(currencies))
+	return nil
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Historical valuation granularities
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// ErrInvalidHistoricalQuery is returned for an unusable window or granularity
+var ErrInvalidHistoricalQuery = errors.New("invalid historical query")
+
+// HistoricalOptions selects the window and spacing of a historical valuation
+type HistoricalOptions struct {
+	// From is the first day (default: the day of the first reward)
+	From *time.Time
+	// To is the last day (default and maximum: yesterday)
+	To *time.Time
+	// Granularity is day, week or month; week and month points are period closes
+	Granularity string
+	// IncludeToday appends today's intraday value at current prices
+	IncludeToday bool
+	// Location draws day boundaries (nil means UTC); it must be an IANA zone
+	Location *time.Location
+	// Breakdown lists each symbol's quantity, price and value at every point
+	Breakdown bool
+}
+
+// valuationPoint is one point of a historical series: the last day of its
+// period within the window (midnight in the series' timezone), and the
+// instant its prices are taken at
+type valuationPoint struct {
+	Date          time.Time
+	ValuationTime time.Time
+}
+
+// periodStart returns the first day of the period containing day (weeks start on Monday)
+func periodStart(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case GranularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+// nextPeriod returns the first day of the period after the one starting at start
+func nextPeriod(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// periodInterval is the Postgres interval matching nextPeriod
+func periodInterval(granularity string) string {
+	switch granularity {
+	case GranularityWeek:
+		return "1 week"
+	case GranularityMonth:
+		return "1 month"
+	default:
+		return "1 day"
+	}
+}
+
+// valuationPoints lists the period closes between two days (inclusive, as
+// midnights in the series' timezone). A period cut short by to closes on to.
+func (s *RewardService) valuationPoints(from, to time.Time, granularity string) []valuationPoint {
+	var points []valuationPoint
+	for start := periodStart(from, granularity); !start.After(to); start = nextPeriod(start, granularity) {
+		date := nextPeriod(start, granularity).AddDate(0, 0, -1)
+		if date.After(to) {
+			date = to
+		}
+		points = append(points, valuationPoint{
+			Date:          date,
+			ValuationTime: s.calendar.LastSessionClose(utils.EndOfDay(date)),
+		})
+	}
+	return points
+}
+
+// historicalPosition is one holding valued at one point of a historical series
+type historicalPosition struct {
+	Point          int
+	StockSymbol    string
+	Quantity       decimal.Decimal
+	Price          decimal.NullDecimal
+	Currency       *string
+	FxRate         decimal.NullDecimal
+	PriceTimestamp *time.Time
+}
+
+// historicalPositionsQuery values a user's holdings for every period in a
+// generated series in one statement:
+//
+//   - periods: one row per local day, week or month, ending at the period
+//     close (or the window end) in the user's timezone, with the calendar's
+//     valuation time for it
+//   - running: the user's quantity per symbol as a window over reward time
+//     (entry time for sales), valid until the symbol's next change
+//   - positions: the running quantity in force at the end of each period
+//   - lateral joins: the last price at or before the valuation time and the
+//     FX rate in force then
+const historicalPositionsQuery = `
+	WITH periods AS (
+		SELECT d.n,
+		       LEAST(d.period_start + ?::text::interval, ?::text::timestamp) AT TIME ZONE ? AS period_end,
+		       (?::text::timestamptz[])[d.n] AS valuation_time
+		FROM generate_series(?::text::timestamp, ?::text::timestamp, ?::text::interval) WITH ORDINALITY AS d(period_start, n)
+	),
+	changes AS (
+		SELECT le.stock_symbol, COALESCE(re.timestamp, le.timestamp) AS timestamp, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		GROUP BY 1, 2
+	),
+	running AS (
+		SELECT stock_symbol,
+		       timestamp AS valid_from,
+		       LEAD(timestamp) OVER w AS valid_to,
+		       SUM(quantity) OVER w AS quantity
+		FROM changes
+		WINDOW w AS (PARTITION BY stock_symbol ORDER BY timestamp)
+	),
+	positions AS (
+		SELECT periods.n, periods.valuation_time, r.stock_symbol, r.quantity
+		FROM periods
+		JOIN running r
+		  ON r.valid_from < periods.period_end
+		 AND (r.valid_to IS NULL OR r.valid_to >= periods.period_end)
+		WHERE r.quantity > 0
+	)
+	SELECT p.n AS point, p.stock_symbol, p.quantity,
+	       ph.price, ph.currency, ph.timestamp AS price_timestamp,
+	       fx.rate_inr AS fx_rate
+	FROM positions p
+	LEFT JOIN LATERAL (
+		SELECT price, currency, timestamp
+		FROM price_history
+		WHERE stock_symbol = p.stock_symbol AND timestamp <= p.valuation_time
+		ORDER BY timestamp DESC
+		LIMIT 1
+	) ph ON TRUE
+	LEFT JOIN LATERAL (
+		SELECT rate_inr
+		FROM fx_rates
+		WHERE currency = ph.currency AND timestamp <= p.valuation_time
+		ORDER BY timestamp DESC
+		LIMIT 1
+	) fx ON TRUE
+	ORDER BY p.n, p.stock_symbol
+`
+
+// loadHistoricalPositions returns the valued holdings at each period close
+// between from and to (midnights in the user's timezone), indexed like
+// valuationPoints. Valuation times come from the market calendar so
+// non-trading days use the last session close.
+func (s *RewardService) loadHistoricalPositions(userID int, from, to time.Time, granularity string) ([]valuationPoint, [][]historicalPosition, error) {
+	points := s.valuationPoints(from, to, granularity)
+	positions := make([][]historicalPosition, len(points))
+	if len(points) == 0 {
+		return points, positions, nil
+	}
+
+	valuationTimes := make([]time.Time, len(points))
+	for i, point := range points {
+		valuationTimes[i] = point.ValuationTime
+	}
+
+	interval := periodInterval(granularity)
+	var rows []historicalPosition
+	err := db.DB.Raw(historicalPositionsQuery,
+		interval,
+		utils.GetDateString(to.AddDate(0, 0, 1)),
+		from.Location().String(),
+		timestampArray(valuationTimes),
+		utils.GetDateString(periodStart(from, granularity)),
+		utils.GetDateString(periodStart(to, granularity)),
+		interval,
+		userID,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch historical positions: %w", err)
+	}
+
+	if err := s.fillMissingPrices(rows); err != nil {
+		return nil, nil, err
+	}
+
+	for _, row := range rows {
+		positions[row.Point-1] = append(positions[row.Point-1], row)
+	}
+	return points, positions, nil
+}
+
+// fillMissingPrices applies the same fallbacks as GetPriceAtTime: a symbol
+// with no price by the valuation time uses its current price, and a currency
+// with no rate by then uses the current rate. Fallback lookups are made once
+// per symbol or currency, not per day.
+func (s *RewardService) fillMissingPrices(rows []historicalPosition) error {
+	missing := make(map[string]bool)
+	for _, row := range rows {
+		if !row.Price.Valid {
+			missing[row.StockSymbol] = true
+		}
+	}
+
+	var current map[string]Quote
+	if len(missing) > 0 {
+		symbols := make([]string, 0, len(missing))
+		for symbol := range missing {
+			logrus.Warnf("No price history found for %s in valuation window, using current price", symbol)
+			symbols = append(symbols, symbol)
+		}
+
+		var err error
+		if current, err = s.priceService.GetCurrentQuotes(symbols); err != nil {
+			return err
+		}
+	}
+
+	rates := make(map[string]decimal.Decimal)
+	for i := range rows {
+		row := &rows[i]
+
+		if !row.Price.Valid {
+			quote, ok := current[row.StockSymbol]
+			if !ok {
+				continue
+			}
+			point := row.Point
+			*row = quotePosition(row.StockSymbol, row.Quantity, quote)
+			row.Point = point
+			continue
+		}
+
+		if row.Currency == nil || *row.Currency == models.BaseCurrency {
+			row.FxRate = decimal.NewNullDecimal(decimal.NewFromInt(1))
+			continue
+		}
+		if row.FxRate.Valid {
+			continue
+		}
+
+		rate, ok := rates[*row.Currency]
+		if !ok {
+			var err error
+			if rate, err = s.priceService.GetCurrentFxRate(*row.Currency); err != nil {
+				return err
+			}
+			rates[*row.Currency] = rate
+		}
+		row.FxRate = decimal.NewNullDecimal(rate)
+	}
+
+	return nil
+}
+
+// quotePosition values a quantity at a quote
+func quotePosition(symbol string, quantity decimal.Decimal, quote Quote) historicalPosition {
+	return historicalPosition{
+		StockSymbol:    symbol,
+		Quantity:       quantity,
+		Price:          decimal.NewNullDecimal(quote.Price),
+		Currency:       &quote.Currency,
+		FxRate:         decimal.NewNullDecimal(quote.FxRate),
+		PriceTimestamp: &quote.Timestamp,
+	}
+}
+
+// summarizePositions returns the total INR value of a point's positions and,
+// with breakdown, one entry per symbol. Symbol values are rounded to 4 dp and
+// any rounding residue is assigned to the largest position, so they always
+// add up to the returned total.
+func summarizePositions(positions []historicalPosition, date time.Time, breakdown bool) (decimal.Decimal, []map[string]interface{}) {
+	totalValue := decimal.Zero
+	values := make([]decimal.Decimal, len(positions))
+	prices := make([]decimal.Decimal, len(positions))
+	priced := make([]bool, len(positions))
+
+	for i, position := range positions {
+		price, ok := position.priceINR()
+		if !ok {
+			logrus.Warnf("Failed to get price for %s at %s", position.StockSymbol, utils.GetDateString(date))
+			continue
+		}
+		prices[i], priced[i] = price, true
+		values[i] = price.Mul(position.Quantity)
+		totalValue = totalValue.Add(values[i])
+	}
+	totalValue = utils.RoundINR(totalValue)
+
+	if !breakdown {
+		return totalValue, nil
+	}
+
+	symbols := make([]map[string]interface{}, 0, len(positions))
+	residue := totalValue
+	largest := -1
+	for i := range positions {
+		if !priced[i] {
+			continue
+		}
+		values[i] = utils.RoundINR(values[i])
+		residue = residue.Sub(values[i])
+		if largest < 0 || values[i].GreaterThan(values[largest]) {
+			largest = i
+		}
+	}
+	if largest >= 0 {
+		values[largest] = values[largest].Add(residue)
+	}
+
+	for i, position := range positions {
+		if !priced[i] {
+			continue
+		}
+		currency := models.BaseCurrency
+		if position.Currency != nil {
+			currency = *position.Currency
+		}
+		symbols = append(symbols, map[string]interface{}{
+			"symbol":         position.StockSymbol,
+			"quantity":       position.Quantity,
+			"closePrice":     prices[i],
+			"currency":       currency,
+			"nativePrice":    position.Price.Decimal,
+			"fxRate":         position.FxRate.Decimal,
+			"valueINR":       values[i],
+			"priceTimestamp": position.PriceTimestamp,
+		})
+	}
+
+	return totalValue, symbols
+}
+
+// priceINR returns the position's INR price, rounded as GetPriceAtTime rounds it
+func (p historicalPosition) priceINR() (decimal.Decimal, bool) {
+	if !p.Price.Valid || !p.FxRate.Valid {
+		return decimal.Zero, false
+	}
+	return utils.RoundINR(p.Price.Decimal.Mul(p.FxRate.Decimal)), true
+}
+
+// timestampArray formats times as a Postgres array literal
+func timestampArray(times []time.Time) string {
+	values := make([]string, len(times))
+	for i, t := range times {
+		values[i] = `"` + t.UTC().Format(time.RFC3339Nano) + `"`
+	}
+	return "{" + strings.Join(values, ",") + "}"
+}
@@ -0,0 +1,407 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	fixtureUserID = 900000001
+	fixtureDays   = 365
+)
+
+// withHistoricalFixture seeds a year of rewards, prices and FX rates and
+// points db.DB at the fixture transaction for the duration of fn
+func withHistoricalFixture(tb testing.TB, fn func(s *RewardService)) {
+	tb.Helper()
+
+	rollback := beginTestTx(tb)
+	defer rollback()
+
+	calendar := NewMarketCalendar()
+	priceService := NewPriceService(calendar)
+	service := NewRewardService(priceService, NewLedgerService(), NewTreasuryService(priceService, calendar, TreasuryConfig{}), NewBrokerService(priceService, nil, calendar, BrokerConfig{}), calendar)
+
+	start := utils.StartOfDayUTC(utils.NowUTC().AddDate(0, 0, -fixtureDays))
+	symbols := map[string]string{"RELIANCE": "INR", "TCS": "INR", "AAPL": "USD"}
+
+	for i := 0; i <= fixtureDays; i++ {
+		day := start.AddDate(0, 0, i)
+		step := decimal.NewFromInt(int64(i))
+
+		// Leave gaps so non-trading days and missing closes are exercised
+		if calendar.IsTradingDay(day) {
+			sessionClose := calendar.SessionClose(day).UTC()
+			for symbol, currency := range symbols {
+				price := decimal.NewFromInt(1000).Add(step)
+				if currency == "USD" {
+					price = decimal.NewFromInt(150).Add(step.Div(decimal.NewFromInt(10)))
+				}
+				mustCreate(tb, &models.PriceHistory{
+					StockSymbol: symbol,
+					Price:       price,
+					Currency:    currency,
+					PriceINR:    price,
+					Timestamp:   sessionClose,
+					Resolution:  models.PriceResolutionDaily,
+				})
+			}
+		}
+		if i%3 == 0 {
+			mustCreate(tb, &models.FxRate{
+				Currency:  "USD",
+				RateINR:   decimal.NewFromFloat(83).Add(step.Div(decimal.NewFromInt(100))),
+				Timestamp: day.Add(6 * time.Hour),
+			})
+		}
+
+		// A reward roughly every four days, rotating through the symbols
+		if i%4 == 0 {
+			symbol := []string{"RELIANCE", "TCS", "AAPL"}[(i/4)%3]
+			reward := models.RewardEvent{
+				UserID:      fixtureUserID,
+				StockSymbol: symbol,
+				Quantity:    decimal.NewFromFloat(1.5),
+				Timestamp:   day.Add(10 * time.Hour),
+			}
+			mustCreate(tb, &reward)
+
+			quote := newQuote(symbol, symbols[symbol], decimal.NewFromInt(1000), decimal.NewFromInt(1), reward.Timestamp)
+			entries := rewardLedgerEntries(&reward, quote)
+			mustCreate(tb, &entries)
+
+			// Reverse every tenth reward
+			if (i/4)%10 == 9 {
+				if err := service.ledgerService.CreateReversalEntries(&reward); err != nil {
+					tb.Fatalf("failed to reverse reward: %v", err)
+				}
+			}
+		}
+	}
+
+	fn(service)
+}
+
+func mustCreate(tb testing.TB, value interface{}) {
+	tb.Helper()
+	if err := db.DB.Create(value).Error; err != nil {
+		tb.Fatalf("failed to create fixture: %v", err)
+	}
+}
+
+// perDayHistoricalINR is the original implementation: one holdings query per
+// day plus one price lookup per held symbol per day
+func perDayHistoricalINR(s *RewardService, userID int) ([]map[string]interface{}, error) {
+	var firstReward models.RewardEvent
+	if err := db.DB.Where("user_id = ?", userID).Order("timestamp ASC").First(&firstReward).Error; err != nil {
+		return nil, err
+	}
+
+	var result []map[string]interface{}
+	for _, date := range utils.GetPastDates(utils.StartOfDayUTC(firstReward.Timestamp), utils.GetYesterday()) {
+		endOfDate := utils.EndOfDayUTC(date)
+
+		holdings, err := s.ledgerService.GetUserStockHoldingsUpToDate(userID, endOfDate)
+		if err != nil {
+			return nil, err
+		}
+
+		valuationTime := s.calendar.LastSessionClose(endOfDate)
+		totalValue := decimal.Zero
+		for symbol, qty := range holdings {
+			price, err := s.priceService.GetPriceAtTime(symbol, valuationTime)
+			if err != nil {
+				continue
+			}
+			totalValue = totalValue.Add(price.Mul(qty))
+		}
+
+		result = append(result, map[string]interface{}{
+			"date":       utils.GetDateString(date),
+			"valueINR":   utils.RoundINR(totalValue),
+			"tradingDay": s.calendar.IsTradingDay(date),
+		})
+	}
+	return result, nil
+}
+
+func TestGetHistoricalINRMatchesPerDayValuation(t *testing.T) {
+	withHistoricalFixture(t, func(s *RewardService) {
+		want, err := perDayHistoricalINR(s, fixtureUserID)
+		if err != nil {
+			t.Fatalf("per-day valuation failed: %v", err)
+		}
+
+		got, err := s.GetHistoricalINR(fixtureUserID, HistoricalOptions{Location: time.UTC})
+		if err != nil {
+			t.Fatalf("GetHistoricalINR failed: %v", err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("got %d days, want %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i]["date"] != want[i]["date"] || got[i]["tradingDay"] != want[i]["tradingDay"] {
+				t.Fatalf("day %d: got %v, want %v", i, got[i], want[i])
+			}
+			if !got[i]["valueINR"].(decimal.Decimal).Equal(want[i]["valueINR"].(decimal.Decimal)) {
+				t.Errorf("%s: got value %s, want %s", want[i]["date"], got[i]["valueINR"], want[i]["valueINR"])
+			}
+		}
+	})
+}
+
+func TestGetHistoricalINRBreakdownAddsUp(t *testing.T) {
+	withHistoricalFixture(t, func(s *RewardService) {
+		days, err := s.GetHistoricalINR(fixtureUserID, HistoricalOptions{Location: time.UTC, Breakdown: true})
+		if err != nil {
+			t.Fatalf("GetHistoricalINR failed: %v", err)
+		}
+
+		for _, day := range days {
+			sum := decimal.Zero
+			for _, symbol := range day["symbols"].([]map[string]interface{}) {
+				sum = sum.Add(symbol["valueINR"].(decimal.Decimal))
+			}
+			if !sum.Equal(day["valueINR"].(decimal.Decimal)) {
+				t.Errorf("%s: symbols add up to %s, want %s", day["date"], sum, day["valueINR"])
+			}
+		}
+	})
+}
+
+func TestGetHistoricalINRTradingDayInUserZone(t *testing.T) {
+	withHistoricalFixture(t, func(s *RewardService) {
+		// Midnight in +09:00 is the previous evening in IST
+		tokyo := time.FixedZone("+09:00", 9*3600)
+		days, err := s.GetHistoricalINR(fixtureUserID, HistoricalOptions{Location: tokyo})
+		if err != nil {
+			t.Fatalf("GetHistoricalINR failed: %v", err)
+		}
+
+		for _, day := range days {
+			date, err := time.Parse("2006-01-02", day["date"].(string))
+			if err != nil {
+				t.Fatalf("bad date %v: %v", day["date"], err)
+			}
+			weekday := date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+			if day["tradingDay"] != weekday {
+				t.Errorf("%s (%s): tradingDay = %v, want %v", day["date"], date.Weekday(), day["tradingDay"], weekday)
+			}
+		}
+	})
+}
+
+func BenchmarkGetHistoricalINR(b *testing.B) {
+	withHistoricalFixture(b, func(s *RewardService) {
+		b.Run("per-day", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := perDayHistoricalINR(s, fixtureUserID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run("set-based", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetHistoricalINR(fixtureUserID, HistoricalOptions{Location: time.UTC}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestTimestampArray(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	got := timestampArray([]time.Time{
+		time.Date(2024, 5, 2, 15, 30, 0, 0, ist),
+		time.Date(2024, 5, 3, 10, 0, 0, 500, time.UTC),
+	})
+	if want := `{"2024-05-02T10:00:00Z","2024-05-03T10:00:00.0000005Z"}`; got != want {
+		t.Errorf("timestampArray = %s, want %s", got, want)
+	}
+	if got := timestampArray(nil); got != "{}" {
+		t.Errorf("timestampArray(nil) = %s, want {}", got)
+	}
+}
+
+func TestHistoricalPositionPriceINR(t *testing.T) {
+	position := historicalPosition{
+		Price:  decimal.NewNullDecimal(decimal.RequireFromString("182.123")),
+		FxRate: decimal.NewNullDecimal(decimal.RequireFromString("83.456789")),
+	}
+	price, ok := position.priceINR()
+	if want := decimal.RequireFromString("15199.4008"); !ok || !price.Equal(want) {
+		t.Errorf("priceINR = %s, %v; want %s", price, ok, want)
+	}
+
+	// No close or no FX rate leaves the position unpriced
+	if _, ok := (historicalPosition{FxRate: position.FxRate}).priceINR(); ok {
+		t.Error("position without a price was priced")
+	}
+	if _, ok := (historicalPosition{Price: position.Price}).priceINR(); ok {
+		t.Error("position without an FX rate was priced")
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	// 2024-05-02 is a Thursday
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		granularity string
+		start       string
+		next        string
+	}{
+		{GranularityDay, "2024-05-02", "2024-05-03"},
+		{GranularityWeek, "2024-04-29", "2024-05-06"},
+		{GranularityMonth, "2024-05-01", "2024-06-01"},
+	}
+
+	for _, tt := range tests {
+		start := periodStart(day, tt.granularity)
+		if got := utils.GetDateString(start); got != tt.start {
+			t.Errorf("periodStart(%s) = %s, want %s", tt.granularity, got, tt.start)
+		}
+		if got := utils.GetDateString(nextPeriod(start, tt.granularity)); got != tt.next {
+			t.Errorf("nextPeriod(%s) = %s, want %s", tt.granularity, got, tt.next)
+		}
+	}
+
+	// A Sunday belongs to the week that started the Monday before
+	sunday := time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)
+	if got := utils.GetDateString(periodStart(sunday, GranularityWeek)); got != "2024-04-29" {
+		t.Errorf("periodStart(sunday) = %s, want 2024-04-29", got)
+	}
+}
+
+func TestValuationPoints(t *testing.T) {
+	calendar := NewMarketCalendar()
+	service := &RewardService{calendar: calendar}
+	day := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name        string
+		from, to    string
+		granularity string
+		dates       []string
+		closes      []string
+	}{
+		{
+			name: "weekly, last week cut short", from: "2024-05-01", to: "2024-05-14", granularity: GranularityWeek,
+			dates:  []string{"2024-05-05", "2024-05-12", "2024-05-14"},
+			closes: []string{"2024-05-03 15:30", "2024-05-10 15:30", "2024-05-14 15:30"},
+		},
+		{
+			name: "monthly", from: "2024-01-15", to: "2024-03-10", granularity: GranularityMonth,
+			dates:  []string{"2024-01-31", "2024-02-29", "2024-03-10"},
+			closes: []string{"2024-01-31 15:30", "2024-02-29 15:30", "2024-03-08 15:30"},
+		},
+		{
+			name: "daily over a weekend", from: "2024-05-03", to: "2024-05-05", granularity: GranularityDay,
+			dates:  []string{"2024-05-03", "2024-05-04", "2024-05-05"},
+			closes: []string{"2024-05-03 15:30", "2024-05-03 15:30", "2024-05-03 15:30"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := service.valuationPoints(day(tt.from), day(tt.to), tt.granularity)
+			if len(points) != len(tt.dates) {
+				t.Fatalf("got %d points, want %d", len(points), len(tt.dates))
+			}
+			for i, point := range points {
+				if got := utils.GetDateString(point.Date); got != tt.dates[i] {
+					t.Errorf("point %d date = %s, want %s", i, got, tt.dates[i])
+				}
+				if want := istTime(t, tt.closes[i]); !point.ValuationTime.Equal(want) {
+					t.Errorf("point %d valued at %s, want %s", i, point.ValuationTime.In(calendar.Location()), tt.closes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalendarDate(t *testing.T) {
+	if calendarDate(nil, time.UTC) != nil {
+		t.Error("calendarDate(nil) is not nil")
+	}
+
+	tokyo := time.FixedZone("+09:00", 9*3600)
+	at := time.Date(2024, 5, 2, 23, 30, 0, 0, time.UTC)
+	got := calendarDate(&at, tokyo)
+	if want := time.Date(2024, 5, 2, 0, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("calendarDate = %s, want %s", got, want)
+	}
+}
+
+func TestGetHistoricalINRValidation(t *testing.T) {
+	service := &RewardService{calendar: NewMarketCalendar()}
+	from := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, opts := range []HistoricalOptions{
+		{Granularity: "year"},
+		{From: &from, To: &to},
+	} {
+		if _, err := service.GetHistoricalINR(fixtureUserID, opts); !errors.Is(err, ErrInvalidHistoricalQuery) {
+			t.Errorf("GetHistoricalINR(%+v) err = %v, want ErrInvalidHistoricalQuery", opts, err)
+		}
+	}
+}
+
+func TestSummarizePositions(t *testing.T) {
+	position := func(symbol, quantity, price string) historicalPosition {
+		return quotePosition(symbol, decimal.RequireFromString(quantity), Quote{
+			Price:    decimal.RequireFromString(price),
+			Currency: "INR",
+			FxRate:   decimal.NewFromInt(1),
+		})
+	}
+	unpriced := historicalPosition{StockSymbol: "WIPRO", Quantity: decimal.NewFromInt(1)}
+	positions := []historicalPosition{
+		position("TCS", "0.00004", "1"),
+		position("INFY", "0.00004", "1"),
+		unpriced,
+		position("RELIANCE", "0.00001", "100"),
+	}
+	date := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+
+	total, symbols := summarizePositions(positions, date, false)
+	if want := decimal.RequireFromString("0.0011"); !total.Equal(want) {
+		t.Errorf("total = %s, want %s", total, want)
+	}
+	if symbols != nil {
+		t.Errorf("symbols without breakdown = %v, want nil", symbols)
+	}
+
+	// Rounded symbol values lose 0.0001, which goes to the largest position
+	_, symbols = summarizePositions(positions, date, true)
+	want := map[string]string{"TCS": "0", "INFY": "0", "RELIANCE": "0.0011"}
+	if len(symbols) != len(want) {
+		t.Fatalf("got %d symbols, want %d (unpriced left out)", len(symbols), len(want))
+	}
+	sum := decimal.Zero
+	for _, symbol := range symbols {
+		value := symbol["valueINR"].(decimal.Decimal)
+		sum = sum.Add(value)
+		if !value.Equal(decimal.RequireFromString(want[symbol["symbol"].(string)])) {
+			t.Errorf("%s value = %s, want %s", symbol["symbol"], value, want[symbol["symbol"].(string)])
+		}
+	}
+	if !sum.Equal(total) {
+		t.Errorf("symbols add up to %s, want %s", sum, total)
+	}
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrHoldingReconciliationExists is returned when a statement date was already reconciled
+	ErrHoldingReconciliationExists = errors.New("holding statement already reconciled for this date")
+
+	// ErrHoldingReconciliationNotFound is returned when no statement was reconciled for a date
+	ErrHoldingReconciliationNotFound = errors.New("holding reconciliation not found")
+)
+
+// HoldingReconciliationReport is a reconciliation run with its per-symbol checks
+type HoldingReconciliationReport struct {
+	Reconciliation models.HoldingReconciliation `json:"reconciliation"`
+	Checks         []models.HoldingCheck        `json:"checks"`
+}
+
+// HoldingReconciliationService compares the depository holding statement of
+// the company's pool account with the shares the ledger says it should hold
+type HoldingReconciliationService struct {
+	ledgerService *LedgerService
+	calendar      *MarketCalendar
+}
+
+// NewHoldingReconciliationService creates a new holding reconciliation service
+func NewHoldingReconciliationService(ledgerService *LedgerService, calendar *MarketCalendar) *HoldingReconciliationService {
+	return &HoldingReconciliationService{
+		ledgerService: ledgerService,
+		calendar:      calendar,
+	}
+}
+
+// Import reads a holding statement CSV with columns symbol and quantity (other
+// columns such as isin are ignored; rows for the same symbol, e.g. free and
+// pledged balances, are summed) and reconciles it against the ledger as of the
+// end of statementDate (YYYY-MM-DD, IST). Each symbol expects users' holdings
+// plus treasury inventory plus shares the company retained; the pool rounds fractional entitlements up, so up
+// to one share over is MATCHED, and a shortfall covered by shares awaiting
+// settlement is TIMING. Anything else is a BREAK. A date already reconciled is
+// replaced only if overwrite is set.
+func (s *HoldingReconciliationService) Import(r io.Reader, statementDate, fileName string, overwrite bool) (*HoldingReconciliationReport, error) {
+	date, err := time.ParseInLocation("2006-01-02", statementDate, s.calendar.Location())
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid statement date, use YYYY-MM-DD", ErrInvalidImportFile)
+	}
+	if date.After(utils.NowUTC()) {
+		return nil, fmt.Errorf("%w: statement date is in the future", ErrInvalidImportFile)
+	}
+
+	depository, err := parseHoldingStatement(r)
+	if err != nil {
+		return nil, err
+	}
+
+	endOfDay := utils.EndOfDayIn(date, s.calendar.Location())
+	ledger, err := s.ledgerService.GetTotalStockHoldingsUpToDate(endOfDay)
+	if err != nil {
+		return nil, err
+	}
+	unsettled, err := s.ledgerService.GetTotalUnsettledHoldingsAt(endOfDay, statementDate)
+	if err != nil {
+		return nil, err
+	}
+	treasury, err := treasuryHoldingsAt(endOfDay)
+	if err != nil {
+		return nil, err
+	}
+	retained, err := retainedHoldingsAt(endOfDay)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make(map[string]bool)
+	for _, holdings := range []map[string]decimal.Decimal{depository, ledger, treasury, retained} {
+		for symbol := range holdings {
+			symbols[symbol] = true
+		}
+	}
+
+	report := &HoldingReconciliationReport{
+		Reconciliation: models.HoldingReconciliation{
+			StatementDate: statementDate,
+			FileName:      fileName,
+		},
+	}
+	for symbol := range symbols {
+		_, present := depository[symbol]
+		check := checkHolding(symbol, depository[symbol], ledger[symbol], unsettled[symbol], treasury[symbol], retained[symbol])
+		check.StatementDate = statementDate
+		check.Present = present
+
+		switch check.Status {
+		case models.HoldingCheckBreak:
+			report.Reconciliation.Breaks++
+		case models.HoldingCheckTiming:
+			report.Reconciliation.Timing++
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	sort.Slice(report.Checks, func(i, j int) bool {
+		return report.Checks[i].StockSymbol < report.Checks[j].StockSymbol
+	})
+	report.Reconciliation.Symbols = len(report.Checks)
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.HoldingReconciliation
+		err := tx.Where("statement_date = ?", statementDate).First(&existing).Error
+		switch {
+		case err == nil:
+			if !overwrite {
+				return ErrHoldingReconciliationExists
+			}
+			if err := tx.Where("reconciliation_id = ?", existing.ID).Delete(&models.HoldingCheck{}).Error; err != nil {
+				return fmt.Errorf("failed to delete previous checks: %w", err)
+			}
+			if err := tx.Delete(&existing).Error; err != nil {
+				return fmt.Errorf("failed to delete previous reconciliation: %w", err)
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return fmt.Errorf("failed to fetch reconciliation: %w", err)
+		}
+
+		if err := tx.Create(&report.Reconciliation).Error; err != nil {
+			return fmt.Errorf("failed to save reconciliation: %w", err)
+		}
+		for i := range report.Checks {
+			report.Checks[i].ReconciliationID = report.Reconciliation.ID
+		}
+		if len(report.Checks) > 0 {
+			if err := tx.Create(&report.Checks).Error; err != nil {
+				return fmt.Errorf("failed to save holding checks: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := logrus.WithFields(logrus.Fields{
+		"statementDate": statementDate,
+		"symbols":       report.Reconciliation.Symbols,
+		"breaks":        report.Reconciliation.Breaks,
+		"timing":        report.Reconciliation.Timing,
+	})
+	if report.Reconciliation.Breaks > 0 {
+		entry.Warn("Depository holdings do not match the ledger")
+	} else {
+		entry.Info("Depository holdings reconciled")
+	}
+
+	return report, nil
+}
+
+// checkHolding compares one symbol's depository balance with the ledger
+func checkHolding(symbol string, depository, ledger, unsettled, treasury, retained decimal.Decimal) models.HoldingCheck {
+	expected := ledger.Add(treasury).Add(retained)
+	difference := depository.Sub(expected)
+
+	status := models.HoldingCheckBreak
+	switch {
+	case !difference.IsNegative() && difference.LessThan(decimal.NewFromInt(1)):
+		status = models.HoldingCheckMatched
+	case difference.IsNegative() && !difference.Add(unsettled).IsNegative():
+		status = models.HoldingCheckTiming
+	}
+
+	return models.HoldingCheck{
+		StockSymbol:        symbol,
+		DepositoryQuantity: depository,
+		LedgerQuantity:     ledger,
+		UnsettledQuantity:  unsettled,
+		TreasuryQuantity:   treasury,
+		RetainedQuantity:   retained,
+		ExpectedQuantity:   expected,
+		Difference:         difference,
+		Status:             status,
+	}
+}
+
+// treasuryHoldingsAt returns treasury inventory per symbol at endDate: lots
+// bought by then less the shares drawn from them by then. Draws are dated by
+// when the allocation was made, so queued rewards count from their issue and
+// returned shares from their reversal.
+func treasuryHoldingsAt(endDate time.Time) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT tl.stock_symbol,
+		       SUM(tl.quantity) - COALESCE(SUM(drawn.quantity), 0) AS quantity
+		FROM treasury_lots tl
+		LEFT JOIN (
+			SELECT ta.lot_id, SUM(ta.quantity) AS quantity
+			FROM treasury_allocations ta
+			WHERE ta.created_at <= ?
+			GROUP BY ta.lot_id
+		) drawn ON drawn.lot_id = tl.id
+		WHERE tl.purchased_at <= ?
+		GROUP BY tl.stock_symbol
+		HAVING SUM(tl.quantity) - COALESCE(SUM(drawn.quantity), 0) > 0
+	`, endDate, endDate).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch treasury holdings: %w", err)
+	}
+
+	holdings := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		holdings[row.StockSymbol] = row.Quantity
+	}
+	return holdings, nil
+}
+
+// retainedHoldingsAt returns per symbol the shares that left users' ledger
+// but stayed in the pool by endDate: shares users sold to the company, and
+// shares bought by filled broker orders for rewards cancelled by then (a
+// reward cancelled after endDate is still in its user's holdings).
+func retainedHoldingsAt(endDate time.Time) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT stock_symbol, SUM(quantity) AS quantity
+		FROM (
+			SELECT s.stock_symbol, s.quantity
+			FROM sales s
+			WHERE s.timestamp <= ?
+			UNION ALL
+			SELECT boa.stock_symbol, boa.quantity
+			FROM broker_order_allocations boa
+			JOIN broker_orders bo ON bo.id = boa.order_id
+			JOIN reward_events re ON re.id = boa.reward_event_id
+			WHERE bo.status = ? AND bo.filled_at <= ? AND re.deleted_at <= ?
+		) kept
+		GROUP BY stock_symbol
+	`, endDate, models.BrokerOrderFilled, endDate, endDate).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch retained holdings: %w", err)
+	}
+
+	holdings := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		holdings[row.StockSymbol] = row.Quantity
+	}
+	return holdings, nil
+}
+
+// parseHoldingStatement reads the statement CSV into quantities per symbol.
+// Any invalid row rejects the file, as a partial statement would show breaks
+// that are not there.
+func parseHoldingStatement(r io.Reader) (map[string]decimal.Decimal, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImportFile)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"symbol", "quantity"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must include %s", ErrInvalidImportFile, required)
+		}
+	}
+
+	holdings := make(map[string]decimal.Decimal)
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		if columns["symbol"] >= len(fields) || columns["quantity"] >= len(fields) {
+			return nil, fmt.Errorf("%w: row %d is missing columns", ErrInvalidImportFile, line)
+		}
+
+		symbol := strings.ToUpper(strings.TrimSpace(fields[columns["symbol"]]))
+		if err := utils.ValidateStockSymbol(symbol); err != nil {
+			return nil, fmt.Errorf("%w: row %d: %v", ErrInvalidImportFile, line, err)
+		}
+		raw := strings.TrimSpace(fields[columns["quantity"]])
+		quantity, err := decimal.NewFromString(raw)
+		if err != nil || quantity.IsNegative() {
+			return nil, fmt.Errorf("%w: row %d: invalid quantity %q", ErrInvalidImportFile, line, raw)
+		}
+
+		holdings[symbol] = holdings[symbol].Add(quantity)
+	}
+	return holdings, nil
+}
+
+// ListReconciliations returns reconciliation runs, newest statement first
+func (s *HoldingReconciliationService) ListReconciliations() ([]models.HoldingReconciliation, error) {
+	var runs []models.HoldingReconciliation
+	if err := db.DB.Order("statement_date DESC").Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch reconciliations: %w", err)
+	}
+	return runs, nil
+}
+
+// GetReconciliation returns the break report for a statement date. With
+// breaksOnly, MATCHED symbols are left out.
+func (s *HoldingReconciliationService) GetReconciliation(statementDate string, breaksOnly bool) (*HoldingReconciliationReport, error) {
+	var report HoldingReconciliationReport
+	err := db.DB.Where("statement_date = ?", statementDate).First(&report.Reconciliation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldingReconciliationNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch reconciliation: %w", err)
+	}
+
+	query := db.DB.Where("reconciliation_id = ?", report.Reconciliation.ID)
+	if breaksOnly {
+		query = query.Where("status <> ?", models.HoldingCheckMatched)
+	}
+	if err := query.Order("stock_symbol").Find(&report.Checks).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch holding checks: %w", err)
+	}
+	return &report, nil
+}
+
+// GetSymbolHistory returns a symbol's checks across statements, newest first
+func (s *HoldingReconciliationService) GetSymbolHistory(symbol string, limit int) ([]models.HoldingCheck, error) {
+	var checks []models.HoldingCheck
+	err := db.DB.Where("stock_symbol = ?", symbol).
+		Order("statement_date DESC").
+		Limit(limit).
+		Find(&checks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch holding history: %w", err)
+	}
+	return checks, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCheckHolding(t *testing.T) {
+	tests := []struct {
+		name       string
+		depository string
+		ledger     string
+		unsettled  string
+		treasury   string
+		retained   string
+		want       models.HoldingCheckStatus
+	}{
+		{"exact", "12", "10", "0", "2", "0", models.HoldingCheckMatched},
+		{"retained shares", "15", "10", "0", "2", "3", models.HoldingCheckMatched},
+		{"fraction rounded up", "11", "10.4", "0", "0", "0", models.HoldingCheckMatched},
+		{"one share over", "11", "10", "0", "0", "0", models.HoldingCheckBreak},
+		{"short by unsettled shares", "8", "10", "3", "0", "0", models.HoldingCheckTiming},
+		{"short by exactly the unsettled shares", "7", "10", "3", "0", "0", models.HoldingCheckTiming},
+		{"short beyond unsettled shares", "6", "10", "3", "0", "0", models.HoldingCheckBreak},
+		{"missing from the statement", "0", "5", "0", "0", "0", models.HoldingCheckBreak},
+		{"not in the ledger", "4", "0", "0", "0", "0", models.HoldingCheckBreak},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkHolding("TCS",
+				decimal.RequireFromString(tt.depository),
+				decimal.RequireFromString(tt.ledger),
+				decimal.RequireFromString(tt.unsettled),
+				decimal.RequireFromString(tt.treasury),
+				decimal.RequireFromString(tt.retained))
+			if check.Status != tt.want {
+				t.Errorf("status = %s, want %s (difference %s)", check.Status, tt.want, check.Difference)
+			}
+			expected := decimal.RequireFromString(tt.ledger).Add(decimal.RequireFromString(tt.treasury)).
+				Add(decimal.RequireFromString(tt.retained))
+			if !check.ExpectedQuantity.Equal(expected) {
+				t.Errorf("expected = %s, want %s", check.ExpectedQuantity, expected)
+			}
+		})
+	}
+}
+
+func TestParseHoldingStatement(t *testing.T) {
+	holdings, err := parseHoldingStatement(strings.NewReader(
+		"Symbol, ISIN, Quantity\n" +
+			"tcs, INE467B01029, 1200\n" +
+			"TCS, INE467B01029, 50\n" +
+			"INFY, INE009A01021, 0\n"))
+	if err != nil {
+		t.Fatalf("parseHoldingStatement: %v", err)
+	}
+	if len(holdings) != 2 {
+		t.Errorf("got %d symbols, want 2", len(holdings))
+	}
+	if want := decimal.NewFromInt(1250); !holdings["TCS"].Equal(want) {
+		t.Errorf("TCS = %s, want %s", holdings["TCS"], want)
+	}
+
+	invalid := []struct {
+		name string
+		file string
+	}{
+		{"empty", ""},
+		{"no quantity column", "symbol,isin\nTCS,INE467B01029\n"},
+		{"short row", "symbol,quantity\nTCS\n"},
+		{"negative quantity", "symbol,quantity\nTCS,-1\n"},
+		{"bad quantity", "symbol,quantity\nTCS,many\n"},
+		{"blank symbol", "symbol,quantity\n,5\n"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHoldingStatement(strings.NewReader(tt.file)); !errors.Is(err, ErrInvalidImportFile) {
+				t.Errorf("err = %v, want ErrInvalidImportFile", err)
+			}
+		})
+	}
+}
+
+func TestTreasuryHoldingsAt(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	day := func(n int) time.Time {
+		return time.Date(2024, 5, n, 10, 0, 0, 0, time.UTC)
+	}
+	lot := models.TreasuryLot{
+		StockSymbol:       "RECONTEST",
+		Quantity:          decimal.NewFromInt(10),
+		RemainingQuantity: decimal.NewFromInt(8),
+		Price:             decimal.NewFromInt(100),
+		CostINR:           decimal.NewFromInt(1000),
+		PurchasedAt:       day(1),
+	}
+	mustCreate(t, &lot)
+
+	// A reward made on day 1 was queued and only drew its shares on day 3,
+	// then was reversed on day 4
+	reward := models.RewardEvent{
+		UserID:      fixtureUserID,
+		StockSymbol: lot.StockSymbol,
+		Quantity:    decimal.NewFromInt(3),
+		Status:      models.RewardStatusIssued,
+		Timestamp:   day(1),
+	}
+	mustCreate(t, &reward)
+	mustCreate(t, &models.TreasuryAllocation{RewardEventID: reward.ID, LotID: lot.ID, Quantity: decimal.NewFromInt(3), CostINR: decimal.NewFromInt(300), CreatedAt: day(3)})
+	mustCreate(t, &models.TreasuryAllocation{RewardEventID: reward.ID, LotID: lot.ID, Quantity: decimal.NewFromInt(-1), CostINR: decimal.NewFromInt(-100), CreatedAt: day(4)})
+
+	for _, tt := range []struct {
+		at   time.Time
+		want string
+	}{
+		{day(2), "10"},
+		{day(3), "7"},
+		{day(5), "8"},
+	} {
+		holdings, err := treasuryHoldingsAt(tt.at)
+		if err != nil {
+			t.Fatalf("treasuryHoldingsAt: %v", err)
+		}
+		if got := holdings[lot.StockSymbol]; !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("holding at %s = %s, want %s", tt.at.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestImportCountsRetainedShares(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "RETAINTEST"
+	rewardedAt := istTime(t, "2024-05-02 10:00")
+	quote := newQuote(symbol, "INR", decimal.NewFromInt(100), decimal.NewFromInt(1), rewardedAt)
+
+	// The user was rewarded 5 shares and sold 2 of them back the same day
+	reward := models.RewardEvent{
+		UserID:      fixtureUserID,
+		StockSymbol: symbol,
+		Quantity:    decimal.NewFromInt(5),
+		Status:      models.RewardStatusIssued,
+		Timestamp:   rewardedAt,
+	}
+	mustCreate(t, &reward)
+	entries := rewardLedgerEntries(&reward, quote)
+	mustCreate(t, &entries)
+
+	gross, fees, net, err := saleAmounts(quote.PriceINR, decimal.NewFromInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sale := models.Sale{
+		UserID:      fixtureUserID,
+		StockSymbol: symbol,
+		Quantity:    decimal.NewFromInt(2),
+		Price:       quote.Price,
+		Currency:    quote.Currency,
+		FxRate:      quote.FxRate,
+		PriceINR:    quote.PriceINR,
+		GrossINR:    gross,
+		FeesINR:     fees,
+		NetINR:      net,
+		Timestamp:   rewardedAt.Add(time.Hour),
+	}
+	mustCreate(t, &sale)
+	saleEntries := saleLedgerEntries(&sale)
+	mustCreate(t, &saleEntries)
+
+	// Another reward was cancelled before its broker order filled
+	cancelled := models.RewardEvent{
+		UserID:      fixtureUserID,
+		StockSymbol: symbol,
+		Quantity:    decimal.NewFromInt(1),
+		Status:      models.RewardStatusIssued,
+		Timestamp:   rewardedAt,
+	}
+	mustCreate(t, &cancelled)
+	filledAt := rewardedAt.Add(2 * time.Hour)
+	order := models.BrokerOrder{
+		StockSymbol:       symbol,
+		Quantity:          decimal.NewFromInt(1),
+		Status:            models.BrokerOrderFilled,
+		EstimatedPrice:    quote.Price,
+		EstimatedPriceINR: quote.PriceINR,
+		EstimatedFeesINR:  decimal.Zero,
+		PlacedAt:          rewardedAt,
+		FilledAt:          &filledAt,
+	}
+	mustCreate(t, &order)
+	mustCreate(t, &models.BrokerOrderAllocation{OrderID: &order.ID, RewardEventID: cancelled.ID, StockSymbol: symbol, Quantity: decimal.NewFromInt(1)})
+	if err := db.DB.Delete(&cancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewHoldingReconciliationService(NewLedgerService(), NewMarketCalendar())
+	report, err := service.Import(strings.NewReader("symbol,quantity\n"+symbol+",6\n"), "2024-05-02", "statement.csv", true)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	var check *models.HoldingCheck
+	for i := range report.Checks {
+		if report.Checks[i].StockSymbol == symbol {
+			check = &report.Checks[i]
+		}
+	}
+	if check == nil {
+		t.Fatalf("no check for %s", symbol)
+	}
+	if !check.LedgerQuantity.Equal(decimal.NewFromInt(3)) || !check.RetainedQuantity.Equal(decimal.NewFromInt(3)) {
+		t.Errorf("ledger = %s, retained = %s, want 3 and 3", check.LedgerQuantity, check.RetainedQuantity)
+	}
+	if check.Status != models.HoldingCheckMatched {
+		t.Errorf("status = %s, want MATCHED (difference %s)", check.Status, check.Difference)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // LedgerService handles ledger entry operations
@@ -20,60 +21,20 @@ func NewLedgerService() *LedgerService {
 }
 
 // CreateLedgerEntries creates double-entry accounting entries for a reward
-func (s *LedgerService) CreateLedgerEntries(rewardEvent *models.RewardEvent, pricePerShare decimal.Decimal) error {
-	quantity := rewardEvent.Quantity
-	symbol := rewardEvent.StockSymbol
-	timestamp := rewardEvent.Timestamp
-
-	// Calculate total stock value
-	totalValue := pricePerShare.Mul(quantity)
-	totalValue = utils.RoundINR(totalValue)
-
-	// Calculate fees
-	brokerage, stt, gst, totalFees := utils.CalculateFees(pricePerShare, quantity)
+func (s *LedgerService) CreateLedgerEntries(rewardEvent *models.RewardEvent, quote Quote) error {
+	entries := rewardLedgerEntries(rewardEvent, quote)
 
 	logrus.WithFields(logrus.Fields{
 		"rewardEventId": rewardEvent.ID,
-		"symbol":        symbol,
-		"quantity":      quantity,
-		"pricePerShare": pricePerShare,
-		"totalValue":    totalValue,
-		"brokerage":     brokerage,
-		"stt":           stt,
-		"gst":           gst,
-		"totalFees":     totalFees,
+		"symbol":        rewardEvent.StockSymbol,
+		"quantity":      rewardEvent.Quantity,
+		"pricePerShare": quote.PriceINR,
+		"currency":      quote.Currency,
+		"fxRate":        quote.FxRate,
+		"totalValue":    entries[0].AmountINR,
+		"totalFees":     entries[2].AmountINR.Neg(),
 	}).Info("Creating ledger entries")
 
-	entries := []models.LedgerEntry{
-		{
-			// STOCK entry: +X shares credited to user
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeStock,
-			StockSymbol:   &symbol,
-			Quantity:      quantity,
-			AmountINR:     totalValue,
-			Timestamp:     timestamp,
-		},
-		{
-			// CASH entry: Company pays for stocks
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeCash,
-			StockSymbol:   &symbol,
-			Quantity:      decimal.Zero,
-			AmountINR:     totalValue.Neg(), // Negative for company outflow
-			Timestamp:     timestamp,
-		},
-		{
-			// FEE entry: Company pays brokerage
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeFee,
-			StockSymbol:   &symbol,
-			Quantity:      decimal.Zero,
-			AmountINR:     totalFees.Neg(), // Negative for company outflow
-			Timestamp:     timestamp,
-		},
-	}
-
 	// Create all entries in a transaction
 	if err := db.DB.Create(&entries).Error; err != nil {
 		return fmt.Errorf("failed to create ledger entries: %w", err)
@@ -87,6 +48,73 @@ func (s *LedgerService) CreateLedgerEntries(rewardEvent *models.RewardEvent, pri
 	return nil
 }
 
+// rewardLedgerEntries builds the STOCK, CASH and FEE entries for a reward.
+// STOCK and CASH record the amount in the instrument's currency next to its
+// INR value; fees are charged in INR.
+func rewardLedgerEntries(rewardEvent *models.RewardEvent, quote Quote) []models.LedgerEntry {
+	quantity := rewardEvent.Quantity
+	symbol := rewardEvent.StockSymbol
+	timestamp := rewardEvent.Timestamp
+	rewardID := rewardEvent.ID
+
+	totalOriginal := utils.RoundINR(quote.Price.Mul(quantity))
+	totalValue := utils.RoundINR(quote.PriceINR.Mul(quantity))
+	_, _, _, totalFees := utils.CalculateFees(quote.PriceINR, quantity)
+
+	return []models.LedgerEntry{
+		{
+			// STOCK entry: +X shares credited to user, settling with the reward
+			UserID:           rewardEvent.UserID,
+			RewardEventID:    &rewardID,
+			ReferenceType:    models.ReferenceReward,
+			ReferenceID:      rewardID,
+			Account:          models.AccountUser,
+			EntryType:        models.EntryTypeStock,
+			StockSymbol:      &symbol,
+			Quantity:         quantity,
+			AmountINR:        totalValue,
+			Currency:         quote.Currency,
+			AmountOriginal:   totalOriginal,
+			FxRate:           quote.FxRate,
+			SettlementStatus: rewardEvent.SettlementStatus,
+			SettlementDate:   rewardEvent.SettlementDate,
+			Timestamp:        timestamp,
+		},
+		{
+			// CASH entry: Company pays for stocks
+			UserID:         rewardEvent.UserID,
+			RewardEventID:  &rewardID,
+			ReferenceType:  models.ReferenceReward,
+			ReferenceID:    rewardID,
+			Account:        models.AccountCompany,
+			EntryType:      models.EntryTypeCash,
+			StockSymbol:    &symbol,
+			Quantity:       decimal.Zero,
+			AmountINR:      totalValue.Neg(), // Negative for company outflow
+			Currency:       quote.Currency,
+			AmountOriginal: totalOriginal.Neg(),
+			FxRate:         quote.FxRate,
+			Timestamp:      timestamp,
+		},
+		{
+			// FEE entry: Company pays brokerage
+			UserID:         rewardEvent.UserID,
+			RewardEventID:  &rewardID,
+			ReferenceType:  models.ReferenceReward,
+			ReferenceID:    rewardID,
+			Account:        models.AccountCompany,
+			EntryType:      models.EntryTypeFee,
+			StockSymbol:    &symbol,
+			Quantity:       decimal.Zero,
+			AmountINR:      totalFees.Neg(), // Negative for company outflow
+			Currency:       models.BaseCurrency,
+			AmountOriginal: totalFees.Neg(),
+			FxRate:         decimal.NewFromInt(1),
+			Timestamp:      timestamp,
+		},
+	}
+}
+
 // GetUserStockHoldings retrieves total stock holdings for a user
 func (s *LedgerService) GetUserStockHoldings(userID int) (map[string]decimal.Decimal, error) {
 	type HoldingResult struct {
@@ -100,8 +128,8 @@ func (s *LedgerService) GetUserStockHoldings(userID int) (map[string]decimal.Dec
 	err := db.DB.Raw(`
 		SELECT le.stock_symbol, SUM(le.quantity) as total_qty
 		FROM ledger_entries le
-		JOIN reward_events re ON le.reward_event_id = re.id
-		WHERE re.user_id = ? 
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
 		  AND le.entry_type = 'STOCK'
 		  AND le.stock_symbol IS NOT NULL
 		  AND re.deleted_at IS NULL
@@ -121,6 +149,58 @@ func (s *LedgerService) GetUserStockHoldings(userID int) (map[string]decimal.Dec
 	return holdingsMap, nil
 }
 
+// GetUserUnsettledHoldings returns, per symbol, the part of a user's holding
+// still awaiting settlement
+func (s *LedgerService) GetUserUnsettledHoldings(userID int) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT le.stock_symbol, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND le.settlement_status = ?
+		  AND re.deleted_at IS NULL
+		GROUP BY le.stock_symbol
+		HAVING SUM(le.quantity) > 0
+	`, userID, models.SettlementUnsettled).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unsettled holdings: %w", err)
+	}
+
+	unsettled := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		unsettled[row.StockSymbol] = row.Quantity
+	}
+	return unsettled, nil
+}
+
+// unsettledHoldingInTx returns a user's unsettled quantity of one symbol within a transaction
+func unsettledHoldingInTx(tx *gorm.DB, userID int, symbol string) (decimal.Decimal, error) {
+	var quantity decimal.NullDecimal
+	err := tx.Raw(`
+		SELECT SUM(le.quantity)
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol = ?
+		  AND le.settlement_status = ?
+		  AND re.deleted_at IS NULL
+	`, userID, symbol, models.SettlementUnsettled).Scan(&quantity).Error
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to fetch unsettled holding: %w", err)
+	}
+	if quantity.Decimal.IsNegative() {
+		return decimal.Zero, nil
+	}
+	return quantity.Decimal, nil
+}
+
 // GetUserStockHoldingsUpToDate retrieves holdings up to a specific date
 func (s *LedgerService) GetUserStockHoldingsUpToDate(userID int, endDate time.Time) (map[string]decimal.Decimal, error) {
 	type HoldingResult struct {
@@ -134,12 +214,12 @@ func (s *LedgerService) GetUserStockHoldingsUpToDate(userID int, endDate time.Ti
 	err := db.DB.Raw(`
 		SELECT le.stock_symbol, SUM(le.quantity) as total_qty
 		FROM ledger_entries le
-		JOIN reward_events re ON le.reward_event_id = re.id
-		WHERE re.user_id = ? 
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
 		  AND le.entry_type = 'STOCK'
 		  AND le.stock_symbol IS NOT NULL
 		  AND re.deleted_at IS NULL
-		  AND re.timestamp <= ?
+		  AND COALESCE(re.timestamp, le.timestamp) <= ?
 		GROUP BY le.stock_symbol
 		HAVING SUM(le.quantity) > 0
 	`, userID, endDate).Scan(&holdings).Error
@@ -156,7 +236,207 @@ func (s *LedgerService) GetUserStockHoldingsUpToDate(userID int, endDate time.Ti
 	return holdingsMap, nil
 }
 
+// GetTotalStockHoldingsUpToDate sums GetUserStockHoldingsUpToDate across all
+// users: the shares the company owes to users per symbol at endDate
+func (s *LedgerService) GetTotalStockHoldingsUpToDate(endDate time.Time) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		TotalQty    decimal.Decimal
+	}
+
+	// Per-user holdings as in GetUserStockHoldingsUpToDate, then summed per symbol
+	err := db.DB.Raw(`
+		SELECT h.stock_symbol, SUM(h.quantity) AS total_qty
+		FROM (
+			SELECT le.user_id, le.stock_symbol, SUM(le.quantity) AS quantity
+			FROM ledger_entries le
+			LEFT JOIN reward_events re ON le.reward_event_id = re.id
+			WHERE le.entry_type = 'STOCK'
+			  AND le.stock_symbol IS NOT NULL
+			  AND re.deleted_at IS NULL
+			  AND COALESCE(re.timestamp, le.timestamp) <= ?
+			GROUP BY le.user_id, le.stock_symbol
+			HAVING SUM(le.quantity) > 0
+		) h
+		GROUP BY h.stock_symbol
+	`, endDate).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch total holdings: %w", err)
+	}
+
+	holdings := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		holdings[row.StockSymbol] = row.TotalQty
+	}
+	return holdings, nil
+}
+
+// GetTotalUnsettledHoldingsAt returns, per symbol, the shares credited by
+// endDate whose settlement date falls after settledBy (YYYY-MM-DD), or that
+// have no date yet because their broker order has not filled
+func (s *LedgerService) GetTotalUnsettledHoldingsAt(endDate time.Time, settledBy string) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT le.stock_symbol, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND (le.settlement_date > ? OR (le.settlement_date = '' AND le.settlement_status = ?))
+		  AND re.deleted_at IS NULL
+		  AND COALESCE(re.timestamp, le.timestamp) <= ?
+		GROUP BY le.stock_symbol
+		HAVING SUM(le.quantity) > 0
+	`, settledBy, models.SettlementUnsettled, endDate).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unsettled holdings: %w", err)
+	}
+
+	unsettled := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		unsettled[row.StockSymbol] = row.Quantity
+	}
+	return unsettled, nil
+}
+
+// Lot is a block of shares acquired by one reward, carried at its reward-time cost
+type Lot struct {
+	RewardEventID uint            `json:"rewardEventId"`
+	StockSymbol   string          `json:"symbol"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	CostINR       decimal.Decimal `json:"costInr"`
+	AcquiredAt    time.Time       `json:"acquiredAt"`
+}
+
+// GetUserLots returns a user's open lots, oldest first. Each lot's cost basis
+// is the AmountINR of its reward's STOCK entries; reversed rewards net to zero
+// and are left out. Shares the user has disposed of are taken from the oldest
+// lots first (FIFO), reducing their cost pro rata.
+func (s *LedgerService) GetUserLots(userID int) ([]Lot, error) {
+	lots, err := s.GetUserAcquiredLots(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var disposals []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err = db.DB.Raw(`
+		SELECT stock_symbol, -SUM(quantity) AS quantity
+		FROM ledger_entries
+		WHERE user_id = ?
+		  AND entry_type = 'STOCK'
+		  AND stock_symbol IS NOT NULL
+		  AND reward_event_id IS NULL
+		  AND quantity < 0
+		GROUP BY stock_symbol
+	`, userID).Scan(&disposals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch disposals: %w", err)
+	}
+
+	disposed := make(map[string]decimal.Decimal, len(disposals))
+	for _, d := range disposals {
+		disposed[d.StockSymbol] = d.Quantity
+	}
+	return consumeLots(lots, disposed), nil
+}
+
+// GetUserAcquiredLots returns every lot a user acquired through rewards,
+// oldest first, before any disposals
+func (s *LedgerService) GetUserAcquiredLots(userID int) ([]Lot, error) {
+	var lots []Lot
+
+	err := db.DB.Raw(`
+		SELECT le.reward_event_id, le.stock_symbol, re.timestamp AS acquired_at,
+		       SUM(le.quantity) AS quantity, SUM(le.amount_inr) AS cost_inr
+		FROM ledger_entries le
+		JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		GROUP BY le.reward_event_id, le.stock_symbol, re.timestamp
+		HAVING SUM(le.quantity) > 0
+		ORDER BY re.timestamp, le.reward_event_id
+	`, userID).Scan(&lots).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch lots: %w", err)
+	}
+
+	return lots, nil
+}
+
+// consumeLots removes disposed quantities per symbol from the oldest lots
+// first and returns the lots that still hold shares
+func consumeLots(lots []Lot, disposed map[string]decimal.Decimal) []Lot {
+	remaining := make([]Lot, 0, len(lots))
+	for _, lot := range lots {
+		take := decimal.Min(disposed[lot.StockSymbol], lot.Quantity)
+		if take.IsPositive() {
+			disposed[lot.StockSymbol] = disposed[lot.StockSymbol].Sub(take)
+			left := lot.Quantity.Sub(take)
+			if !left.IsPositive() {
+				continue
+			}
+			lot.CostINR = utils.RoundINR(lot.CostINR.Mul(left).Div(lot.Quantity))
+			lot.Quantity = left
+		}
+		remaining = append(remaining, lot)
+	}
+	return remaining
+}
+
+// GetUserCashBalance returns a user's INR cash balance: sale proceeds
+// credited to the user less the fees charged to them
+func (s *LedgerService) GetUserCashBalance(userID int) (decimal.Decimal, error) {
+	var balance decimal.NullDecimal
+	err := db.DB.Raw(`
+		SELECT SUM(amount_inr)
+		FROM ledger_entries
+		WHERE user_id = ? AND account = ? AND entry_type IN ('CASH', 'FEE')
+	`, userID, models.AccountUser).Scan(&balance).Error
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to fetch cash balance: %w", err)
+	}
+	return balance.Decimal, nil
+}
+
+// lockUserHoldings serialises changes to a user's holdings until the
+// transaction ends, so concurrent disposals cannot oversell
+func lockUserHoldings(tx *gorm.DB, userID int) error {
+	key := advisoryLockKey(dataLockNamespace, fmt.Sprintf("user-holdings:%d", userID))
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", key).Error; err != nil {
+		return fmt.Errorf("failed to lock user holdings: %w", err)
+	}
+	return nil
+}
+
+// symbolHoldingInTx returns a user's current quantity of one symbol within a transaction
+func symbolHoldingInTx(tx *gorm.DB, userID int, symbol string) (decimal.Decimal, error) {
+	var quantity decimal.NullDecimal
+	err := tx.Raw(`
+		SELECT SUM(le.quantity)
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol = ?
+		  AND re.deleted_at IS NULL
+	`, userID, symbol).Scan(&quantity).Error
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to fetch holding: %w", err)
+	}
+	return quantity.Decimal, nil
+}
+
 // CreateReversalEntries creates reversal ledger entries for reward cancellation
+// and returns any shares the reward drew from treasury lots
 func (s *LedgerService) CreateReversalEntries(rewardEvent *models.RewardEvent) error {
 	// Get original ledger entries
 	var originalEntries []models.LedgerEntry
@@ -169,18 +449,37 @@ func (s *LedgerService) CreateReversalEntries(rewardEvent *models.RewardEvent) e
 	var reversalEntries []models.LedgerEntry
 	for _, entry := range originalEntries {
 		reversal := models.LedgerEntry{
-			RewardEventID: entry.RewardEventID,
-			EntryType:     entry.EntryType,
-			StockSymbol:   entry.StockSymbol,
-			Quantity:      entry.Quantity.Neg(),
-			AmountINR:     entry.AmountINR.Neg(),
-			Timestamp:     utils.NowUTC(),
+			UserID:           entry.UserID,
+			RewardEventID:    entry.RewardEventID,
+			ReferenceType:    entry.ReferenceType,
+			ReferenceID:      entry.ReferenceID,
+			Account:          entry.Account,
+			EntryType:        entry.EntryType,
+			StockSymbol:      entry.StockSymbol,
+			Quantity:         entry.Quantity.Neg(),
+			AmountINR:        entry.AmountINR.Neg(),
+			Currency:         entry.Currency,
+			AmountOriginal:   entry.AmountOriginal.Neg(),
+			FxRate:           entry.FxRate,
+			SettlementStatus: entry.SettlementStatus,
+			SettlementDate:   entry.SettlementDate,
+			Timestamp:        utils.NowUTC(),
 		}
 		reversalEntries = append(reversalEntries, reversal)
 	}
 
-	if err := db.DB.Create(&reversalEntries).Error; err != nil {
-		return fmt.Errorf("failed to create reversal entries: %w", err)
+	// Shares drawn from treasury lots go back to them with the reversal
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&reversalEntries).Error; err != nil {
+			return fmt.Errorf("failed to create reversal entries: %w", err)
+		}
+		if err := returnAllocationsInTx(tx, rewardEvent.ID); err != nil {
+			return err
+		}
+		return notifyHoldingsChanged(tx, rewardEvent.UserID, "reversal")
+	})
+	if err != nil {
+		return err
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultMarketOpen  = "09:15"
+	defaultMarketClose = "15:30"
+
+	// maxCalendarScanDays bounds searches for the previous/next session
+	maxCalendarScanDays = 366
+)
+
+// ErrInvalidHoliday is returned when a holiday entry cannot be parsed
+var ErrInvalidHoliday = errors.New("invalid holiday")
+
+// MarketCalendar answers trading-session questions for the NSE cash market
+type MarketCalendar struct {
+	location     *time.Location
+	openMinutes  int
+	closeMinutes int
+
+	mu       sync.RWMutex
+	holidays map[string]string
+}
+
+// HolidayFileEntry is a single row of a holiday list file
+type HolidayFileEntry struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+}
+
+// NewMarketCalendar creates a calendar using MARKET_OPEN/MARKET_CLOSE (HH:MM, IST)
+func NewMarketCalendar() *MarketCalendar {
+	return &MarketCalendar{
+		location:     utils.ISTLocation(),
+		openMinutes:  clockFromEnv("MARKET_OPEN", defaultMarketOpen),
+		closeMinutes: clockFromEnv("MARKET_CLOSE", defaultMarketClose),
+		holidays:     make(map[string]string),
+	}
+}
+
+// clockFromEnv reads a HH:MM setting, falling back to the default on bad input
+func clockFromEnv(key, fallback string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		value = fallback
+	}
+
+	minutes, err := utils.ParseClock(value)
+	if err != nil {
+		logrus.Warnf("Invalid %s %q, using %s", key, value, fallback)
+		minutes, _ = utils.ParseClock(fallback)
+	}
+	return minutes
+}
+
+// Location returns the exchange timezone
+func (c *MarketCalendar) Location() *time.Location {
+	return c.location
+}
+
+// LoadHolidays reloads the holiday list from the database
+func (c *MarketCalendar) LoadHolidays() error {
+	var rows []models.MarketHoliday
+	if err := db.DB.Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load market holidays: %w", err)
+	}
+
+	holidays := make(map[string]string, len(rows))
+	for _, h := range rows {
+		holidays[h.Date] = h.Description
+	}
+
+	c.mu.Lock()
+	c.holidays = holidays
+	c.mu.Unlock()
+
+	logrus.WithField("holidays", len(holidays)).Info("Market calendar loaded")
+	return nil
+}
+
+// ImportHolidaysFile upserts holidays from a JSON file and reloads the calendar
+func (c *MarketCalendar) ImportHolidaysFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read holiday file: %w", err)
+	}
+
+	var entries []HolidayFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("failed to parse holiday file: %w", err)
+	}
+
+	count, err := c.SaveHolidays(entries)
+	if err != nil {
+		return 0, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"file":     path,
+		"holidays": count,
+	}).Info("Market holidays imported")
+
+	return count, nil
+}
+
+// SaveHolidays validates and upserts holidays, then reloads the calendar
+func (c *MarketCalendar) SaveHolidays(entries []HolidayFileEntry) (int, error) {
+	rows := make([]models.MarketHoliday, 0, len(entries))
+	for _, e := range entries {
+		if _, err := utils.ParseDateString(e.Date); err != nil {
+			return 0, fmt.Errorf("%w: bad date %q", ErrInvalidHoliday, e.Date)
+		}
+		rows = append(rows, models.MarketHoliday{
+			Date:        e.Date,
+			Description: strings.TrimSpace(e.Description),
+		})
+	}
+
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	err := db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description", "updated_at"}),
+	}).Create(&rows).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to save market holidays: %w", err)
+	}
+
+	if err := c.LoadHolidays(); err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// Holidays returns the holidays in the given year, sorted by date
+func (c *MarketCalendar) Holidays(year int) []HolidayFileEntry {
+	prefix := fmt.Sprintf("%04d-", year)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]HolidayFileEntry, 0)
+	for date, description := range c.holidays {
+		if strings.HasPrefix(date, prefix) {
+			result = append(result, HolidayFileEntry{Date: date, Description: description})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+	return result
+}
+
+// IsHoliday reports whether the exchange date containing t is a listed holiday
+func (c *MarketCalendar) IsHoliday(t time.Time) (bool, string) {
+	date := utils.GetDateString(t.In(c.location))
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	description, ok := c.holidays[date]
+	return ok, description
+}
+
+// IsTradingDay reports whether a session is held on the exchange date containing t
+func (c *MarketCalendar) IsTradingDay(t time.Time) bool {
+	local := t.In(c.location)
+	if local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+		return false
+	}
+	holiday, _ := c.IsHoliday(local)
+	return !holiday
+}
+
+// IsTradingDate reports whether a session is held on the calendar date of t
+// as read in t's own location (e.g. a day in a user's time zone), rather
+// than on the exchange date containing the instant t
+func (c *MarketCalendar) IsTradingDate(t time.Time) bool {
+	return c.IsTradingDay(time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, c.location))
+}
+
+// SessionOpen returns the session open time on the exchange date containing t
+func (c *MarketCalendar) SessionOpen(t time.Time) time.Time {
+	return utils.StartOfDay(t.In(c.location)).Add(time.Duration(c.openMinutes) * time.Minute)
+}
+
+// SessionClose returns the session close time on the exchange date containing t
+func (c *MarketCalendar) SessionClose(t time.Time) time.Time {
+	return utils.StartOfDay(t.In(c.location)).Add(time.Duration(c.closeMinutes) * time.Minute)
+}
+
+// IsMarketOpen reports whether t falls inside a trading session
+func (c *MarketCalendar) IsMarketOpen(t time.Time) bool {
+	if !c.IsTradingDay(t) {
+		return false
+	}
+	return !t.Before(c.SessionOpen(t)) && t.Before(c.SessionClose(t))
+}
+
+// LastSessionOpen returns the most recent session open at or before t
+func (c *MarketCalendar) LastSessionOpen(t time.Time) time.Time {
+	day := t.In(c.location)
+	for i := 0; i < maxCalendarScanDays; i++ {
+		if c.IsTradingDay(day) {
+			openTime := c.SessionOpen(day)
+			if !openTime.After(t) {
+				return openTime.UTC()
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return t.UTC()
+}
+
+// LastSessionClose returns the most recent session close at or before t
+func (c *MarketCalendar) LastSessionClose(t time.Time) time.Time {
+	day := t.In(c.location)
+	for i := 0; i < maxCalendarScanDays; i++ {
+		if c.IsTradingDay(day) {
+			closeTime := c.SessionClose(day)
+			if !closeTime.After(t) {
+				return closeTime.UTC()
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return t.UTC()
+}
+
+// NextSessionOpen returns the next session open strictly after t
+func (c *MarketCalendar) NextSessionOpen(t time.Time) time.Time {
+	day := t.In(c.location)
+	for i := 0; i < maxCalendarScanDays; i++ {
+		if c.IsTradingDay(day) {
+			openTime := c.SessionOpen(day)
+			if openTime.After(t) {
+				return openTime.UTC()
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return t.UTC()
+}
+
+// ValuationTime returns the instant prices should be read at for a valuation at t:
+// t itself during a session, otherwise the last session close
+func (c *MarketCalendar) ValuationTime(t time.Time) time.Time {
+	if c.IsMarketOpen(t) {
+		return t.UTC()
+	}
+	return c.LastSessionClose(t)
+}
+
+// TradeDate returns the exchange date (YYYY-MM-DD) of the session an order
+// at t trades in: t's own date up to the session close on a trading day,
+// otherwise the next session's date
+func (c *MarketCalendar) TradeDate(t time.Time) string {
+	return utils.GetDateString(c.tradeDay(t))
+}
+
+// tradeDay returns a time on the exchange date of the session t trades in
+func (c *MarketCalendar) tradeDay(t time.Time) time.Time {
+	day := t.In(c.location)
+	if !c.IsTradingDay(day) || !t.Before(c.SessionClose(day)) {
+		day = c.NextSessionOpen(t).In(c.location)
+	}
+	return day
+}
+
+// SettlementDate returns the exchange date (YYYY-MM-DD) shares traded at t
+// settle on: the trading day after the trade date (T+1). Trades outside a
+// session count from the next session.
+func (c *MarketCalendar) SettlementDate(t time.Time) string {
+	day := c.tradeDay(t)
+	for i := 0; i < maxCalendarScanDays; i++ {
+		day = day.AddDate(0, 0, 1)
+		if c.IsTradingDay(day) {
+			break
+		}
+	}
+	return utils.GetDateString(day)
+}
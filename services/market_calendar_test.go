@@ -0,0 +1,182 @@
+package services
+
+import (
+	"stocky-backend/utils"
+	"testing"
+	"time"
+)
+
+// istTime parses a "YYYY-MM-DD HH:MM" exchange time
+func istTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, utils.ISTLocation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestClockFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 9*60 + 15},
+		{"10:00", 10 * 60},
+		{"25:00", 9*60 + 15},
+		{"nine", 9*60 + 15},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_MARKET_OPEN", tt.value)
+		if got := clockFromEnv("TEST_MARKET_OPEN", defaultMarketOpen); got != tt.want {
+			t.Errorf("clockFromEnv(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsMarketOpen(t *testing.T) {
+	calendar := NewMarketCalendar()
+	calendar.holidays["2024-05-01"] = "Maharashtra Day"
+
+	// 2024-05-02 is a Thursday
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{"2024-05-02 09:14", false},
+		{"2024-05-02 09:15", true},
+		{"2024-05-02 15:29", true},
+		{"2024-05-02 15:30", false},
+		{"2024-05-04 11:00", false},
+		{"2024-05-01 11:00", false},
+	}
+
+	for _, tt := range tests {
+		if got := calendar.IsMarketOpen(istTime(t, tt.at)); got != tt.want {
+			t.Errorf("IsMarketOpen(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestSessionBoundaries(t *testing.T) {
+	calendar := NewMarketCalendar()
+	calendar.holidays["2024-05-01"] = "Maharashtra Day"
+
+	// 2024-04-30 is a Tuesday, 2024-05-01 a holiday and 2024-05-03 a Friday
+	tests := []struct {
+		now           string
+		lastClose     string
+		nextOpen      string
+		valuationTime string
+	}{
+		{"2024-05-02 11:00", "2024-04-30 15:30", "2024-05-03 09:15", "2024-05-02 11:00"},
+		{"2024-05-02 15:30", "2024-05-02 15:30", "2024-05-03 09:15", "2024-05-02 15:30"},
+		{"2024-05-02 08:00", "2024-04-30 15:30", "2024-05-02 09:15", "2024-04-30 15:30"},
+		{"2024-05-04 12:00", "2024-05-03 15:30", "2024-05-06 09:15", "2024-05-03 15:30"},
+	}
+
+	for _, tt := range tests {
+		now := istTime(t, tt.now)
+		if got := calendar.LastSessionClose(now); !got.Equal(istTime(t, tt.lastClose)) {
+			t.Errorf("LastSessionClose(%s) = %s, want %s", tt.now, got.In(calendar.Location()), tt.lastClose)
+		}
+		if got := calendar.NextSessionOpen(now); !got.Equal(istTime(t, tt.nextOpen)) {
+			t.Errorf("NextSessionOpen(%s) = %s, want %s", tt.now, got.In(calendar.Location()), tt.nextOpen)
+		}
+		if got := calendar.ValuationTime(now); !got.Equal(istTime(t, tt.valuationTime)) {
+			t.Errorf("ValuationTime(%s) = %s, want %s", tt.now, got.In(calendar.Location()), tt.valuationTime)
+		}
+	}
+}
+
+func TestIsTradingDate(t *testing.T) {
+	calendar := NewMarketCalendar()
+	tokyo := time.FixedZone("+09:00", 9*3600)
+	newYork := time.FixedZone("-05:00", -5*3600)
+
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		// Midnight Monday in +09:00 is still Sunday evening in IST
+		{"monday ahead of IST", time.Date(2024, 3, 4, 0, 0, 0, 0, tokyo), true},
+		// Midnight Saturday in +09:00 is still Friday evening in IST
+		{"saturday ahead of IST", time.Date(2024, 3, 9, 0, 0, 0, 0, tokyo), false},
+		// Midnight Friday in -05:00 is already Friday morning in IST
+		{"friday behind IST", time.Date(2024, 3, 8, 0, 0, 0, 0, newYork), true},
+		// Midnight Sunday in -05:00 is Sunday morning in IST
+		{"sunday behind IST", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), false},
+		{"utc weekday", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.IsTradingDate(tt.date); got != tt.want {
+				t.Errorf("IsTradingDate(%s) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+
+	// The instant-based check reads the exchange date instead
+	if calendar.IsTradingDay(time.Date(2024, 3, 4, 0, 0, 0, 0, tokyo)) {
+		t.Error("IsTradingDay at +09:00 Monday midnight should fall on Sunday in IST")
+	}
+}
+
+func TestSettlementDate(t *testing.T) {
+	calendar := NewMarketCalendar()
+	calendar.holidays["2024-05-01"] = "Maharashtra Day"
+	at := func(value string) time.Time { return istTime(t, value) }
+
+	// 2024-04-30 is a Tuesday and 2024-05-01 a holiday
+	tests := []struct {
+		name      string
+		tradedAt  string
+		tradeDate string
+		want      string
+	}{
+		{"during the session", "2024-05-02 11:00", "2024-05-02", "2024-05-03"},
+		{"before the open", "2024-05-02 08:00", "2024-05-02", "2024-05-03"},
+		{"after the close", "2024-05-02 16:00", "2024-05-03", "2024-05-06"},
+		{"friday settles monday", "2024-05-03 11:00", "2024-05-03", "2024-05-06"},
+		{"weekend trades monday", "2024-05-04 11:00", "2024-05-06", "2024-05-07"},
+		{"skips a holiday", "2024-04-30 11:00", "2024-04-30", "2024-05-02"},
+		{"on a holiday", "2024-05-01 11:00", "2024-05-02", "2024-05-03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.TradeDate(at(tt.tradedAt)); got != tt.tradeDate {
+				t.Errorf("TradeDate = %s, want %s", got, tt.tradeDate)
+			}
+			if got := calendar.SettlementDate(at(tt.tradedAt)); got != tt.want {
+				t.Errorf("SettlementDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastSessionOpen(t *testing.T) {
+	calendar := NewMarketCalendar()
+	at := func(value string) time.Time { return istTime(t, value) }
+
+	// 2024-05-03 is a Friday
+	tests := []struct {
+		now  string
+		want string
+	}{
+		{"2024-05-03 09:15", "2024-05-03 09:15"},
+		{"2024-05-03 12:00", "2024-05-03 09:15"},
+		{"2024-05-03 09:14", "2024-05-02 09:15"},
+		{"2024-05-05 12:00", "2024-05-03 09:15"},
+		{"2024-05-06 09:00", "2024-05-03 09:15"},
+	}
+
+	for _, tt := range tests {
+		if got := calendar.LastSessionOpen(at(tt.now)); !got.Equal(at(tt.want)) {
+			t.Errorf("LastSessionOpen(%s) = %s, want %s", tt.now, got.In(calendar.Location()), tt.want)
+		}
+	}
+}
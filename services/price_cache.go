@@ -0,0 +1,120 @@
+package services
+
+import (
+	"stocky-backend/utils"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultPriceCacheTTL is used when PRICE_CACHE_TTL is not set
+const defaultPriceCacheTTL = 30 * time.Second
+
+// cachedPrice is a cached latest quote for one symbol
+type cachedPrice struct {
+	quote     Quote
+	expiresAt time.Time
+}
+
+// priceCache is an in-process TTL cache of latest prices.
+// Concurrent misses for the same symbol are coalesced into one load, and a
+// per-symbol version guards against a slow load repopulating an entry that
+// was invalidated while it was in flight.
+type priceCache struct {
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	entries  map[string]cachedPrice
+	versions map[string]uint64
+	epoch    uint64
+
+	group singleflight.Group
+}
+
+// newPriceCache creates a cache using PRICE_CACHE_TTL (Go duration, 0 disables)
+func newPriceCache() *priceCache {
+	return &priceCache{
+		ttl:      utils.NonNegativeDurationFromEnv("PRICE_CACHE_TTL", defaultPriceCacheTTL),
+		entries:  make(map[string]cachedPrice),
+		versions: make(map[string]uint64),
+	}
+}
+
+// get returns a cached quote if present and not expired
+func (c *priceCache) get(symbol string) (Quote, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[symbol]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return Quote{}, false
+	}
+	return entry.quote, true
+}
+
+// version returns the current invalidation version for a symbol
+func (c *priceCache) version(symbol string) uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.versions[symbol] + c.epoch
+}
+
+// set stores a quote loaded at the given version; stale loads are dropped
+func (c *priceCache) set(symbol string, quote Quote, loadedAt uint64) {
+	if c.ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.versions[symbol]+c.epoch != loadedAt {
+		return
+	}
+	c.entries[symbol] = cachedPrice{
+		quote:     quote,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// invalidate drops a symbol's entry and any in-flight load for it
+func (c *priceCache) invalidate(symbol string) {
+	c.mu.Lock()
+	delete(c.entries, symbol)
+	c.versions[symbol]++
+	c.mu.Unlock()
+
+	c.group.Forget(symbol)
+}
+
+// invalidateAll drops every entry and any in-flight load, e.g. after an FX rate change
+func (c *priceCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]cachedPrice)
+	c.epoch++
+}
+
+// load returns the cached quote or runs fn once for all concurrent callers
+func (c *priceCache) load(symbol string, fn func() (Quote, error)) (Quote, error) {
+	if quote, ok := c.get(symbol); ok {
+		return quote, nil
+	}
+
+	value, err, _ := c.group.Do(symbol, func() (interface{}, error) {
+		loadedAt := c.version(symbol)
+		quote, err := fn()
+		if err != nil {
+			return Quote{}, err
+		}
+		c.set(symbol, quote, loadedAt)
+		return quote, nil
+	})
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return value.(Quote), nil
+}
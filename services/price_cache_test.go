@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPriceCacheCoalescesLoads(t *testing.T) {
+	cache := newPriceCache()
+
+	var loads int32
+	release := make(chan struct{})
+	fn := func() (Quote, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return Quote{Symbol: "TCS", PriceINR: decimal.NewFromInt(100)}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.load("TCS", fn); err != nil {
+				t.Errorf("load: %v", err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+	if _, ok := cache.get("TCS"); !ok {
+		t.Error("quote was not cached")
+	}
+}
+
+func TestPriceCacheInvalidate(t *testing.T) {
+	cache := newPriceCache()
+	quote := Quote{Symbol: "TCS", PriceINR: decimal.NewFromInt(100)}
+
+	cache.set("TCS", quote, cache.version("TCS"))
+	cache.invalidate("TCS")
+	if _, ok := cache.get("TCS"); ok {
+		t.Error("invalidated quote still cached")
+	}
+
+	// A load that started before an invalidation must not repopulate the entry
+	loadedAt := cache.version("TCS")
+	cache.invalidate("TCS")
+	cache.set("TCS", quote, loadedAt)
+	if _, ok := cache.get("TCS"); ok {
+		t.Error("stale load repopulated the cache")
+	}
+
+	loadedAt = cache.version("TCS")
+	cache.invalidateAll()
+	cache.set("TCS", quote, loadedAt)
+	if _, ok := cache.get("TCS"); ok {
+		t.Error("load from before invalidateAll repopulated the cache")
+	}
+
+	cache.set("TCS", quote, cache.version("TCS"))
+	if _, ok := cache.get("TCS"); !ok {
+		t.Error("current load was not cached")
+	}
+}
+
+func TestPriceCacheDisabled(t *testing.T) {
+	t.Setenv("PRICE_CACHE_TTL", "0")
+	cache := newPriceCache()
+
+	var loads int
+	for i := 0; i < 2; i++ {
+		_, err := cache.load("TCS", func() (Quote, error) {
+			loads++
+			return Quote{Symbol: "TCS"}, nil
+		})
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+	}
+	if loads != 2 {
+		t.Errorf("loads = %d, want 2 with caching disabled", loads)
+	}
+}
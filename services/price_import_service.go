@@ -0,0 +1,540 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultImportBatchSize is the number of rows checked for existing prices per query
+	defaultImportBatchSize = 500
+
+	// maxReportedImportErrors caps the row errors returned to the caller
+	maxReportedImportErrors = 100
+)
+
+// Supported price import formats
+const (
+	PriceImportFormatCSV  = "csv"
+	PriceImportFormatJSON = "json"
+)
+
+// ErrInvalidImportFile is returned when an import file cannot be parsed at all
+var ErrInvalidImportFile = errors.New("invalid import file")
+
+// PriceImportOptions controls how an import treats existing data
+type PriceImportOptions struct {
+	Format    string
+	Overwrite bool
+}
+
+// PriceImportError describes a rejected row
+type PriceImportError struct {
+	Row    int    `json:"row"`
+	Symbol string `json:"symbol,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// PriceImportResult summarises an import run
+type PriceImportResult struct {
+	Inserted    int                `json:"inserted"`
+	Overwritten int                `json:"overwritten"`
+	Skipped     int                `json:"skipped"`
+	Rejected    int                `json:"rejected"`
+	Quarantined int                `json:"quarantined"`
+	Errors      []PriceImportError `json:"errors,omitempty"`
+}
+
+// validPriceRow is a validated row with the record it came from
+type validPriceRow struct {
+	record priceImportRecord
+	price  models.PriceHistory
+}
+
+// priceImportRecord is a raw row before validation
+type priceImportRecord struct {
+	Row       int
+	Symbol    string
+	Date      string
+	Timestamp string
+	Price     string
+}
+
+// jsonPriceRecord is the JSON shape of a price row
+type jsonPriceRecord struct {
+	Symbol    string          `json:"symbol"`
+	Date      string          `json:"date"`
+	Timestamp string          `json:"timestamp"`
+	Close     json.RawMessage `json:"close"`
+	Price     json.RawMessage `json:"price"`
+}
+
+// PriceImportService backfills price_history from end-of-day files
+type PriceImportService struct {
+	calendar     *MarketCalendar
+	priceService *PriceService
+	batchSize    int
+}
+
+// NewPriceImportService creates a new price import service
+func NewPriceImportService(calendar *MarketCalendar, priceService *PriceService) *PriceImportService {
+	return &PriceImportService{
+		calendar:     calendar,
+		priceService: priceService,
+		batchSize:    defaultImportBatchSize,
+	}
+}
+
+// Import parses, validates and writes prices from r.
+// Prices are in each instrument's currency; date-only rows are stamped at
+// that day's session close. Each row runs through the same sanity checks as
+// live prices, against the prices already stored, and failing rows are
+// quarantined for review. Accepted rows are written in batches.
+func (s *PriceImportService) Import(r io.Reader, opts PriceImportOptions) (*PriceImportResult, error) {
+	var records []priceImportRecord
+	var err error
+
+	switch strings.ToLower(opts.Format) {
+	case PriceImportFormatCSV:
+		records, err = parseCSVPrices(r)
+	case PriceImportFormatJSON:
+		records, err = parseJSONPrices(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidImportFile, opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	currencies, err := loadConfiguredSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PriceImportResult{}
+	seen := make(map[string]bool, len(records))
+	var valid []validPriceRow
+
+	for _, rec := range records {
+		row, reason := s.validateRecord(rec, currencies)
+		if reason == "" {
+			key := priceKey(row.StockSymbol, row.Timestamp)
+			if seen[key] {
+				reason = "duplicate row in file"
+			}
+			seen[key] = true
+		}
+
+		if reason == "" {
+			reason = s.convertToINR(&row)
+		}
+
+		if reason != "" {
+			result.reject(rec, reason)
+			continue
+		}
+		valid = append(valid, validPriceRow{record: rec, price: row})
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].price.Timestamp.Before(valid[j].price.Timestamp)
+	})
+
+	existing, err := s.existingPriceKeys(valid)
+	if err != nil {
+		return result, err
+	}
+
+	limits := make(map[string]priceLimits)
+	var accepted []validPriceRow
+	for _, row := range valid {
+		symbol := row.price.StockSymbol
+		replace := existing[priceKey(symbol, row.price.Timestamp)]
+		if replace && !opts.Overwrite {
+			result.Skipped++
+			continue
+		}
+
+		symbolLimits, ok := limits[symbol]
+		if !ok {
+			if symbolLimits, err = loadPriceLimits(symbol); err != nil {
+				return result, err
+			}
+			limits[symbol] = symbolLimits
+		}
+
+		check, err := s.priceService.checkPriceWithin(symbolLimits, symbol, row.price.Price, row.price.Timestamp)
+		if err != nil {
+			return result, fmt.Errorf("failed to check price: %w", err)
+		}
+		if check.reason != "" {
+			err := s.priceService.quarantinePrice(row.price, check)
+			if !errors.Is(err, ErrPriceQuarantined) {
+				return result, err
+			}
+			result.Quarantined++
+			result.addError(row.record, err.Error())
+			continue
+		}
+
+		if replace {
+			result.Overwritten++
+		} else {
+			result.Inserted++
+		}
+		accepted = append(accepted, row)
+	}
+
+	latest, err := latestPriceTimes(accepted)
+	if err != nil {
+		return result, err
+	}
+	if err := s.writePrices(accepted, existing); err != nil {
+		return result, err
+	}
+	s.publishImported(accepted, latest)
+
+	logrus.WithFields(logrus.Fields{
+		"format":      opts.Format,
+		"overwrite":   opts.Overwrite,
+		"inserted":    result.Inserted,
+		"overwritten": result.Overwritten,
+		"skipped":     result.Skipped,
+		"rejected":    result.Rejected,
+		"quarantined": result.Quarantined,
+	}).Info("Price import completed")
+
+	return result, nil
+}
+
+// validateRecord converts a raw record, returning a rejection reason on failure
+func (s *PriceImportService) validateRecord(rec priceImportRecord, currencies map[string]string) (models.PriceHistory, string) {
+	symbol := strings.ToUpper(strings.TrimSpace(rec.Symbol))
+	if err := utils.ValidateStockSymbol(symbol); err != nil {
+		return models.PriceHistory{}, err.Error()
+	}
+	currency, known := currencies[symbol]
+	if !known {
+		return models.PriceHistory{}, "symbol not configured in stock_config"
+	}
+
+	price, err := decimal.NewFromString(strings.TrimSpace(rec.Price))
+	if err != nil || !price.IsPositive() {
+		return models.PriceHistory{}, "price must be a positive number"
+	}
+
+	timestamp, resolution, err := s.parseRecordTime(rec)
+	if err != nil {
+		return models.PriceHistory{}, err.Error()
+	}
+	if timestamp.After(utils.NowUTC()) {
+		return models.PriceHistory{}, "timestamp is in the future"
+	}
+
+	return models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       utils.RoundINR(price),
+		Currency:    currency,
+		Timestamp:   timestamp,
+		Resolution:  resolution,
+	}, ""
+}
+
+// convertToINR fills PriceINR at the FX rate in force at the row's timestamp
+func (s *PriceImportService) convertToINR(row *models.PriceHistory) string {
+	rate, err := s.priceService.GetFxRateAt(row.Currency, row.Timestamp)
+	if err != nil {
+		return fmt.Sprintf("no %s FX rate available", row.Currency)
+	}
+	row.PriceINR = utils.RoundINR(row.Price.Mul(rate))
+	return ""
+}
+
+// parseRecordTime resolves an RFC3339 timestamp or a trading date to an instant.
+// Date-only rows are end-of-day closes and are stored at daily resolution.
+func (s *PriceImportService) parseRecordTime(rec priceImportRecord) (time.Time, models.PriceResolution, error) {
+	if ts := strings.TrimSpace(rec.Timestamp); ts != "" {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid timestamp, use RFC3339")
+		}
+		return t.UTC().Truncate(time.Microsecond), models.PriceResolutionRaw, nil
+	}
+
+	date := strings.TrimSpace(rec.Date)
+	if date == "" {
+		return time.Time{}, "", fmt.Errorf("date or timestamp is required")
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", date, s.calendar.Location())
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid date, use YYYY-MM-DD")
+	}
+	if !s.calendar.IsTradingDay(day) {
+		return time.Time{}, "", fmt.Errorf("%s is not a trading day", date)
+	}
+
+	return s.calendar.SessionClose(day).UTC(), models.PriceResolutionDaily, nil
+}
+
+// existingPriceKeys returns the priceKeys of rows already in price_history
+func (s *PriceImportService) existingPriceKeys(rows []validPriceRow) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	for start := 0; start < len(rows); start += s.batchSize {
+		end := start + s.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		keys := make([][]interface{}, 0, end-start)
+		for _, row := range rows[start:end] {
+			keys = append(keys, []interface{}{row.price.StockSymbol, row.price.Timestamp})
+		}
+
+		var found []models.PriceHistory
+		err := db.DB.Select("stock_symbol", "timestamp").
+			Where("(stock_symbol, timestamp) IN ?", keys).
+			Find(&found).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing prices: %w", err)
+		}
+		for _, row := range found {
+			existing[priceKey(row.StockSymbol, row.Timestamp)] = true
+		}
+	}
+	return existing, nil
+}
+
+// writePrices stores accepted rows in batches. Rows already in price_history
+// (the overwrite case) are deleted in the same transaction as their replacement.
+func (s *PriceImportService) writePrices(rows []validPriceRow, existing map[string]bool) error {
+	for start := 0; start < len(rows); start += s.batchSize {
+		end := start + s.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		prices := make([]models.PriceHistory, 0, end-start)
+		var replaced [][]interface{}
+		for _, row := range rows[start:end] {
+			prices = append(prices, row.price)
+			if existing[priceKey(row.price.StockSymbol, row.price.Timestamp)] {
+				replaced = append(replaced, []interface{}{row.price.StockSymbol, row.price.Timestamp})
+			}
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if len(replaced) > 0 {
+				err := tx.Where("(stock_symbol, timestamp) IN ?", replaced).
+					Delete(&models.PriceHistory{}).Error
+				if err != nil {
+					return fmt.Errorf("failed to replace existing prices: %w", err)
+				}
+			}
+			if err := tx.CreateInBatches(&prices, s.batchSize).Error; err != nil {
+				return fmt.Errorf("failed to save prices: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := range prices {
+			rows[start+i].price = prices[i]
+		}
+	}
+	return nil
+}
+
+// latestPriceTimes returns the newest stored price timestamp for each symbol in rows
+func latestPriceTimes(rows []validPriceRow) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time)
+	if len(rows) == 0 {
+		return latest, nil
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, row := range rows {
+		if !seen[row.price.StockSymbol] {
+			seen[row.price.StockSymbol] = true
+			names = append(names, row.price.StockSymbol)
+		}
+	}
+
+	var stored []struct {
+		StockSymbol string
+		Latest      time.Time
+	}
+	err := db.DB.Model(&models.PriceHistory{}).
+		Select("stock_symbol, MAX(timestamp) AS latest").
+		Where("stock_symbol IN ?", names).
+		Group("stock_symbol").
+		Scan(&stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load latest prices: %w", err)
+	}
+	for _, row := range stored {
+		latest[row.StockSymbol] = row.Latest
+	}
+	return latest, nil
+}
+
+// publishImported invalidates the cache once per imported symbol and
+// publishes a symbol's newest imported row only when it is newer than
+// anything stored before the import; backfilled history is not streamed.
+func (s *PriceImportService) publishImported(rows []validPriceRow, latest map[string]time.Time) {
+	newest := make(map[string]models.PriceHistory)
+	for _, row := range rows {
+		if current, ok := newest[row.price.StockSymbol]; !ok || row.price.Timestamp.After(current.Timestamp) {
+			newest[row.price.StockSymbol] = row.price
+		}
+	}
+
+	for symbol, price := range newest {
+		s.priceService.cache.invalidate(symbol)
+		if price.Timestamp.After(latest[symbol]) {
+			s.priceService.publishPrice(price)
+		}
+	}
+}
+
+// reject records a rejected row
+func (r *PriceImportResult) reject(rec priceImportRecord, reason string) {
+	r.Rejected++
+	r.addError(rec, reason)
+}
+
+// addError reports a row error, up to maxReportedImportErrors
+func (r *PriceImportResult) addError(rec priceImportRecord, reason string) {
+	if len(r.Errors) < maxReportedImportErrors {
+		r.Errors = append(r.Errors, PriceImportError{
+			Row:    rec.Row,
+			Symbol: rec.Symbol,
+			Reason: reason,
+		})
+	}
+}
+
+// loadConfiguredSymbols returns the symbols present in stock_config with their currencies
+func loadConfiguredSymbols() (map[string]string, error) {
+	var configs []models.StockConfig
+	if err := db.DB.Select("stock_symbol", "currency").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load stock config: %w", err)
+	}
+
+	currencies := make(map[string]string, len(configs))
+	for _, config := range configs {
+		currency := config.Currency
+		if currency == "" {
+			currency = models.BaseCurrency
+		}
+		currencies[config.StockSymbol] = currency
+	}
+	return currencies, nil
+}
+
+// priceKey builds a map key for a symbol/timestamp pair
+func priceKey(symbol string, timestamp time.Time) string {
+	return fmt.Sprintf("%s|%d", symbol, timestamp.UTC().UnixMicro())
+}
+
+// parseCSVPrices reads rows with a header of symbol, date|timestamp and close|price
+func parseCSVPrices(r io.Reader) ([]priceImportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidImportFile)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	symbolCol, ok := columns["symbol"]
+	if !ok {
+		return nil, fmt.Errorf("%w: CSV header must include symbol", ErrInvalidImportFile)
+	}
+	priceCol, ok := columns["close"]
+	if !ok {
+		if priceCol, ok = columns["price"]; !ok {
+			return nil, fmt.Errorf("%w: CSV header must include close or price", ErrInvalidImportFile)
+		}
+	}
+	dateCol, hasDate := columns["date"]
+	tsCol, hasTimestamp := columns["timestamp"]
+	if !hasDate && !hasTimestamp {
+		return nil, fmt.Errorf("%w: CSV header must include date or timestamp", ErrInvalidImportFile)
+	}
+
+	field := func(fields []string, col int, present bool) string {
+		if !present || col >= len(fields) {
+			return ""
+		}
+		return fields[col]
+	}
+
+	var records []priceImportRecord
+	for row := 2; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+
+		records = append(records, priceImportRecord{
+			Row:       row,
+			Symbol:    field(fields, symbolCol, true),
+			Date:      field(fields, dateCol, hasDate),
+			Timestamp: field(fields, tsCol, hasTimestamp),
+			Price:     field(fields, priceCol, true),
+		})
+	}
+
+	return records, nil
+}
+
+// parseJSONPrices reads an array of {symbol, date|timestamp, close|price} objects
+func parseJSONPrices(r io.Reader) ([]priceImportRecord, error) {
+	var rows []jsonPriceRecord
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	records := make([]priceImportRecord, 0, len(rows))
+	for i, row := range rows {
+		price := row.Close
+		if len(price) == 0 {
+			price = row.Price
+		}
+
+		records = append(records, priceImportRecord{
+			Row:       i + 1,
+			Symbol:    row.Symbol,
+			Date:      row.Date,
+			Timestamp: row.Timestamp,
+			Price:     strings.Trim(string(price), `"`),
+		})
+	}
+
+	return records, nil
+}
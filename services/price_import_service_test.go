@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseCSVPrices(t *testing.T) {
+	records, err := parseCSVPrices(strings.NewReader("Symbol, Date, Close\nTCS,2024-05-02,3850.5\nINFY,2024-05-02,\n"))
+	if err != nil {
+		t.Fatalf("parseCSVPrices: %v", err)
+	}
+	want := []priceImportRecord{
+		{Row: 2, Symbol: "TCS", Date: "2024-05-02", Price: "3850.5"},
+		{Row: 3, Symbol: "INFY", Date: "2024-05-02"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, records[i], want[i])
+		}
+	}
+
+	for _, header := range []string{"", "date,close", "symbol,date", "symbol,close"} {
+		if _, err := parseCSVPrices(strings.NewReader(header + "\n")); !errors.Is(err, ErrInvalidImportFile) {
+			t.Errorf("header %q: err = %v, want ErrInvalidImportFile", header, err)
+		}
+	}
+}
+
+func TestParseJSONPrices(t *testing.T) {
+	records, err := parseJSONPrices(strings.NewReader(`[
+		{"symbol": "TCS", "date": "2024-05-02", "close": 3850.5},
+		{"symbol": "AAPL", "timestamp": "2024-05-02T14:00:00Z", "price": "182.1"}
+	]`))
+	if err != nil {
+		t.Fatalf("parseJSONPrices: %v", err)
+	}
+	want := []priceImportRecord{
+		{Row: 1, Symbol: "TCS", Date: "2024-05-02", Price: "3850.5"},
+		{Row: 2, Symbol: "AAPL", Timestamp: "2024-05-02T14:00:00Z", Price: "182.1"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, records[i], want[i])
+		}
+	}
+
+	if _, err := parseJSONPrices(strings.NewReader(`{"symbol": "TCS"}`)); !errors.Is(err, ErrInvalidImportFile) {
+		t.Errorf("err = %v, want ErrInvalidImportFile", err)
+	}
+}
+
+func TestValidateRecord(t *testing.T) {
+	calendar := NewMarketCalendar()
+	service := NewPriceImportService(calendar, nil)
+	currencies := map[string]string{"TCS": "INR", "AAPL": "USD"}
+
+	// 2024-05-02 is a Thursday
+	tests := []struct {
+		name       string
+		record     priceImportRecord
+		timestamp  time.Time
+		resolution models.PriceResolution
+		reason     string
+	}{
+		{
+			name:       "date is stamped at the close",
+			record:     priceImportRecord{Symbol: " tcs ", Date: "2024-05-02", Price: "3850.12345"},
+			timestamp:  calendar.SessionClose(time.Date(2024, 5, 2, 12, 0, 0, 0, calendar.Location())).UTC(),
+			resolution: models.PriceResolutionDaily,
+		},
+		{
+			name:       "timestamp is kept",
+			record:     priceImportRecord{Symbol: "AAPL", Timestamp: "2024-05-02T14:00:00+05:30", Price: "182.1"},
+			timestamp:  time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC),
+			resolution: models.PriceResolutionRaw,
+		},
+		{name: "unknown symbol", record: priceImportRecord{Symbol: "WIPRO", Date: "2024-05-02", Price: "1"}, reason: "symbol not configured in stock_config"},
+		{name: "zero price", record: priceImportRecord{Symbol: "TCS", Date: "2024-05-02", Price: "0"}, reason: "price must be a positive number"},
+		{name: "weekend", record: priceImportRecord{Symbol: "TCS", Date: "2024-05-04", Price: "1"}, reason: "2024-05-04 is not a trading day"},
+		{name: "bad date", record: priceImportRecord{Symbol: "TCS", Date: "02/05/2024", Price: "1"}, reason: "invalid date, use YYYY-MM-DD"},
+		{name: "bad timestamp", record: priceImportRecord{Symbol: "TCS", Timestamp: "2024-05-02 14:00", Price: "1"}, reason: "invalid timestamp, use RFC3339"},
+		{name: "no time", record: priceImportRecord{Symbol: "TCS", Price: "1"}, reason: "date or timestamp is required"},
+		{name: "future", record: priceImportRecord{Symbol: "TCS", Timestamp: "2999-01-01T00:00:00Z", Price: "1"}, reason: "timestamp is in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, reason := service.validateRecord(tt.record, currencies)
+			if reason != tt.reason {
+				t.Fatalf("reason = %q, want %q", reason, tt.reason)
+			}
+			if reason != "" {
+				return
+			}
+			if !row.Timestamp.Equal(tt.timestamp) || row.Resolution != tt.resolution {
+				t.Errorf("row at %s (%s), want %s (%s)", row.Timestamp, row.Resolution, tt.timestamp, tt.resolution)
+			}
+			if row.StockSymbol != strings.ToUpper(strings.TrimSpace(tt.record.Symbol)) || row.Currency != currencies[row.StockSymbol] {
+				t.Errorf("row = %s %s", row.StockSymbol, row.Currency)
+			}
+		})
+	}
+}
+
+func TestImportRunsPriceChecks(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "IMPTEST"
+	mustCreate(t, &models.StockConfig{
+		StockSymbol:          symbol,
+		Currency:             "INR",
+		Multiplier:           decimal.NewFromInt(1),
+		IsActive:             true,
+		MaxPriceMovePct:      decimal.NewFromInt(10),
+		PriceBandPct:         decimal.NewFromInt(20),
+		PriceBandWindowHours: 72,
+	})
+
+	calendar := NewMarketCalendar()
+	priceService := NewPriceService(calendar)
+	service := NewPriceImportService(calendar, priceService)
+
+	day, _, err := service.parseRecordTime(priceImportRecord{Date: "2024-05-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(100),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(100),
+		Timestamp:   day,
+		Resolution:  models.PriceResolutionDaily,
+	})
+
+	// Rows are checked against stored prices, so the spike on the 6th and
+	// the row on the 7th are both compared with the 2nd
+	file := "symbol,date,close\n" +
+		symbol + ",2024-05-07,104\n" +
+		symbol + ",2024-05-06,150\n" +
+		symbol + ",2024-05-03,105\n" +
+		symbol + ",2024-05-02,101\n"
+
+	result, err := service.Import(strings.NewReader(file), PriceImportOptions{Format: PriceImportFormatCSV})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Inserted != 2 || result.Skipped != 1 || result.Quarantined != 1 || result.Rejected != 0 {
+		t.Fatalf("result = %+v, want 2 inserted, 1 skipped, 1 quarantined", result)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 3 {
+		t.Errorf("errors = %+v, want the quarantined row 3", result.Errors)
+	}
+
+	pending, err := priceService.ListQuarantinedPrices(models.QuarantineStatusPending)
+	if err != nil {
+		t.Fatalf("ListQuarantinedPrices: %v", err)
+	}
+	if len(pending) != 1 || pending[0].StockSymbol != symbol || !pending[0].Price.Equal(decimal.NewFromInt(150)) {
+		t.Fatalf("pending = %+v, want the 150 spike", pending)
+	}
+
+	// Approving the spike stores it at its session close
+	if _, err := priceService.ApproveQuarantinedPrice(pending[0].ID, "ops", ""); err != nil {
+		t.Fatalf("ApproveQuarantinedPrice: %v", err)
+	}
+
+	// Overwriting replaces the stored row rather than adding a second one
+	result, err = service.Import(strings.NewReader("symbol,date,close\n"+symbol+",2024-05-02,101\n"),
+		PriceImportOptions{Format: PriceImportFormatCSV, Overwrite: true})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Overwritten != 1 || result.Inserted != 0 {
+		t.Errorf("result = %+v, want 1 overwritten", result)
+	}
+
+	var count int64
+	if err := db.DB.Model(&models.PriceHistory{}).Where("stock_symbol = ?", symbol).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("stored %d prices, want 4", count)
+	}
+}
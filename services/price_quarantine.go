@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// minBandSamples is the number of prices needed before the rolling band is enforced
+const minBandSamples = 3
+
+var (
+	// ErrPriceQuarantined is returned by SavePrice when a price fails sanity checks
+	ErrPriceQuarantined = errors.New("price quarantined")
+
+	// ErrQuarantineNotFound is returned when a quarantined price does not exist
+	ErrQuarantineNotFound = errors.New("quarantined price not found")
+
+	// ErrQuarantineResolved is returned when a quarantined price was already reviewed
+	ErrQuarantineResolved = errors.New("quarantined price already reviewed")
+)
+
+// priceLimits are the per-symbol sanity limits from stock_config
+type priceLimits struct {
+	maxMovePct decimal.Decimal
+	bandPct    decimal.Decimal
+	bandWindow time.Duration
+}
+
+// defaultPriceLimits applies when a symbol has no stock_config row
+var defaultPriceLimits = priceLimits{
+	maxMovePct: decimal.NewFromInt(10),
+	bandPct:    decimal.NewFromInt(20),
+	bandWindow: 72 * time.Hour,
+}
+
+// priceCheck is the outcome of checking a price against its history
+type priceCheck struct {
+	reason   string
+	previous decimal.NullDecimal
+	bandLow  decimal.NullDecimal
+	bandHigh decimal.NullDecimal
+}
+
+// loadPriceLimits reads the sanity limits configured for a symbol
+func loadPriceLimits(symbol string) (priceLimits, error) {
+	var config models.StockConfig
+	err := db.DB.Where("stock_symbol = ?", symbol).First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPriceLimits, nil
+	}
+	if err != nil {
+		return priceLimits{}, fmt.Errorf("failed to load stock config: %w", err)
+	}
+
+	limits := priceLimits{
+		maxMovePct: config.MaxPriceMovePct,
+		bandPct:    config.PriceBandPct,
+		bandWindow: time.Duration(config.PriceBandWindowHours) * time.Hour,
+	}
+	if !limits.maxMovePct.IsPositive() {
+		limits.maxMovePct = defaultPriceLimits.maxMovePct
+	}
+	if !limits.bandPct.IsPositive() {
+		limits.bandPct = defaultPriceLimits.bandPct
+	}
+	if limits.bandWindow <= 0 {
+		limits.bandWindow = defaultPriceLimits.bandWindow
+	}
+	return limits, nil
+}
+
+// checkPrice compares a price with the previous price and the rolling band,
+// both taken from prices before timestamp (so a replaced price is not compared
+// with itself). Checks use the instrument's own currency so FX moves never trip them.
+func (s *PriceService) checkPrice(symbol string, price decimal.Decimal, timestamp time.Time) (priceCheck, error) {
+	limits, err := loadPriceLimits(symbol)
+	if err != nil {
+		return priceCheck{}, err
+	}
+	return s.checkPriceWithin(limits, symbol, price, timestamp)
+}
+
+// checkPriceWithin runs checkPrice with limits the caller has already loaded
+func (s *PriceService) checkPriceWithin(limits priceLimits, symbol string, price decimal.Decimal, timestamp time.Time) (priceCheck, error) {
+	var check priceCheck
+
+	var previous models.PriceHistory
+	err := db.DB.Where("stock_symbol = ? AND timestamp < ?", symbol, timestamp).
+		Order("timestamp DESC").
+		First(&previous).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// First price for the symbol: nothing to compare against
+		return check, nil
+	}
+	if err != nil {
+		return check, fmt.Errorf("failed to fetch previous price: %w", err)
+	}
+
+	check.previous = decimal.NewNullDecimal(previous.Price)
+
+	if movePct, ok := priceMovePct(price, previous.Price); ok && movePct.GreaterThan(limits.maxMovePct) {
+		check.reason = fmt.Sprintf("moved %s%% from previous price %s (limit %s%%)",
+			movePct.StringFixed(2), previous.Price.StringFixed(4), limits.maxMovePct.String())
+	}
+
+	var band struct {
+		Average decimal.NullDecimal
+		Samples int64
+	}
+	err = db.DB.Raw(`
+		SELECT AVG(price) AS average, COUNT(*) AS samples
+		FROM price_history
+		WHERE stock_symbol = ? AND timestamp > ? AND timestamp < ?
+	`, symbol, timestamp.Add(-limits.bandWindow), timestamp).Scan(&band).Error
+	if err != nil {
+		return check, fmt.Errorf("failed to compute price band: %w", err)
+	}
+
+	if band.Samples >= minBandSamples && band.Average.Valid {
+		width := band.Average.Decimal.Mul(limits.bandPct).Div(decimal.NewFromInt(100))
+		low := utils.RoundINR(band.Average.Decimal.Sub(width))
+		high := utils.RoundINR(band.Average.Decimal.Add(width))
+		check.bandLow = decimal.NewNullDecimal(low)
+		check.bandHigh = decimal.NewNullDecimal(high)
+
+		if check.reason == "" && (price.LessThan(low) || price.GreaterThan(high)) {
+			check.reason = fmt.Sprintf("outside rolling %s band %s-%s",
+				limits.bandWindow, low.StringFixed(4), high.StringFixed(4))
+		}
+	}
+
+	return check, nil
+}
+
+// priceMovePct returns the absolute percentage move from previous to price.
+// A zero previous price gives no basis for a move and ok is false.
+func priceMovePct(price, previous decimal.Decimal) (pct decimal.Decimal, ok bool) {
+	if previous.IsZero() {
+		return decimal.Zero, false
+	}
+	return price.Sub(previous).Div(previous).Mul(decimal.NewFromInt(100)).Abs(), true
+}
+
+// quarantinePrice stores a rejected price for review
+func (s *PriceService) quarantinePrice(priceHistory models.PriceHistory, check priceCheck) error {
+	symbol := priceHistory.StockSymbol
+	entry := models.PriceQuarantine{
+		StockSymbol:   symbol,
+		Price:         priceHistory.Price,
+		Currency:      priceHistory.Currency,
+		PriceINR:      priceHistory.PriceINR,
+		PreviousPrice: check.previous,
+		BandLow:       check.bandLow,
+		BandHigh:      check.bandHigh,
+		Reason:        check.reason,
+		Status:        models.QuarantineStatusPending,
+		Timestamp:     priceHistory.Timestamp,
+		Resolution:    priceHistory.Resolution,
+	}
+
+	if err := db.DB.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to quarantine price: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"quarantineId": entry.ID,
+		"symbol":       symbol,
+		"price":        priceHistory.Price,
+		"currency":     priceHistory.Currency,
+		"reason":       check.reason,
+	}).Warn("Price quarantined")
+
+	return fmt.Errorf("%w: %s %s", ErrPriceQuarantined, symbol, check.reason)
+}
+
+// hasPendingQuarantine reports whether a symbol has a price awaiting review
+func hasPendingQuarantine(symbol string) (bool, error) {
+	var count int64
+	err := db.DB.Model(&models.PriceQuarantine{}).
+		Where("stock_symbol = ? AND status = ?", symbol, models.QuarantineStatusPending).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check quarantined prices: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListQuarantinedPrices returns quarantined prices, optionally filtered by status
+func (s *PriceService) ListQuarantinedPrices(status models.QuarantineStatus) ([]models.PriceQuarantine, error) {
+	query := db.DB.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var entries []models.PriceQuarantine
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch quarantined prices: %w", err)
+	}
+	return entries, nil
+}
+
+// ApproveQuarantinedPrice publishes a quarantined price to price_history at its original timestamp
+func (s *PriceService) ApproveQuarantinedPrice(id uint, reviewer, note string) (*models.PriceQuarantine, error) {
+	var priceHistory models.PriceHistory
+	entry, err := s.reviewQuarantinedPrice(id, models.QuarantineStatusApproved, reviewer, note, func(tx *gorm.DB, entry *models.PriceQuarantine) error {
+		priceHistory = models.PriceHistory{
+			StockSymbol: entry.StockSymbol,
+			Price:       entry.Price,
+			Currency:    entry.Currency,
+			PriceINR:    entry.PriceINR,
+			Timestamp:   entry.Timestamp,
+			Resolution:  entry.Resolution,
+		}
+		// An imported price held for review may replace one stored at its timestamp
+		err := tx.Where("stock_symbol = ? AND timestamp = ?", entry.StockSymbol, entry.Timestamp).
+			Delete(&models.PriceHistory{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to replace existing price: %w", err)
+		}
+		if err := tx.Create(&priceHistory).Error; err != nil {
+			return fmt.Errorf("failed to save approved price: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.invalidate(entry.StockSymbol)
+	s.publishPrice(priceHistory)
+	return entry, nil
+}
+
+// RejectQuarantinedPrice discards a quarantined price
+func (s *PriceService) RejectQuarantinedPrice(id uint, reviewer, note string) (*models.PriceQuarantine, error) {
+	return s.reviewQuarantinedPrice(id, models.QuarantineStatusRejected, reviewer, note, nil)
+}
+
+// reviewQuarantinedPrice moves a pending entry to a final status inside a transaction
+func (s *PriceService) reviewQuarantinedPrice(id uint, status models.QuarantineStatus, reviewer, note string, apply func(tx *gorm.DB, entry *models.PriceQuarantine) error) (*models.PriceQuarantine, error) {
+	var entry models.PriceQuarantine
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&entry, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrQuarantineNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch quarantined price: %w", err)
+		}
+		if entry.Status != models.QuarantineStatusPending {
+			return ErrQuarantineResolved
+		}
+
+		if apply != nil {
+			if err := apply(tx, &entry); err != nil {
+				return err
+			}
+		}
+
+		reviewedAt := utils.NowUTC()
+		entry.Status = status
+		entry.ReviewedBy = reviewer
+		entry.ReviewNote = note
+		entry.ReviewedAt = &reviewedAt
+		return tx.Save(&entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"quarantineId": entry.ID,
+		"symbol":       entry.StockSymbol,
+		"status":       status,
+		"reviewedBy":   reviewer,
+	}).Info("Quarantined price reviewed")
+
+	return &entry, nil
+}
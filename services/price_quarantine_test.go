@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPriceMovePct(t *testing.T) {
+	tests := []struct {
+		price, previous string
+		want            string
+		ok              bool
+	}{
+		{"110", "100", "10", true},
+		{"90", "100", "10", true},
+		{"100", "100", "0", true},
+		{"100", "0", "0", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := priceMovePct(decimal.RequireFromString(tt.price), decimal.RequireFromString(tt.previous))
+		if ok != tt.ok || !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("priceMovePct(%s, %s) = %s, %v; want %s, %v", tt.price, tt.previous, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestQuarantineReview(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "QTEST"
+	mustCreate(t, &models.StockConfig{
+		StockSymbol:          symbol,
+		Currency:             "INR",
+		Multiplier:           decimal.NewFromInt(1),
+		IsActive:             true,
+		MaxPriceMovePct:      decimal.NewFromInt(10),
+		PriceBandPct:         decimal.NewFromInt(20),
+		PriceBandWindowHours: 72,
+	})
+
+	service := NewPriceService(NewMarketCalendar())
+	start := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(100),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(100),
+		Timestamp:   start,
+		Resolution:  models.PriceResolutionDaily,
+	})
+
+	spike := func(price int64, day int, previous int64) models.PriceQuarantine {
+		t.Helper()
+		priceHistory := models.PriceHistory{
+			StockSymbol: symbol,
+			Price:       decimal.NewFromInt(price),
+			Currency:    "INR",
+			PriceINR:    decimal.NewFromInt(price),
+			Timestamp:   start.AddDate(0, 0, day),
+			Resolution:  models.PriceResolutionDaily,
+		}
+		if err := service.recordPrice(priceHistory, false); !errors.Is(err, ErrPriceQuarantined) {
+			t.Fatalf("recordPrice(%d) = %v, want ErrPriceQuarantined", price, err)
+		}
+
+		var entry models.PriceQuarantine
+		err := db.DB.Where("stock_symbol = ? AND timestamp = ?", symbol, priceHistory.Timestamp).First(&entry).Error
+		if err != nil {
+			t.Fatalf("quarantine entry: %v", err)
+		}
+		if entry.Status != models.QuarantineStatusPending || entry.Resolution != models.PriceResolutionDaily ||
+			!entry.PreviousPrice.Decimal.Equal(decimal.NewFromInt(previous)) {
+			t.Fatalf("entry = %+v, want a PENDING DAILY entry against %d", entry, previous)
+		}
+		return entry
+	}
+	stored := func(day int) []models.PriceHistory {
+		t.Helper()
+		var prices []models.PriceHistory
+		err := db.DB.Where("stock_symbol = ? AND timestamp = ?", symbol, start.AddDate(0, 0, day)).Find(&prices).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return prices
+	}
+
+	approved := spike(150, 1, 100)
+	if prices := stored(1); len(prices) != 0 {
+		t.Fatalf("quarantined price was stored: %+v", prices)
+	}
+	entry, err := service.ApproveQuarantinedPrice(approved.ID, "ops", "confirmed split")
+	if err != nil {
+		t.Fatalf("ApproveQuarantinedPrice: %v", err)
+	}
+	if entry.Status != models.QuarantineStatusApproved || entry.ReviewedBy != "ops" || entry.ReviewedAt == nil {
+		t.Errorf("approved entry = %+v", entry)
+	}
+	if prices := stored(1); len(prices) != 1 || !prices[0].Price.Equal(decimal.NewFromInt(150)) ||
+		prices[0].Resolution != models.PriceResolutionDaily {
+		t.Errorf("approved prices = %+v, want one DAILY 150", prices)
+	}
+	if _, err := service.ApproveQuarantinedPrice(approved.ID, "ops", ""); !errors.Is(err, ErrQuarantineResolved) {
+		t.Errorf("second approve = %v, want ErrQuarantineResolved", err)
+	}
+
+	rejected := spike(50, 2, 150)
+	entry, err = service.RejectQuarantinedPrice(rejected.ID, "ops", "bad tick")
+	if err != nil {
+		t.Fatalf("RejectQuarantinedPrice: %v", err)
+	}
+	if entry.Status != models.QuarantineStatusRejected || entry.ReviewNote != "bad tick" {
+		t.Errorf("rejected entry = %+v", entry)
+	}
+	if prices := stored(2); len(prices) != 0 {
+		t.Errorf("rejected price was stored: %+v", prices)
+	}
+
+	if _, err := service.RejectQuarantinedPrice(rejected.ID+1000, "ops", ""); !errors.Is(err, ErrQuarantineNotFound) {
+		t.Errorf("reject unknown = %v, want ErrQuarantineNotFound", err)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetentionFullDays   = 30
+	defaultRetentionBatchSize  = 1000
+	defaultRetentionBatchPause = 100 * time.Millisecond
+)
+
+// PriceRetentionConfig controls how price_history is compacted
+type PriceRetentionConfig struct {
+	// FullResolutionDays is how many recent exchange days keep every price
+	FullResolutionDays int
+	// BatchSize is the maximum number of rows deleted per statement
+	BatchSize int
+	// BatchPause is slept between statements to let other writers through
+	BatchPause time.Duration
+}
+
+// LoadPriceRetentionConfig reads PRICE_RETENTION_* environment variables
+func LoadPriceRetentionConfig() PriceRetentionConfig {
+	return PriceRetentionConfig{
+		FullResolutionDays: utils.IntFromEnv("PRICE_RETENTION_FULL_DAYS", defaultRetentionFullDays),
+		BatchSize:          utils.IntFromEnv("PRICE_RETENTION_BATCH_SIZE", defaultRetentionBatchSize),
+		BatchPause:         utils.NonNegativeDurationFromEnv("PRICE_RETENTION_BATCH_PAUSE", defaultRetentionBatchPause),
+	}
+}
+
+// PriceRetentionResult summarises a retention run
+type PriceRetentionResult struct {
+	Days      int   `json:"days"`
+	Deleted   int64 `json:"deleted"`
+	Compacted int64 `json:"compacted"`
+}
+
+// PriceRetentionService downsamples old price_history rows to one close per day.
+// Compacted days keep their last price, so "latest price at or before t"
+// lookups (GetPriceAtTime, GetPricesForDate) resolve to the day's close.
+type PriceRetentionService struct {
+	calendar *MarketCalendar
+	config   PriceRetentionConfig
+}
+
+// NewPriceRetentionService creates a new price retention service
+func NewPriceRetentionService(calendar *MarketCalendar, config PriceRetentionConfig) *PriceRetentionService {
+	return &PriceRetentionService{
+		calendar: calendar,
+		config:   config,
+	}
+}
+
+// Run compacts every exchange day older than the full-resolution window,
+// one day at a time and in bounded batches.
+func (s *PriceRetentionService) Run() (*PriceRetentionResult, error) {
+	location := s.calendar.Location()
+	today := utils.StartOfDay(utils.NowUTC().In(location))
+	cutoff := today.AddDate(0, 0, -s.config.FullResolutionDays)
+
+	// Resume from the oldest day that still has raw rows
+	var oldest struct {
+		Timestamp *time.Time
+	}
+	err := db.DB.Raw(`
+		SELECT MIN(timestamp) AS timestamp
+		FROM price_history
+		WHERE resolution = ? AND timestamp < ?
+	`, models.PriceResolutionRaw, cutoff).Scan(&oldest).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find oldest raw price: %w", err)
+	}
+
+	result := &PriceRetentionResult{}
+	if oldest.Timestamp == nil {
+		return result, nil
+	}
+
+	for day := utils.StartOfDay(oldest.Timestamp.In(location)); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		deleted, compacted, err := s.compactDay(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return result, fmt.Errorf("failed to compact %s: %w", utils.GetDateString(day), err)
+		}
+		result.Days++
+		result.Deleted += deleted
+		result.Compacted += compacted
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"days":      result.Days,
+		"deleted":   result.Deleted,
+		"compacted": result.Compacted,
+		"cutoff":    utils.GetDateString(cutoff),
+	}).Info("Price retention completed")
+
+	return result, nil
+}
+
+// compactDay keeps only the last price per symbol in [start, end)
+func (s *PriceRetentionService) compactDay(start, end time.Time) (int64, int64, error) {
+	var deleted int64
+
+	for {
+		res := db.DB.Exec(`
+			DELETE FROM price_history
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (
+						PARTITION BY stock_symbol
+						ORDER BY timestamp DESC, id DESC
+					) AS rn
+					FROM price_history
+					WHERE timestamp >= ? AND timestamp < ?
+				) ranked
+				WHERE rn > 1
+				LIMIT ?
+			)
+		`, start, end, s.config.BatchSize)
+		if res.Error != nil {
+			return deleted, 0, res.Error
+		}
+
+		deleted += res.RowsAffected
+		if res.RowsAffected < int64(s.config.BatchSize) {
+			break
+		}
+		time.Sleep(s.config.BatchPause)
+	}
+
+	res := db.DB.Model(&models.PriceHistory{}).
+		Where("timestamp >= ? AND timestamp < ? AND resolution = ?", start, end, models.PriceResolutionRaw).
+		Update("resolution", models.PriceResolutionDaily)
+	if res.Error != nil {
+		return deleted, 0, res.Error
+	}
+
+	return deleted, res.RowsAffected, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestLoadPriceRetentionConfig(t *testing.T) {
+	t.Setenv("PRICE_RETENTION_FULL_DAYS", "")
+	t.Setenv("PRICE_RETENTION_BATCH_SIZE", "0")
+	t.Setenv("PRICE_RETENTION_BATCH_PAUSE", "0")
+
+	config := LoadPriceRetentionConfig()
+	want := PriceRetentionConfig{
+		FullResolutionDays: defaultRetentionFullDays,
+		BatchSize:          defaultRetentionBatchSize,
+		BatchPause:         0,
+	}
+	if config != want {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+
+	t.Setenv("PRICE_RETENTION_FULL_DAYS", "7")
+	t.Setenv("PRICE_RETENTION_BATCH_SIZE", "250")
+	t.Setenv("PRICE_RETENTION_BATCH_PAUSE", "1s")
+	config = LoadPriceRetentionConfig()
+	want = PriceRetentionConfig{FullResolutionDays: 7, BatchSize: 250, BatchPause: time.Second}
+	if config != want {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+}
+
+func TestCompactDay(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "RETTEST"
+	calendar := NewMarketCalendar()
+	priceService := NewPriceService(calendar)
+	service := NewPriceRetentionService(calendar, PriceRetentionConfig{BatchSize: 1})
+
+	// 2020-03-03 is compacted; the raw price on the 4th is left alone
+	for _, row := range []struct {
+		at    string
+		price int64
+	}{
+		{"2020-03-03 10:00", 100},
+		{"2020-03-03 12:00", 101},
+		{"2020-03-03 15:30", 102},
+		{"2020-03-04 10:00", 103},
+	} {
+		mustCreate(t, &models.PriceHistory{
+			StockSymbol: symbol,
+			Price:       decimal.NewFromInt(row.price),
+			Currency:    "INR",
+			PriceINR:    decimal.NewFromInt(row.price),
+			Timestamp:   istTime(t, row.at).UTC(),
+			Resolution:  models.PriceResolutionRaw,
+		})
+	}
+
+	day := istTime(t, "2020-03-03 00:00")
+	deleted, compacted, err := service.compactDay(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("compactDay: %v", err)
+	}
+	if deleted != 2 || compacted != 1 {
+		t.Errorf("deleted %d, compacted %d; want 2 and 1", deleted, compacted)
+	}
+
+	var prices []models.PriceHistory
+	if err := db.DB.Where("stock_symbol = ?", symbol).Order("timestamp").Find(&prices).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 {
+		t.Fatalf("kept %d prices, want 2", len(prices))
+	}
+	kept := prices[0]
+	if !kept.Timestamp.Equal(istTime(t, "2020-03-03 15:30")) || !kept.Price.Equal(decimal.NewFromInt(102)) ||
+		kept.Resolution != models.PriceResolutionDaily {
+		t.Errorf("kept %s %s (%s), want the DAILY 102 close at 15:30", kept.Timestamp, kept.Price, kept.Resolution)
+	}
+	if prices[1].Resolution != models.PriceResolutionRaw {
+		t.Errorf("next day's price is %s, want RAW", prices[1].Resolution)
+	}
+
+	for _, tt := range []struct {
+		at   string
+		want int64
+	}{
+		{"2020-03-03 18:00", 102},
+		{"2020-03-04 09:00", 102},
+		{"2020-03-04 11:00", 103},
+	} {
+		got, err := priceService.GetPriceAtTime(symbol, istTime(t, tt.at))
+		if err != nil {
+			t.Fatalf("GetPriceAtTime(%s): %v", tt.at, err)
+		}
+		if !got.Equal(decimal.NewFromInt(tt.want)) {
+			t.Errorf("GetPriceAtTime(%s) = %s, want %d", tt.at, got, tt.want)
+		}
+	}
+
+	for date, want := range map[string]int64{"2020-03-03": 102, "2020-03-04": 103} {
+		parsed, _ := time.Parse("2006-01-02", date)
+		got, err := priceService.GetPricesForDate(parsed)
+		if err != nil {
+			t.Fatalf("GetPricesForDate(%s): %v", date, err)
+		}
+		if !got[symbol].Equal(decimal.NewFromInt(want)) {
+			t.Errorf("GetPricesForDate(%s) = %s, want %d", date, got[symbol], want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"stocky-backend/db"
 	"stocky-backend/models"
@@ -12,20 +13,71 @@ import (
 	"gorm.io/gorm"
 )
 
+// PriceProvider supplies market prices (in each instrument's currency) and FX rates
+type PriceProvider interface {
+	GeneratePrice(symbol string) decimal.Decimal
+	GeneratePricesForAllStocks() map[string]decimal.Decimal
+	UpdateBasePrice(symbol string, price decimal.Decimal)
+	// GenerateFxRate returns zero for an unknown currency
+	GenerateFxRate(currency string) decimal.Decimal
+}
+
+// Quote is a price in the instrument's currency together with its INR value
+type Quote struct {
+	Symbol    string          `json:"symbol"`
+	Currency  string          `json:"currency"`
+	Price     decimal.Decimal `json:"price"`
+	FxRate    decimal.Decimal `json:"fxRate"`
+	PriceINR  decimal.Decimal `json:"priceInr"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// newQuote converts a price to INR with the given rate
+func newQuote(symbol, currency string, price, fxRate decimal.Decimal, timestamp time.Time) Quote {
+	return Quote{
+		Symbol:    symbol,
+		Currency:  currency,
+		Price:     price,
+		FxRate:    fxRate,
+		PriceINR:  utils.RoundINR(price.Mul(fxRate)),
+		Timestamp: timestamp,
+	}
+}
+
 // PriceService handles stock price operations
 type PriceService struct {
-	generator *utils.PriceGenerator
+	generator PriceProvider
+	calendar  *MarketCalendar
+	cache     *priceCache
 }
 
 // NewPriceService creates a new price service
-func NewPriceService() *PriceService {
+func NewPriceService(calendar *MarketCalendar) *PriceService {
 	return &PriceService{
 		generator: utils.NewPriceGenerator(),
+		calendar:  calendar,
+		cache:     newPriceCache(),
 	}
 }
 
-// GetCurrentPrice retrieves the current price for a stock
+// GetCurrentPrice retrieves the current INR price for a stock
 func (s *PriceService) GetCurrentPrice(symbol string) (decimal.Decimal, error) {
+	quote, err := s.GetCurrentQuote(symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return quote.PriceINR, nil
+}
+
+// GetCurrentQuote retrieves the current price for a stock with its INR conversion
+func (s *PriceService) GetCurrentQuote(symbol string) (Quote, error) {
+	return s.cache.load(symbol, func() (Quote, error) {
+		return s.loadCurrentQuote(symbol)
+	})
+}
+
+// loadCurrentQuote reads the latest price from the database, generating one if missing or stale
+func (s *PriceService) loadCurrentQuote(symbol string) (Quote, error) {
 	var priceHistory models.PriceHistory
 
 	// Try to get the latest price from database
@@ -40,25 +92,153 @@ func (s *PriceService) GetCurrentPrice(symbol string) (decimal.Decimal, error) {
 			if err := s.SavePrice(symbol, price); err != nil {
 				logrus.Warnf("Failed to save generated price: %v", err)
 			}
-			return price, nil
+			return s.quoteNow(symbol, price)
 		}
-		return decimal.Zero, fmt.Errorf("failed to fetch price: %w", err)
+		return Quote{}, fmt.Errorf("failed to fetch price: %w", err)
 	}
 
-	// Check if price is recent (within last 2 hours)
-	if time.Since(priceHistory.Timestamp) > 2*time.Hour {
+	if s.isStale(priceHistory) {
+		// A price held for review would only be quarantined again
+		pending, err := hasPendingQuarantine(symbol)
+		if err != nil {
+			return Quote{}, err
+		}
+		if pending {
+			return s.quoteFromHistory(priceHistory)
+		}
+
 		logrus.Warnf("Price for %s is stale, generating new price", symbol)
 		price := s.generator.GeneratePrice(symbol)
 		if err := s.SavePrice(symbol, price); err != nil {
+			if errors.Is(err, ErrPriceQuarantined) {
+				// Keep serving the last accepted price
+				return s.quoteFromHistory(priceHistory)
+			}
 			logrus.Warnf("Failed to save generated price: %v", err)
 		}
-		return price, nil
+		return s.quoteNow(symbol, price)
+	}
+
+	return s.quoteFromHistory(priceHistory)
+}
+
+// quoteNow converts a freshly generated price at the current FX rate
+func (s *PriceService) quoteNow(symbol string, price decimal.Decimal) (Quote, error) {
+	return s.quoteAt(symbol, price, utils.NowUTC())
+}
+
+// quoteAt converts a generated price at the FX rate in force at timestamp, so a
+// past close is not valued at today's rate
+func (s *PriceService) quoteAt(symbol string, price decimal.Decimal, timestamp time.Time) (Quote, error) {
+	currency, err := instrumentCurrency(symbol)
+	if err != nil {
+		return Quote{}, err
+	}
+	rate, err := s.GetFxRateAt(currency, timestamp)
+	if err != nil {
+		return Quote{}, err
+	}
+	return newQuote(symbol, currency, price, rate, timestamp), nil
+}
+
+// quoteFromHistory converts a stored latest price at the current FX rate
+func (s *PriceService) quoteFromHistory(priceHistory models.PriceHistory) (Quote, error) {
+	rate, err := s.GetCurrentFxRate(priceHistory.Currency)
+	if err != nil {
+		return Quote{}, err
+	}
+	return newQuote(priceHistory.StockSymbol, priceHistory.Currency, priceHistory.Price, rate, priceHistory.Timestamp), nil
+}
+
+// isStale reports whether a latest price is too old to use during a session.
+// Outside trading sessions the latest price is the last session close.
+func (s *PriceService) isStale(priceHistory models.PriceHistory) bool {
+	if !s.calendar.IsMarketOpen(utils.NowUTC()) {
+		return false
+	}
+
+	// Check if price is recent (within last 2 hours)
+	return time.Since(priceHistory.Timestamp) > 2*time.Hour
+}
+
+// GetCurrentPrices retrieves current INR prices for several stocks.
+// Symbols whose price cannot be resolved are omitted.
+func (s *PriceService) GetCurrentPrices(symbols []string) (map[string]decimal.Decimal, error) {
+	quotes, err := s.GetCurrentQuotes(symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]decimal.Decimal, len(quotes))
+	for symbol, quote := range quotes {
+		prices[symbol] = quote.PriceINR
+	}
+	return prices, nil
+}
+
+// GetCurrentQuotes retrieves current quotes for several stocks using one query
+// for all cache misses. Symbols whose price cannot be resolved are omitted.
+func (s *PriceService) GetCurrentQuotes(symbols []string) (map[string]Quote, error) {
+	quotes := make(map[string]Quote, len(symbols))
+
+	var misses []string
+	versions := make(map[string]uint64)
+	for _, symbol := range symbols {
+		if quote, ok := s.cache.get(symbol); ok {
+			quotes[symbol] = quote
+			continue
+		}
+		versions[symbol] = s.cache.version(symbol)
+		misses = append(misses, symbol)
+	}
+
+	if len(misses) == 0 {
+		return quotes, nil
+	}
+
+	var latest []models.PriceHistory
+	err := db.DB.Raw(`
+		SELECT DISTINCT ON (stock_symbol) *
+		FROM price_history
+		WHERE stock_symbol IN ?
+		ORDER BY stock_symbol, timestamp DESC
+	`, misses).Scan(&latest).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+	}
+
+	found := make(map[string]bool, len(latest))
+	for _, p := range latest {
+		if s.isStale(p) {
+			continue
+		}
+		quote, err := s.quoteFromHistory(p)
+		if err != nil {
+			logrus.Warnf("Failed to convert price for %s: %v", p.StockSymbol, err)
+			continue
+		}
+		found[p.StockSymbol] = true
+		quotes[p.StockSymbol] = quote
+		s.cache.set(p.StockSymbol, quote, versions[p.StockSymbol])
 	}
 
-	return priceHistory.PriceINR, nil
+	// Missing or stale symbols go through the single-symbol path, which generates prices
+	for _, symbol := range misses {
+		if found[symbol] {
+			continue
+		}
+		quote, err := s.GetCurrentQuote(symbol)
+		if err != nil {
+			logrus.Warnf("Failed to get current price for %s: %v", symbol, err)
+			continue
+		}
+		quotes[symbol] = quote
+	}
+
+	return quotes, nil
 }
 
-// GetPriceAtTime retrieves the price for a stock at a specific time
+// GetPriceAtTime retrieves the INR price for a stock at a specific time
 func (s *PriceService) GetPriceAtTime(symbol string, timestamp time.Time) (decimal.Decimal, error) {
 	var priceHistory models.PriceHistory
 
@@ -76,19 +256,38 @@ func (s *PriceService) GetPriceAtTime(symbol string, timestamp time.Time) (decim
 		return decimal.Zero, fmt.Errorf("failed to fetch historical price: %w", err)
 	}
 
-	return priceHistory.PriceINR, nil
+	// Convert at the rate in force at the valuation time
+	rate, err := s.GetFxRateAt(priceHistory.Currency, timestamp)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return utils.RoundINR(priceHistory.Price.Mul(rate)), nil
 }
 
-// SavePrice saves a new price to the database
+// SavePrice saves a new price, given in the instrument's currency, to the database
+// Prices that fail the per-symbol sanity checks are quarantined instead and
+// ErrPriceQuarantined is returned.
 func (s *PriceService) SavePrice(symbol string, price decimal.Decimal) error {
+	return s.savePriceAt(symbol, price, utils.NowUTC())
+}
+
+// savePriceAt saves a price as SavePrice does, stamped at timestamp
+func (s *PriceService) savePriceAt(symbol string, price decimal.Decimal, timestamp time.Time) error {
+	quote, err := s.quoteAt(symbol, utils.RoundINR(price), timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to convert price: %w", err)
+	}
+
 	priceHistory := models.PriceHistory{
 		StockSymbol: symbol,
-		PriceINR:    utils.RoundINR(price),
-		Timestamp:   utils.NowUTC(),
+		Price:       quote.Price,
+		Currency:    quote.Currency,
+		PriceINR:    quote.PriceINR,
+		Timestamp:   quote.Timestamp,
 	}
-
-	if err := db.DB.Create(&priceHistory).Error; err != nil {
-		return fmt.Errorf("failed to save price: %w", err)
+	if err := s.recordPrice(priceHistory, false); err != nil {
+		return err
 	}
 
 	// Update generator base price for gradual movement
@@ -102,14 +301,58 @@ func (s *PriceService) SavePrice(symbol string, price decimal.Decimal) error {
 	return nil
 }
 
-// UpdateAllPrices generates and saves new prices for all stocks
+// recordPrice runs a price through the sanity checks and writes it to
+// price_history, or quarantines it and returns ErrPriceQuarantined. With
+// replace, a price already stored for the symbol at the same timestamp is
+// replaced. Accepted prices invalidate the cache and are published.
+func (s *PriceService) recordPrice(priceHistory models.PriceHistory, replace bool) error {
+	symbol := priceHistory.StockSymbol
+	check, err := s.checkPrice(symbol, priceHistory.Price, priceHistory.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to check price: %w", err)
+	}
+	if check.reason != "" {
+		return s.quarantinePrice(priceHistory, check)
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			err := tx.Where("stock_symbol = ? AND timestamp = ?", symbol, priceHistory.Timestamp).
+				Delete(&models.PriceHistory{}).Error
+			if err != nil {
+				return fmt.Errorf("failed to replace existing price: %w", err)
+			}
+		}
+		if err := tx.Create(&priceHistory).Error; err != nil {
+			return fmt.Errorf("failed to save price: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidate(symbol)
+	s.publishPrice(priceHistory)
+	return nil
+}
+
+// UpdateAllPrices generates and saves new FX rates and prices for all stocks
 func (s *PriceService) UpdateAllPrices() error {
 	logrus.Info("Updating prices for all stocks...")
 
+	// Refresh FX first so new prices convert at the new rates
+	if err := s.UpdateAllFxRates(); err != nil {
+		logrus.Errorf("Failed to update FX rates: %v", err)
+	}
+
 	prices := s.generator.GeneratePricesForAllStocks()
-	
+
 	for symbol, price := range prices {
 		if err := s.SavePrice(symbol, price); err != nil {
+			if errors.Is(err, ErrPriceQuarantined) {
+				continue
+			}
 			logrus.Errorf("Failed to save price for %s: %v", symbol, err)
 			continue
 		}
@@ -119,6 +362,30 @@ func (s *PriceService) UpdateAllPrices() error {
 	return nil
 }
 
+// RecordClosePrices generates and saves a price for every stock stamped at
+// the last session close, so each trading day has a price at its close
+func (s *PriceService) RecordClosePrices() error {
+	closeTime := s.calendar.LastSessionClose(utils.NowUTC())
+	logrus.WithField("close", closeTime).Info("Recording session close prices...")
+
+	var failed int
+	prices := s.generator.GeneratePricesForAllStocks()
+	for symbol, price := range prices {
+		if err := s.savePriceAt(symbol, price, closeTime); err != nil {
+			if errors.Is(err, ErrPriceQuarantined) {
+				continue
+			}
+			logrus.Errorf("Failed to save close price for %s: %v", symbol, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to save %d of %d close prices", failed, len(prices))
+	}
+	return nil
+}
+
 // GetPricesForDate retrieves all prices for a specific date
 func (s *PriceService) GetPricesForDate(date time.Time) (map[string]decimal.Decimal, error) {
 	startOfDay := utils.StartOfDayUTC(date)
@@ -140,8 +407,41 @@ func (s *PriceService) GetPricesForDate(date time.Time) (map[string]decimal.Deci
 
 	priceMap := make(map[string]decimal.Decimal)
 	for _, p := range prices {
-		priceMap[p.StockSymbol] = p.PriceINR
+		rate, err := s.GetFxRateAt(p.Currency, endOfDay)
+		if err != nil {
+			return nil, err
+		}
+		priceMap[p.StockSymbol] = utils.RoundINR(p.Price.Mul(rate))
 	}
 
 	return priceMap, nil
 }
+
+// publishPrice notifies stream subscribers of a recorded price. It runs outside
+// any transaction, since a failed NOTIFY would abort the transaction it ran in.
+func (s *PriceService) publishPrice(priceHistory models.PriceHistory) {
+	err := notify(db.DB, PriceEventsChannel, PriceEvent{
+		ID:        priceHistory.ID,
+		Symbol:    priceHistory.StockSymbol,
+		Price:     priceHistory.Price,
+		Currency:  priceHistory.Currency,
+		PriceINR:  priceHistory.PriceINR,
+		Timestamp: priceHistory.Timestamp,
+	})
+	if err != nil {
+		logrus.Warnf("Failed to publish price event for %s: %v", priceHistory.StockSymbol, err)
+	}
+}
+
+// GetPricesSince returns prices recorded after the given price_history ID, oldest first
+func (s *PriceService) GetPricesSince(afterID uint, limit int) ([]models.PriceHistory, error) {
+	var prices []models.PriceHistory
+	err := db.DB.Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&prices).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+	}
+	return prices, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"stocky-backend/models"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestNewQuote(t *testing.T) {
+	at := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	quote := newQuote("AAPL", "USD", decimal.RequireFromString("182.123"), decimal.RequireFromString("83.456789"), at)
+	if want := decimal.RequireFromString("15199.4008"); !quote.PriceINR.Equal(want) {
+		t.Errorf("PriceINR = %s, want %s", quote.PriceINR, want)
+	}
+	if quote.Symbol != "AAPL" || quote.Currency != "USD" || !quote.Timestamp.Equal(at) {
+		t.Errorf("quote = %+v", quote)
+	}
+
+	inr := newQuote("TCS", "INR", decimal.RequireFromString("3850.5"), decimal.NewFromInt(1), at)
+	if !inr.PriceINR.Equal(inr.Price) {
+		t.Errorf("INR quote PriceINR = %s, want %s", inr.PriceINR, inr.Price)
+	}
+}
+
+func TestQuoteAtUsesRateAtTimestamp(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "FXTEST"
+	mustCreate(t, &models.StockConfig{
+		StockSymbol: symbol,
+		Currency:    "USD",
+		Multiplier:  decimal.NewFromInt(1),
+		IsActive:    true,
+	})
+
+	// A past close is converted at the rate then, not at the later one
+	closeTime := time.Date(2001, 5, 2, 10, 0, 0, 0, time.UTC)
+	mustCreate(t, &models.FxRate{Currency: "USD", RateINR: decimal.NewFromInt(80), Timestamp: closeTime.Add(-time.Hour)})
+	mustCreate(t, &models.FxRate{Currency: "USD", RateINR: decimal.NewFromInt(85), Timestamp: closeTime.Add(time.Hour)})
+
+	quote, err := NewPriceService(NewMarketCalendar()).quoteAt(symbol, decimal.NewFromInt(100), closeTime)
+	if err != nil {
+		t.Fatalf("quoteAt: %v", err)
+	}
+	if !quote.FxRate.Equal(decimal.NewFromInt(80)) || !quote.PriceINR.Equal(decimal.NewFromInt(8000)) {
+		t.Errorf("quote at %s INR (rate %s), want 8000 at 80", quote.PriceINR, quote.FxRate)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"stocky-backend/db"
 	"stocky-backend/models"
 	"stocky-backend/utils"
@@ -15,27 +16,41 @@ import (
 
 // RewardService handles reward operations
 type RewardService struct {
-	priceService  *PriceService
-	ledgerService *LedgerService
+	priceService    *PriceService
+	ledgerService   *LedgerService
+	treasuryService *TreasuryService
+	brokerService   *BrokerService
+	calendar        *MarketCalendar
 }
 
 // NewRewardService creates a new reward service
-func NewRewardService(priceService *PriceService, ledgerService *LedgerService) *RewardService {
+func NewRewardService(priceService *PriceService, ledgerService *LedgerService, treasuryService *TreasuryService, brokerService *BrokerService, calendar *MarketCalendar) *RewardService {
 	return &RewardService{
-		priceService:  priceService,
-		ledgerService: ledgerService,
+		priceService:    priceService,
+		ledgerService:   ledgerService,
+		treasuryService: treasuryService,
+		brokerService:   brokerService,
+		calendar:        calendar,
 	}
 }
 
-// CreateReward creates a new reward event with ledger entries
-func (s *RewardService) CreateReward(userID int, symbol string, quantity decimal.Decimal, timestamp time.Time) error {
+// CreateReward creates a new reward event, draws its shares from treasury
+// inventory and books its ledger entries. campaign optionally tags the reward
+// for analytics. When inventory runs short the reward is refused with
+// ErrInsufficientInventory (the default), recorded as QUEUED behind any
+// rewards already queued for the symbol, or, when configured explicitly,
+// issued without a draw, depending on the shortfall policy.
+// Under broker fulfilment the shares are bought with a buy order instead,
+// netted with other rewards when a netting window is set, and the estimated
+// cost is adjusted when the order fills.
+func (s *RewardService) CreateReward(userID int, symbol string, quantity decimal.Decimal, timestamp time.Time, campaign string) (*models.RewardEvent, error) {
 	// Validate inputs
 	if err := utils.ValidateStockSymbol(symbol); err != nil {
-		return fmt.Errorf("invalid stock symbol: %w", err)
+		return nil, fmt.Errorf("invalid stock symbol: %w", err)
 	}
 
 	if err := utils.ValidateQuantity(quantity); err != nil {
-		return fmt.Errorf("invalid quantity: %w", err)
+		return nil, fmt.Errorf("invalid quantity: %w", err)
 	}
 
 	// Round quantity to 6 decimal places
@@ -53,23 +68,25 @@ func (s *RewardService) CreateReward(userID int, symbol string, quantity decimal
 			"quantity":  quantity,
 			"timestamp": timestamp,
 		}).Warn("Duplicate reward detected, rejecting")
-		return fmt.Errorf("duplicate reward: identical reward already exists")
+		return nil, fmt.Errorf("duplicate reward: identical reward already exists")
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("failed to check for duplicates: %w", err)
+		return nil, fmt.Errorf("failed to check for duplicates: %w", err)
 	}
 
 	// Get current price for the stock
-	pricePerShare, err := s.priceService.GetCurrentPrice(symbol)
+	quote, err := s.priceService.GetCurrentQuote(symbol)
 	if err != nil {
-		return fmt.Errorf("failed to get stock price: %w", err)
+		return nil, fmt.Errorf("failed to get stock price: %w", err)
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"userId":       userID,
-		"symbol":       symbol,
-		"quantity":     quantity,
-		"pricePerShare": pricePerShare,
-		"timestamp":    timestamp,
+		"userId":        userID,
+		"symbol":        symbol,
+		"quantity":      quantity,
+		"pricePerShare": quote.PriceINR,
+		"currency":      quote.Currency,
+		"fxRate":        quote.FxRate,
+		"timestamp":     timestamp,
 	}).Info("Creating reward event")
 
 	// Start transaction
@@ -80,28 +97,97 @@ func (s *RewardService) CreateReward(userID int, symbol string, quantity decimal
 		}
 	}()
 
+	// Shares drawn from treasury settle T+1 from today, whatever the reward's
+	// timestamp; shares bought through the broker are dated when the order fills
+	settlementDate := ""
+	if !s.brokerService.PlacesRewardOrders() {
+		settlementDate = s.calendar.SettlementDate(utils.NowUTC())
+	}
+
 	// Create reward event
 	rewardEvent := models.RewardEvent{
-		UserID:      userID,
-		StockSymbol: symbol,
-		Quantity:    quantity,
-		Timestamp:   timestamp,
+		UserID:           userID,
+		StockSymbol:      symbol,
+		Quantity:         quantity,
+		Campaign:         campaign,
+		Status:           models.RewardStatusIssued,
+		SettlementStatus: models.SettlementUnsettled,
+		SettlementDate:   settlementDate,
+		Timestamp:        timestamp,
 	}
 
 	if err := tx.Create(&rewardEvent).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to create reward event: %w", err)
+		return nil, fmt.Errorf("failed to create reward event: %w", err)
+	}
+
+	// Buy the shares through the broker, or draw them from treasury inventory (FIFO)
+	var order *models.BrokerOrder
+	if s.brokerService.PlacesRewardOrders() {
+		if order, err = s.brokerService.orderRewardInTx(tx, &rewardEvent, quote); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else if err := s.treasuryService.drawForRewardInTx(tx, &rewardEvent); err != nil {
+		if !errors.Is(err, ErrInsufficientInventory) || !(s.treasuryService.IssueOnShortfall() || s.treasuryService.QueueOnShortfall()) {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if s.treasuryService.IssueOnShortfall() {
+			logrus.WithFields(logrus.Fields{
+				"rewardId": rewardEvent.ID,
+				"userId":   userID,
+				"symbol":   symbol,
+				"quantity": quantity,
+			}).Warn("Treasury inventory short, reward issued without a draw")
+		} else {
+			// Queued rewards get their settlement date when issued
+			rewardEvent.Status = models.RewardStatusQueued
+			rewardEvent.SettlementDate = ""
+			if err := tx.Model(&rewardEvent).Updates(map[string]interface{}{
+				"status":          rewardEvent.Status,
+				"settlement_date": rewardEvent.SettlementDate,
+			}).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to queue reward: %w", err)
+			}
+			if err := tx.Commit().Error; err != nil {
+				return nil, fmt.Errorf("failed to commit transaction: %w", err)
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"rewardId": rewardEvent.ID,
+				"userId":   userID,
+				"symbol":   symbol,
+				"quantity": quantity,
+			}).Warn("Treasury inventory short, reward queued")
+			return &rewardEvent, nil
+		}
 	}
 
 	// Create ledger entries
-	if err := s.createLedgerEntriesInTx(tx, &rewardEvent, pricePerShare); err != nil {
+	if err := s.createLedgerEntriesInTx(tx, &rewardEvent, quote); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create ledger entries: %w", err)
+	}
+
+	// Notify portfolio streams once the reward commits
+	if err := notifyHoldingsChanged(tx, userID, "reward"); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to create ledger entries: %w", err)
+		return nil, fmt.Errorf("failed to publish holdings event: %w", err)
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// A failed submission leaves the order NEW for the sync job to retry
+	if order != nil {
+		if err := s.brokerService.SubmitOrder(order); err != nil {
+			logrus.WithError(err).WithField("orderId", order.ID).Warn("Failed to submit broker order")
+		}
 	}
 
 	logrus.WithFields(logrus.Fields{
@@ -111,53 +197,20 @@ func (s *RewardService) CreateReward(userID int, symbol string, quantity decimal
 		"quantity": quantity,
 	}).Info("Reward created successfully")
 
-	return nil
+	return &rewardEvent, nil
 }
 
 // createLedgerEntriesInTx creates ledger entries within a transaction
-func (s *RewardService) createLedgerEntriesInTx(tx *gorm.DB, rewardEvent *models.RewardEvent, pricePerShare decimal.Decimal) error {
-	quantity := rewardEvent.Quantity
-	symbol := rewardEvent.StockSymbol
-	timestamp := rewardEvent.Timestamp
-
-	totalValue := utils.RoundINR(pricePerShare.Mul(quantity))
-	_, _, _, totalFees := utils.CalculateFees(pricePerShare, quantity)
-
-	entries := []models.LedgerEntry{
-		{
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeStock,
-			StockSymbol:   &symbol,
-			Quantity:      quantity,
-			AmountINR:     totalValue,
-			Timestamp:     timestamp,
-		},
-		{
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeCash,
-			StockSymbol:   &symbol,
-			Quantity:      decimal.Zero,
-			AmountINR:     totalValue.Neg(),
-			Timestamp:     timestamp,
-		},
-		{
-			RewardEventID: rewardEvent.ID,
-			EntryType:     models.EntryTypeFee,
-			StockSymbol:   &symbol,
-			Quantity:      decimal.Zero,
-			AmountINR:     totalFees.Neg(),
-			Timestamp:     timestamp,
-		},
-	}
-
+func (s *RewardService) createLedgerEntriesInTx(tx *gorm.DB, rewardEvent *models.RewardEvent, quote Quote) error {
+	entries := rewardLedgerEntries(rewardEvent, quote)
 	return tx.Create(&entries).Error
 }
 
-// GetTodayRewards retrieves all reward events for a user for today
-func (s *RewardService) GetTodayRewards(userID int) ([]models.RewardEvent, error) {
+// GetTodayRewards retrieves all reward events for a user for today in loc
+func (s *RewardService) GetTodayRewards(userID int, loc *time.Location) ([]models.RewardEvent, error) {
 	now := utils.NowUTC()
-	startOfDay := utils.StartOfDayUTC(now)
-	endOfDay := utils.EndOfDayUTC(now)
+	startOfDay := utils.StartOfDayIn(now, loc).UTC()
+	endOfDay := utils.EndOfDayIn(now, loc).UTC()
 
 	var rewards []models.RewardEvent
 	err := db.DB.Where("user_id = ? AND timestamp >= ? AND timestamp <= ?",
@@ -172,10 +225,28 @@ func (s *RewardService) GetTodayRewards(userID int) ([]models.RewardEvent, error
 	return rewards, nil
 }
 
-// GetHistoricalINR calculates INR valuation per past day (up to yesterday)
-func (s *RewardService) GetHistoricalINR(userID int) ([]map[string]interface{}, error) {
-	yesterday := utils.GetYesterday()
-	
+// GetHistoricalINR calculates INR valuation at each day, week or month close
+// in the requested window (up to yesterday), optionally followed by today's
+// intraday value. Days are drawn in opts.Location.
+func (s *RewardService) GetHistoricalINR(userID int, opts HistoricalOptions) ([]map[string]interface{}, error) {
+	granularity := opts.Granularity
+	if granularity == "" {
+		granularity = GranularityDay
+	}
+	if granularity != GranularityDay && granularity != GranularityWeek && granularity != GranularityMonth {
+		return nil, fmt.Errorf("%w: granularity must be day, week or month", ErrInvalidHistoricalQuery)
+	}
+	if opts.From != nil && opts.To != nil && opts.From.After(*opts.To) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidHistoricalQuery)
+	}
+
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	today := utils.StartOfDayIn(utils.NowUTC(), loc)
+	yesterday := today.AddDate(0, 0, -1)
+
 	// Get the earliest reward date for this user
 	var firstReward models.RewardEvent
 	err := db.DB.Where("user_id = ?", userID).
@@ -189,49 +260,101 @@ func (s *RewardService) GetHistoricalINR(userID int) ([]map[string]interface{},
 		return nil, fmt.Errorf("failed to fetch first reward: %w", err)
 	}
 
-	startDate := utils.StartOfDayUTC(firstReward.Timestamp)
-	
-	// Generate list of dates from first reward to yesterday
-	dates := utils.GetPastDates(startDate, yesterday)
+	// Nothing is held before the first reward, so the window never starts earlier
+	startDate := utils.StartOfDayIn(firstReward.Timestamp, loc)
+	if from := calendarDate(opts.From, loc); from != nil && from.After(startDate) {
+		startDate = *from
+	}
+	endDate := yesterday
+	to := calendarDate(opts.To, loc)
+	if to != nil && to.Before(endDate) {
+		endDate = *to
+	}
+
+	// Value every period close in one set-based query
+	points, positions, err := s.loadHistoricalPositions(userID, startDate, endDate, granularity)
+	if err != nil {
+		return nil, err
+	}
 
-	var result []map[string]interface{}
+	result := make([]map[string]interface{}, 0, len(points)+1)
 
-	for _, date := range dates {
-		endOfDate := utils.EndOfDayUTC(date)
-		
-		// Get holdings up to this date
-		holdings, err := s.ledgerService.GetUserStockHoldingsUpToDate(userID, endOfDate)
-		if err != nil {
-			logrus.Errorf("Failed to get holdings for date %s: %v", utils.GetDateString(date), err)
-			continue
+	for i, point := range points {
+		totalValue, symbols := summarizePositions(positions[i], point.Date, opts.Breakdown)
+
+		item := map[string]interface{}{
+			"date":       utils.GetDateString(point.Date),
+			"valueINR":   totalValue,
+			"tradingDay": s.calendar.IsTradingDate(point.Date),
+		}
+		if opts.Breakdown {
+			item["symbols"] = symbols
 		}
+		result = append(result, item)
+	}
 
-		// Calculate total INR value for this date
-		totalValue := decimal.Zero
-		
-		for symbol, qty := range holdings {
-			price, err := s.priceService.GetPriceAtTime(symbol, endOfDate)
-			if err != nil {
-				logrus.Warnf("Failed to get price for %s at %s: %v", symbol, utils.GetDateString(date), err)
-				continue
-			}
-			value := price.Mul(qty)
-			totalValue = totalValue.Add(value)
+	if opts.IncludeToday && (to == nil || !to.Before(today)) {
+		current, err := s.currentPositions(userID)
+		if err != nil {
+			return nil, err
 		}
 
-		result = append(result, map[string]interface{}{
-			"date":     utils.GetDateString(date),
-			"valueINR": utils.RoundINR(totalValue),
-		})
+		totalValue, symbols := summarizePositions(current, today, opts.Breakdown)
+		item := map[string]interface{}{
+			"date":       utils.GetDateString(today),
+			"valueINR":   totalValue,
+			"tradingDay": s.calendar.IsTradingDate(today),
+			"intraday":   true,
+		}
+		if opts.Breakdown {
+			item["symbols"] = symbols
+		}
+		result = append(result, item)
 	}
 
 	return result, nil
 }
 
-// GetStats returns today's reward stats and current portfolio value
-func (s *RewardService) GetStats(userID int) (map[string]interface{}, error) {
+// calendarDate returns midnight in loc of the calendar date of t (nil stays nil)
+func calendarDate(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return &date
+}
+
+// currentPositions values a user's holdings at current prices
+func (s *RewardService) currentPositions(userID int) ([]historicalPosition, error) {
+	holdings, err := s.ledgerService.GetUserStockHoldings(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holdings: %w", err)
+	}
+
+	symbols := holdingSymbols(holdings)
+	sort.Strings(symbols)
+
+	quotes, err := s.priceService.GetCurrentQuotes(symbols)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices: %w", err)
+	}
+
+	positions := make([]historicalPosition, 0, len(symbols))
+	for _, symbol := range symbols {
+		quote, ok := quotes[symbol]
+		if !ok {
+			logrus.Warnf("No current price for %s, excluding from value", symbol)
+			continue
+		}
+		positions = append(positions, quotePosition(symbol, holdings[symbol], quote))
+	}
+	return positions, nil
+}
+
+// GetStats returns today's (in loc) reward stats and current portfolio value
+func (s *RewardService) GetStats(userID int, loc *time.Location) (map[string]interface{}, error) {
 	// Get today's rewards grouped by stock
-	todayRewards, err := s.GetTodayRewards(userID)
+	todayRewards, err := s.GetTodayRewards(userID, loc)
 	if err != nil {
 		return nil, err
 	}
@@ -253,12 +376,17 @@ func (s *RewardService) GetStats(userID int) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to get holdings: %w", err)
 	}
 
+	prices, err := s.priceService.GetCurrentPrices(holdingSymbols(holdings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices: %w", err)
+	}
+
 	// Calculate current portfolio value
 	totalValue := decimal.Zero
 	for symbol, qty := range holdings {
-		price, err := s.priceService.GetCurrentPrice(symbol)
-		if err != nil {
-			logrus.Warnf("Failed to get current price for %s: %v", symbol, err)
+		price, ok := prices[symbol]
+		if !ok {
+			logrus.Warnf("No current price for %s, excluding from value", symbol)
 			continue
 		}
 		value := price.Mul(qty)
@@ -267,42 +395,126 @@ func (s *RewardService) GetStats(userID int) (map[string]interface{}, error) {
 
 	return map[string]interface{}{
 		"userId":            userID,
+		"timezone":          loc.String(),
 		"todayRewards":      todayRewardsByStock,
 		"portfolioValueINR": utils.RoundINR(totalValue),
 	}, nil
 }
 
-// GetPortfolio returns full holdings with current INR value
+// GetPortfolio returns full holdings with current INR value, cost basis and returns
 func (s *RewardService) GetPortfolio(userID int) (map[string]interface{}, error) {
 	holdings, err := s.ledgerService.GetUserStockHoldings(userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get holdings: %w", err)
 	}
 
+	unsettled, err := s.ledgerService.GetUserUnsettledHoldings(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unsettled holdings: %w", err)
+	}
+
+	lots, err := s.ledgerService.GetUserLots(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lots: %w", err)
+	}
+	lotsBySymbol := make(map[string][]Lot)
+	for _, lot := range lots {
+		lotsBySymbol[lot.StockSymbol] = append(lotsBySymbol[lot.StockSymbol], lot)
+	}
+
+	quotes, err := s.priceService.GetCurrentQuotes(holdingSymbols(holdings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prices: %w", err)
+	}
+
+	now := utils.NowUTC()
 	var portfolioItems []map[string]interface{}
 	totalValue := decimal.Zero
+	totalInvested := decimal.Zero
+	var portfolioFlows []utils.CashFlow
 
 	for symbol, qty := range holdings {
-		price, err := s.priceService.GetCurrentPrice(symbol)
-		if err != nil {
-			logrus.Warnf("Failed to get current price for %s: %v", symbol, err)
+		quote, ok := quotes[symbol]
+		if !ok {
+			logrus.Warnf("No current price for %s, excluding from portfolio", symbol)
 			continue
 		}
 
-		value := price.Mul(qty)
+		value := quote.PriceINR.Mul(qty)
 		totalValue = totalValue.Add(value)
 
+		invested := decimal.Zero
+		var flows []utils.CashFlow
+		for _, lot := range lotsBySymbol[symbol] {
+			invested = invested.Add(lot.CostINR)
+			flows = append(flows, utils.CashFlow{Amount: lot.CostINR.Neg(), Date: lot.AcquiredAt})
+		}
+		totalInvested = totalInvested.Add(invested)
+		portfolioFlows = append(portfolioFlows, flows...)
+		flows = append(flows, utils.CashFlow{Amount: value, Date: now})
+
+		unsettledQty := decimal.Min(unsettled[symbol], qty)
 		portfolioItems = append(portfolioItems, map[string]interface{}{
-			"symbol":        symbol,
-			"quantity":      qty,
-			"currentPrice":  utils.RoundINR(price),
-			"currentValue":  utils.RoundINR(value),
+			"symbol":            symbol,
+			"quantity":          qty,
+			"settledQuantity":   qty.Sub(unsettledQty),
+			"unsettledQuantity": unsettledQty,
+			"currency":          quote.Currency,
+			"nativePrice":       quote.Price,
+			"fxRate":            quote.FxRate,
+			"currentPrice":      utils.RoundINR(quote.PriceINR),
+			"currentValue":      utils.RoundINR(value),
+			"investedValue":     utils.RoundINR(invested),
+			"unrealizedPnL":     utils.RoundINR(value.Sub(invested)),
+			"returnPct":         returnPct(value, invested),
+			"xirrPct":           xirrPct(flows),
 		})
 	}
 
+	portfolioFlows = append(portfolioFlows, utils.CashFlow{Amount: totalValue, Date: now})
+
+	cashBalance, err := s.ledgerService.GetUserCashBalance(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
-		"userId":      userID,
-		"holdings":    portfolioItems,
-		"totalValue":  utils.RoundINR(totalValue),
+		"userId":         userID,
+		"holdings":       portfolioItems,
+		"cashBalanceInr": utils.RoundINR(cashBalance),
+		"totalValue":     utils.RoundINR(totalValue),
+		"totalInvested":  utils.RoundINR(totalInvested),
+		"unrealizedPnL":  utils.RoundINR(totalValue.Sub(totalInvested)),
+		"returnPct":      returnPct(totalValue, totalInvested),
+		"xirrPct":        xirrPct(portfolioFlows),
 	}, nil
 }
+
+// returnPct is the simple return of value over invested, in percent (nil if nothing was invested)
+func returnPct(value, invested decimal.Decimal) *decimal.Decimal {
+	if !invested.IsPositive() {
+		return nil
+	}
+	pct := value.Sub(invested).Div(invested).Mul(decimal.NewFromInt(100)).Round(2)
+	return &pct
+}
+
+// xirrPct is the annualised money-weighted return in percent (nil when undefined,
+// e.g. every lot was acquired today)
+func xirrPct(flows []utils.CashFlow) *decimal.Decimal {
+	rate, err := utils.XIRR(flows)
+	if err != nil {
+		return nil
+	}
+	pct := decimal.NewFromFloat(rate * 100).Round(2)
+	return &pct
+}
+
+// holdingSymbols returns the symbols of a holdings map
+func holdingSymbols(holdings map[string]decimal.Decimal) []string {
+	symbols := make([]string, 0, len(holdings))
+	for symbol := range holdings {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
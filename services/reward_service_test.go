@@ -0,0 +1,51 @@
+package services
+
+import (
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReturnPct(t *testing.T) {
+	tests := []struct {
+		value, invested string
+		want            string
+	}{
+		{"1100", "1000", "10"},
+		{"900", "1000", "-10"},
+		{"1000.5", "3000", "-66.65"},
+		{"100", "0", ""},
+		{"100", "-5", ""},
+	}
+
+	for _, tt := range tests {
+		got := returnPct(decimal.RequireFromString(tt.value), decimal.RequireFromString(tt.invested))
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("returnPct(%s, %s) = %s, want nil", tt.value, tt.invested, got)
+		case tt.want != "" && (got == nil || !got.Equal(decimal.RequireFromString(tt.want))):
+			t.Errorf("returnPct(%s, %s) = %v, want %s", tt.value, tt.invested, got, tt.want)
+		}
+	}
+}
+
+func TestXIRRPct(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := xirrPct([]utils.CashFlow{
+		{Amount: decimal.NewFromInt(-1000), Date: start},
+		{Amount: decimal.NewFromInt(1100), Date: start.AddDate(0, 0, 365)},
+	})
+	if want := decimal.NewFromInt(10); got == nil || !got.Equal(want) {
+		t.Errorf("xirrPct = %v, want %s", got, want)
+	}
+
+	// Lots acquired today have no meaningful annual return
+	if got := xirrPct([]utils.CashFlow{
+		{Amount: decimal.NewFromInt(-1000), Date: start},
+		{Amount: decimal.NewFromInt(1100), Date: start.Add(time.Hour)},
+	}); got != nil {
+		t.Errorf("xirrPct over an hour = %s, want nil", got)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrInsufficientHoldings is returned when a user disposes of more shares than they hold
+var ErrInsufficientHoldings = errors.New("insufficient holdings")
+
+// ErrSaleBelowFees is returned when a sale's proceeds would not cover its fees
+var ErrSaleBelowFees = errors.New("sale proceeds do not cover fees")
+
+// SaleService sells users' reward shares for INR
+type SaleService struct {
+	priceService  *PriceService
+	ledgerService *LedgerService
+}
+
+// NewSaleService creates a new sale service
+func NewSaleService(priceService *PriceService, ledgerService *LedgerService) *SaleService {
+	return &SaleService{
+		priceService:  priceService,
+		ledgerService: ledgerService,
+	}
+}
+
+// Sell sells a quantity of a user's shares at the current price. The STOCK
+// debit, CASH proceeds and FEE entries are booked to the user's account in
+// one transaction; net proceeds become part of the user's INR balance.
+func (s *SaleService) Sell(userID int, symbol string, quantity decimal.Decimal) (*models.Sale, error) {
+	if err := utils.ValidateStockSymbol(symbol); err != nil {
+		return nil, fmt.Errorf("invalid stock symbol: %w", err)
+	}
+	if err := utils.ValidateQuantity(quantity); err != nil {
+		return nil, fmt.Errorf("invalid quantity: %w", err)
+	}
+	quantity = quantity.Round(6)
+
+	quote, err := s.priceService.GetCurrentQuote(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock price: %w", err)
+	}
+
+	gross, fees, net, err := saleAmounts(quote.PriceINR, quantity)
+	if err != nil {
+		return nil, err
+	}
+	sale := models.Sale{
+		UserID:      userID,
+		StockSymbol: symbol,
+		Quantity:    quantity,
+		Price:       quote.Price,
+		Currency:    quote.Currency,
+		FxRate:      quote.FxRate,
+		PriceINR:    quote.PriceINR,
+		GrossINR:    gross,
+		FeesINR:     fees,
+		NetINR:      net,
+		Timestamp:   utils.NowUTC(),
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserHoldings(tx, userID); err != nil {
+			return err
+		}
+
+		// Shares reserved by in-flight transfers cannot be sold
+		available, err := availableHoldingInTx(tx, userID, symbol)
+		if err != nil {
+			return err
+		}
+		if available.LessThan(quantity) {
+			return fmt.Errorf("%w: %s available %s, selling %s", ErrInsufficientHoldings, symbol, available.String(), quantity.String())
+		}
+
+		if err := tx.Create(&sale).Error; err != nil {
+			return fmt.Errorf("failed to create sale: %w", err)
+		}
+
+		entries := saleLedgerEntries(&sale)
+		if err := tx.Create(&entries).Error; err != nil {
+			return fmt.Errorf("failed to create ledger entries: %w", err)
+		}
+
+		return notifyHoldingsChanged(tx, userID, "sale")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"saleId":   sale.ID,
+		"userId":   userID,
+		"symbol":   symbol,
+		"quantity": quantity,
+		"netInr":   sale.NetINR,
+	}).Info("Sale completed successfully")
+
+	return &sale, nil
+}
+
+// saleAmounts returns the gross proceeds, fees and net proceeds in INR of
+// selling quantity shares at priceINR. A sale whose fees would take all of
+// its proceeds is rejected rather than booked at a loss to the user.
+func saleAmounts(priceINR, quantity decimal.Decimal) (gross, fees, net decimal.Decimal, err error) {
+	gross = utils.RoundINR(priceINR.Mul(quantity))
+	_, _, _, fees = utils.CalculateFees(priceINR, quantity)
+	net = gross.Sub(fees)
+	if !net.IsPositive() {
+		return gross, fees, net, fmt.Errorf("%w: gross %s, fees %s", ErrSaleBelowFees, gross.String(), fees.String())
+	}
+	return gross, fees, net, nil
+}
+
+// saleLedgerEntries builds the user's STOCK debit, INR CASH credit and FEE
+// debit for a sale. The STOCK entry records the proceeds in the instrument's
+// currency; cash and fees are in INR.
+func saleLedgerEntries(sale *models.Sale) []models.LedgerEntry {
+	symbol := sale.StockSymbol
+	grossOriginal := utils.RoundINR(sale.Price.Mul(sale.Quantity))
+
+	entry := func(entryType models.EntryType) models.LedgerEntry {
+		return models.LedgerEntry{
+			UserID:        sale.UserID,
+			ReferenceType: models.ReferenceSale,
+			ReferenceID:   sale.ID,
+			Account:       models.AccountUser,
+			EntryType:     entryType,
+			StockSymbol:   &symbol,
+			Quantity:      decimal.Zero,
+			Currency:      models.BaseCurrency,
+			FxRate:        decimal.NewFromInt(1),
+			Timestamp:     sale.Timestamp,
+		}
+	}
+
+	// STOCK entry: -X shares debited from user
+	stock := entry(models.EntryTypeStock)
+	stock.Quantity = sale.Quantity.Neg()
+	stock.AmountINR = sale.GrossINR.Neg()
+	stock.Currency = sale.Currency
+	stock.AmountOriginal = grossOriginal.Neg()
+	stock.FxRate = sale.FxRate
+
+	// CASH entry: gross proceeds credited to user
+	cash := entry(models.EntryTypeCash)
+	cash.AmountINR = sale.GrossINR
+	cash.AmountOriginal = sale.GrossINR
+
+	// FEE entry: charges deducted from proceeds
+	fee := entry(models.EntryTypeFee)
+	fee.AmountINR = sale.FeesINR.Neg()
+	fee.AmountOriginal = sale.FeesINR.Neg()
+
+	return []models.LedgerEntry{stock, cash, fee}
+}
+
+// ListSales returns a user's sales, newest first
+func (s *SaleService) ListSales(userID int) ([]models.Sale, error) {
+	var sales []models.Sale
+	if err := db.DB.Where("user_id = ?", userID).Order("timestamp DESC").Find(&sales).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch sales: %w", err)
+	}
+	return sales, nil
+}
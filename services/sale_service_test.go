@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSaleAmounts(t *testing.T) {
+	gross, fees, net, err := saleAmounts(decimal.RequireFromString("2500"), decimal.RequireFromString("2"))
+	if err != nil {
+		t.Fatalf("saleAmounts: %v", err)
+	}
+	// Brokerage 1.5, STT 5, GST 0.27
+	if want := decimal.RequireFromString("5000"); !gross.Equal(want) {
+		t.Errorf("gross = %s, want %s", gross, want)
+	}
+	if want := decimal.RequireFromString("6.77"); !fees.Equal(want) {
+		t.Errorf("fees = %s, want %s", fees, want)
+	}
+	if want := decimal.RequireFromString("4993.23"); !net.Equal(want) {
+		t.Errorf("net = %s, want %s", net, want)
+	}
+
+	// Proceeds round to nothing, so fees would take the whole sale
+	_, _, _, err = saleAmounts(decimal.RequireFromString("0.01"), decimal.RequireFromString("0.000001"))
+	if !errors.Is(err, ErrSaleBelowFees) {
+		t.Errorf("err = %v, want ErrSaleBelowFees", err)
+	}
+}
+
+func TestSaleLedgerEntries(t *testing.T) {
+	sale := &models.Sale{
+		ID:          5,
+		UserID:      fixtureUserID,
+		StockSymbol: "AAPL",
+		Quantity:    decimal.RequireFromString("1.5"),
+		Price:       decimal.RequireFromString("200"),
+		Currency:    "USD",
+		FxRate:      decimal.RequireFromString("83"),
+		GrossINR:    decimal.RequireFromString("24900"),
+		FeesINR:     decimal.RequireFromString("45.28"),
+		NetINR:      decimal.RequireFromString("24854.72"),
+		Timestamp:   utils.NowUTC(),
+	}
+
+	entries := saleLedgerEntries(sale)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	stock, cash, fee := entries[0], entries[1], entries[2]
+	if stock.EntryType != models.EntryTypeStock || !stock.Quantity.Equal(sale.Quantity.Neg()) {
+		t.Errorf("stock entry = %s %s, want STOCK -%s", stock.EntryType, stock.Quantity, sale.Quantity)
+	}
+	if stock.Currency != "USD" || !stock.AmountOriginal.Equal(decimal.RequireFromString("-300")) {
+		t.Errorf("stock entry original = %s %s, want USD -300", stock.Currency, stock.AmountOriginal)
+	}
+	if !cash.AmountINR.Add(fee.AmountINR).Equal(sale.NetINR) {
+		t.Errorf("cash %s + fee %s != net %s", cash.AmountINR, fee.AmountINR, sale.NetINR)
+	}
+	for _, entry := range entries {
+		if entry.ReferenceType != models.ReferenceSale || entry.ReferenceID != sale.ID || entry.UserID != sale.UserID {
+			t.Errorf("%s entry references %s/%d for user %d", entry.EntryType, entry.ReferenceType, entry.ReferenceID, entry.UserID)
+		}
+	}
+}
+
+func TestConsumeLots(t *testing.T) {
+	lots := func() []Lot {
+		return []Lot{
+			{RewardEventID: 1, StockSymbol: "TCS", Quantity: decimal.NewFromInt(2), CostINR: decimal.NewFromInt(200)},
+			{RewardEventID: 2, StockSymbol: "INFY", Quantity: decimal.NewFromInt(1), CostINR: decimal.NewFromInt(50)},
+			{RewardEventID: 3, StockSymbol: "TCS", Quantity: decimal.NewFromInt(3), CostINR: decimal.NewFromInt(330)},
+		}
+	}
+
+	type lotWant struct {
+		rewardEventID uint
+		quantity      string
+		cost          string
+	}
+	tests := []struct {
+		name     string
+		disposed map[string]decimal.Decimal
+		want     []lotWant
+	}{
+		{
+			"nothing disposed",
+			map[string]decimal.Decimal{},
+			[]lotWant{{1, "2", "200"}, {2, "1", "50"}, {3, "3", "330"}},
+		},
+		{
+			"part of the oldest lot",
+			map[string]decimal.Decimal{"TCS": decimal.NewFromInt(1)},
+			[]lotWant{{1, "1", "100"}, {2, "1", "50"}, {3, "3", "330"}},
+		},
+		{
+			"oldest lot exactly",
+			map[string]decimal.Decimal{"TCS": decimal.NewFromInt(2)},
+			[]lotWant{{2, "1", "50"}, {3, "3", "330"}},
+		},
+		{
+			"spills into the next lot",
+			map[string]decimal.Decimal{"TCS": decimal.RequireFromString("2.5")},
+			[]lotWant{{2, "1", "50"}, {3, "2.5", "275"}},
+		},
+		{
+			"other symbols untouched",
+			map[string]decimal.Decimal{"INFY": decimal.NewFromInt(1)},
+			[]lotWant{{1, "2", "200"}, {3, "3", "330"}},
+		},
+		{
+			"rounded pro rata cost",
+			map[string]decimal.Decimal{"TCS": decimal.RequireFromString("2.000001")},
+			[]lotWant{{2, "1", "50"}, {3, "2.999999", "329.9999"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := consumeLots(lots(), tt.disposed)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lots, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				lot := got[i]
+				if lot.RewardEventID != want.rewardEventID ||
+					!lot.Quantity.Equal(decimal.RequireFromString(want.quantity)) ||
+					!lot.CostINR.Equal(decimal.RequireFromString(want.cost)) {
+					t.Errorf("lot %d = reward %d %s @ %s, want reward %d %s @ %s", i,
+						lot.RewardEventID, lot.Quantity, lot.CostINR, want.rewardEventID, want.quantity, want.cost)
+				}
+			}
+		})
+	}
+}
+
+func TestSell(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	symbol := "WIPRO"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(500),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(500),
+		Timestamp:   now,
+	})
+	mustCreate(t, &models.LedgerEntry{
+		UserID:        fixtureUserID,
+		ReferenceType: models.ReferenceSale,
+		Account:       models.AccountUser,
+		EntryType:     models.EntryTypeStock,
+		StockSymbol:   &symbol,
+		Quantity:      decimal.NewFromInt(2),
+		AmountINR:     decimal.NewFromInt(1000),
+		Timestamp:     now,
+	})
+
+	ledger := NewLedgerService()
+	service := NewSaleService(NewPriceService(NewMarketCalendar()), ledger)
+
+	sale, err := service.Sell(fixtureUserID, symbol, decimal.RequireFromString("1.5"))
+	if err != nil {
+		t.Fatalf("Sell: %v", err)
+	}
+	if want := decimal.NewFromInt(750); !sale.GrossINR.Equal(want) {
+		t.Errorf("gross = %s, want %s", sale.GrossINR, want)
+	}
+	if !sale.NetINR.Equal(sale.GrossINR.Sub(sale.FeesINR)) {
+		t.Errorf("net = %s, want gross %s less fees %s", sale.NetINR, sale.GrossINR, sale.FeesINR)
+	}
+
+	balance, err := ledger.GetUserCashBalance(fixtureUserID)
+	if err != nil {
+		t.Fatalf("GetUserCashBalance: %v", err)
+	}
+	if !balance.Equal(sale.NetINR) {
+		t.Errorf("cash balance = %s, want %s", balance, sale.NetINR)
+	}
+
+	if _, err := service.Sell(fixtureUserID, symbol, decimal.NewFromInt(1)); !errors.Is(err, ErrInsufficientHoldings) {
+		t.Errorf("overselling err = %v, want ErrInsufficientHoldings", err)
+	}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// defaultSchedulerPollInterval is how often instances compete for job leadership
+const defaultSchedulerPollInterval = 15 * time.Second
+
+// Job is a recurring background task run by exactly one instance at a time
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// ShouldRun optionally skips ticks, e.g. outside trading sessions
+	ShouldRun func(now time.Time) bool
+	// Schedule optionally pins runs to clock times: it returns the latest
+	// scheduled time at or before now, and the job runs once per scheduled
+	// time instead of every Interval
+	Schedule func(now time.Time) time.Time
+	Run      func() error
+}
+
+// Scheduler runs jobs under Postgres advisory-lock leader election.
+//
+// Every instance polls each job. The instance holding the job's session-level
+// advisory lock is its leader and runs it once the last recorded run (shared
+// through scheduler_job_runs) is at least one interval old. If the leader dies
+// its session ends, Postgres releases the lock, and another instance takes over
+// on its next poll without resetting the job's cadence.
+type Scheduler struct {
+	instanceID   string
+	pollInterval time.Duration
+
+	jobs   []Job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler polling every SCHEDULER_POLL_INTERVAL (default 15s)
+func NewScheduler() *Scheduler {
+	hostname, _ := os.Hostname()
+
+	return &Scheduler{
+		instanceID:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		pollInterval: utils.DurationFromEnv("SCHEDULER_POLL_INTERVAL", defaultSchedulerPollInterval),
+	}
+}
+
+// Register adds a job; it must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches one polling loop per registered job
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		logrus.WithFields(logrus.Fields{
+			"job":      job.Name,
+			"interval": job.Interval.String(),
+			"instance": s.instanceID,
+		}).Info("Scheduling background job")
+
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Stop ends all loops and releases any leadership held by this instance
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// loop polls a single job until the context is cancelled
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	lock := &leaderLock{key: advisoryLockKey(jobLockNamespace, job.Name)}
+	defer lock.release()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx, job, lock)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick runs the job if this instance is leader and the job is due
+func (s *Scheduler) tick(ctx context.Context, job Job, lock *leaderLock) {
+	leader, err := lock.acquire(ctx)
+	if err != nil {
+		logrus.WithError(err).WithField("job", job.Name).Warn("Leader election failed")
+		return
+	}
+	if !leader {
+		return
+	}
+
+	now := utils.NowUTC()
+	if job.ShouldRun != nil && !job.ShouldRun(now) {
+		return
+	}
+
+	due, err := s.isDue(job, now)
+	if err != nil {
+		logrus.WithError(err).WithField("job", job.Name).Warn("Failed to read job state")
+		return
+	}
+	if !due {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"job":      job.Name,
+		"instance": s.instanceID,
+	}).Info("Running scheduled job")
+
+	started := time.Now()
+	runErr := job.Run()
+	if runErr != nil {
+		logrus.WithError(runErr).WithField("job", job.Name).Error("Scheduled job failed")
+	}
+
+	if err := s.recordRun(job, now, time.Since(started), runErr); err != nil {
+		logrus.WithError(err).WithField("job", job.Name).Warn("Failed to record job run")
+	}
+}
+
+// isDue reports whether the job is due given its last recorded run
+func (s *Scheduler) isDue(job Job, now time.Time) (bool, error) {
+	var run models.SchedulerJobRun
+	result := db.DB.Where("job_name = ?", job.Name).Limit(1).Find(&run)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return jobDue(job, run.LastRunAt, now), nil
+}
+
+// jobDue reports whether a job last run at lastRun (nil if never) is due at
+// now: a scheduled job once its latest scheduled time has passed since the
+// last run, otherwise once at least one interval has passed
+func jobDue(job Job, lastRun *time.Time, now time.Time) bool {
+	if lastRun == nil {
+		return true
+	}
+	if job.Schedule != nil {
+		return lastRun.Before(job.Schedule(now))
+	}
+	return !now.Before(lastRun.Add(job.Interval))
+}
+
+// recordRun stores the outcome of a run so a new leader keeps the cadence
+func (s *Scheduler) recordRun(job Job, startedAt time.Time, duration time.Duration, runErr error) error {
+	run := models.SchedulerJobRun{
+		JobName:      job.Name,
+		LastRunAt:    &startedAt,
+		LastInstance: s.instanceID,
+		LastDuration: duration.Milliseconds(),
+	}
+	if runErr != nil {
+		run.LastError = runErr.Error()
+	}
+
+	return db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_run_at", "last_instance", "last_error", "last_duration", "updated_at"}),
+	}).Create(&run).Error
+}
+
+// leaderLock holds a session-level advisory lock on a dedicated connection
+type leaderLock struct {
+	key  int64
+	conn *sql.Conn
+}
+
+// acquire returns true while this instance holds the lock, trying to take it if not
+func (l *leaderLock) acquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		// The lock lives as long as the session; a dead session means it is gone
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		logrus.WithField("lockKey", l.key).Warn("Lost scheduler leadership connection")
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+
+	logrus.WithField("lockKey", l.key).Info("Acquired scheduler leadership")
+	l.conn = conn
+	return true, nil
+}
+
+// release gives up the lock so another instance can take over immediately
+func (l *leaderLock) release() {
+	if l.conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		logrus.WithError(err).WithField("lockKey", l.key).Warn("Failed to release scheduler leadership")
+	}
+	l.conn.Close()
+	l.conn = nil
+}
+
+// Advisory lock namespaces keep job leadership locks and data locks from
+// hashing to the same key
+const (
+	jobLockNamespace  = "job"
+	dataLockNamespace = "data"
+)
+
+// advisoryLockKey derives a stable lock key from a namespace and a name
+func advisoryLockKey(namespace, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("stocky-backend:" + namespace + ":" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"stocky-backend/utils"
+	"testing"
+	"time"
+)
+
+func TestJobDue(t *testing.T) {
+	calendar := NewMarketCalendar()
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, utils.ISTLocation())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	interval := Job{Name: "interval", Interval: time.Hour}
+	scheduled := Job{Name: "close", Interval: 24 * time.Hour, Schedule: calendar.LastSessionClose}
+	settlement := Job{Name: "settlement", Interval: 24 * time.Hour, Schedule: calendar.LastSessionOpen}
+
+	// 2024-05-03 is a Friday
+	tests := []struct {
+		name    string
+		job     Job
+		lastRun string
+		now     string
+		want    bool
+	}{
+		{"interval, never run", interval, "", "2024-05-03 10:00", true},
+		{"interval, within", interval, "2024-05-03 10:00", "2024-05-03 10:59", false},
+		{"interval, elapsed", interval, "2024-05-03 10:00", "2024-05-03 11:00", true},
+		{"scheduled, never run", scheduled, "", "2024-05-03 15:31", true},
+		{"scheduled, before the close", scheduled, "2024-05-02 15:31", "2024-05-03 15:29", false},
+		{"scheduled, at the close", scheduled, "2024-05-02 15:31", "2024-05-03 15:30", true},
+		{"scheduled, already run", scheduled, "2024-05-03 15:31", "2024-05-03 16:00", false},
+		{"scheduled, weekend", scheduled, "2024-05-03 15:31", "2024-05-05 15:30", false},
+		{"scheduled, next session", scheduled, "2024-05-03 15:31", "2024-05-06 15:30", true},
+		{"open, before the open", settlement, "2024-05-02 09:15", "2024-05-03 09:14", false},
+		{"open, at the open", settlement, "2024-05-02 09:15", "2024-05-03 09:15", true},
+		{"open, already run", settlement, "2024-05-03 09:15", "2024-05-03 15:00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lastRun *time.Time
+			if tt.lastRun != "" {
+				lastRun = timePtr(at(tt.lastRun))
+			}
+			if got := jobDue(tt.job, lastRun, at(tt.now)); got != tt.want {
+				t.Errorf("jobDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvisoryLockKey(t *testing.T) {
+	if advisoryLockKey(jobLockNamespace, "price-update") != advisoryLockKey(jobLockNamespace, "price-update") {
+		t.Error("lock key is not stable")
+	}
+	if advisoryLockKey(jobLockNamespace, "user-holdings:1") == advisoryLockKey(dataLockNamespace, "user-holdings:1") {
+		t.Error("job and data locks share a key")
+	}
+}
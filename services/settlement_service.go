@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SettlementService settles rewarded shares on their settlement date
+type SettlementService struct {
+	calendar *MarketCalendar
+}
+
+// NewSettlementService creates a new settlement service
+func NewSettlementService(calendar *MarketCalendar) *SettlementService {
+	return &SettlementService{
+		calendar: calendar,
+	}
+}
+
+// SettleDue marks rewards and their STOCK entries settled once their
+// settlement date has arrived on the exchange calendar
+func (s *SettlementService) SettleDue() error {
+	today := utils.GetDateString(utils.NowUTC().In(s.calendar.Location()))
+
+	var rewards, entries int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var userIDs []int
+		err := tx.Model(&models.LedgerEntry{}).
+			Distinct("user_id").
+			Where("settlement_status = ? AND settlement_date <> '' AND settlement_date <= ?", models.SettlementUnsettled, today).
+			Pluck("user_id", &userIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch users to settle: %w", err)
+		}
+
+		result := tx.Model(&models.RewardEvent{}).
+			Where("settlement_status = ? AND settlement_date <> '' AND settlement_date <= ?", models.SettlementUnsettled, today).
+			Update("settlement_status", models.SettlementSettled)
+		if result.Error != nil {
+			return fmt.Errorf("failed to settle rewards: %w", result.Error)
+		}
+		rewards = result.RowsAffected
+
+		result = tx.Model(&models.LedgerEntry{}).
+			Where("settlement_status = ? AND settlement_date <> '' AND settlement_date <= ?", models.SettlementUnsettled, today).
+			Update("settlement_status", models.SettlementSettled)
+		if result.Error != nil {
+			return fmt.Errorf("failed to settle ledger entries: %w", result.Error)
+		}
+		entries = result.RowsAffected
+
+		for _, userID := range userIDs {
+			if err := notifyHoldingsChanged(tx, userID, "settlement"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"date":    today,
+		"rewards": rewards,
+		"entries": entries,
+	}).Info("Settlement run completed")
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSettleDue(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	calendar := NewMarketCalendar()
+	now := utils.NowUTC()
+	today := utils.GetDateString(now.In(calendar.Location()))
+	yesterday := utils.GetDateString(now.In(calendar.Location()).AddDate(0, 0, -1))
+	tomorrow := utils.GetDateString(now.In(calendar.Location()).AddDate(0, 0, 1))
+
+	symbol := "TCS"
+	dates := []string{yesterday, today, tomorrow, ""}
+	var rewards []models.RewardEvent
+	var entries []models.LedgerEntry
+	for i, date := range dates {
+		reward := models.RewardEvent{
+			UserID:           fixtureUserID,
+			StockSymbol:      symbol,
+			Quantity:         decimal.NewFromInt(int64(i + 1)),
+			Status:           models.RewardStatusIssued,
+			SettlementStatus: models.SettlementUnsettled,
+			SettlementDate:   date,
+			Timestamp:        now,
+		}
+		mustCreate(t, &reward)
+		rewards = append(rewards, reward)
+
+		entry := models.LedgerEntry{
+			UserID:           fixtureUserID,
+			RewardEventID:    &reward.ID,
+			ReferenceType:    models.ReferenceReward,
+			ReferenceID:      reward.ID,
+			Account:          models.AccountUser,
+			EntryType:        models.EntryTypeStock,
+			StockSymbol:      &symbol,
+			Quantity:         reward.Quantity,
+			AmountINR:        decimal.NewFromInt(1000),
+			SettlementStatus: models.SettlementUnsettled,
+			SettlementDate:   date,
+			Timestamp:        now,
+		}
+		mustCreate(t, &entry)
+		entries = append(entries, entry)
+	}
+
+	if err := NewSettlementService(calendar).SettleDue(); err != nil {
+		t.Fatalf("SettleDue: %v", err)
+	}
+
+	// Due dates settle; future dates and shares awaiting a fill do not
+	want := []models.SettlementStatus{models.SettlementSettled, models.SettlementSettled, models.SettlementUnsettled, models.SettlementUnsettled}
+	for i := range dates {
+		var reward models.RewardEvent
+		if err := db.DB.First(&reward, rewards[i].ID).Error; err != nil {
+			t.Fatalf("failed to reload reward: %v", err)
+		}
+		var entry models.LedgerEntry
+		if err := db.DB.First(&entry, entries[i].ID).Error; err != nil {
+			t.Fatalf("failed to reload entry: %v", err)
+		}
+		if reward.SettlementStatus != want[i] || entry.SettlementStatus != want[i] {
+			t.Errorf("settlement date %q: reward %s, entry %s, want %s", dates[i], reward.SettlementStatus, entry.SettlementStatus, want[i])
+		}
+	}
+}
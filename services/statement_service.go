@@ -0,0 +1,465 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// statementMonthLayout formats statement months
+const statementMonthLayout = "2006-01"
+
+var (
+	// ErrInvalidStatementMonth is returned for a malformed month or one that has not ended
+	ErrInvalidStatementMonth = errors.New("invalid statement month")
+
+	// ErrStatementNotFound is returned when no statement was generated for a user and month
+	ErrStatementNotFound = errors.New("statement not found")
+)
+
+// StatementHolding is a position at the start or end of a statement month
+type StatementHolding struct {
+	Symbol   string          `json:"symbol"`
+	Quantity decimal.Decimal `json:"quantity"`
+	PriceINR decimal.Decimal `json:"priceInr"`
+	ValueINR decimal.Decimal `json:"valueInr"`
+}
+
+// StatementActivity is one share movement during a statement month
+type StatementActivity struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type"`
+	Symbol    string          `json:"symbol"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	AmountINR decimal.Decimal `json:"amountInr"`
+	Reference string          `json:"reference"`
+}
+
+// MonthlyStatement is the content of a user's account statement for one month
+type MonthlyStatement struct {
+	UserID          int                 `json:"userId"`
+	Month           string              `json:"month"`
+	From            string              `json:"from"`
+	To              string              `json:"to"`
+	Timezone        string              `json:"timezone"`
+	OpeningHoldings []StatementHolding  `json:"openingHoldings"`
+	OpeningValueINR decimal.Decimal     `json:"openingValueInr"`
+	Rewards         []StatementActivity `json:"rewards"`
+	Reversals       []StatementActivity `json:"reversals"`
+	Sales           []StatementActivity `json:"sales"`
+	// CorporateActions is always empty: splits and bonuses are not booked to the ledger yet
+	CorporateActions []StatementActivity `json:"corporateActions"`
+	OtherActivity    []StatementActivity `json:"otherActivity"`
+	ClosingHoldings  []StatementHolding  `json:"closingHoldings"`
+	ClosingValueINR  decimal.Decimal     `json:"closingValueInr"`
+	GeneratedAt      time.Time           `json:"generatedAt"`
+}
+
+// isEmpty reports whether the user held nothing and did nothing all month
+func (m *MonthlyStatement) isEmpty() bool {
+	return len(m.OpeningHoldings) == 0 && len(m.ClosingHoldings) == 0 &&
+		len(m.Rewards) == 0 && len(m.Reversals) == 0 && len(m.Sales) == 0 && len(m.OtherActivity) == 0
+}
+
+// StatementRunResult summarises a statement generation run
+type StatementRunResult struct {
+	Month     string `json:"month"`
+	Generated int    `json:"generated"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+}
+
+// StatementService generates and serves monthly account statements.
+// Months are IST calendar months; movements are dated by their ledger entry.
+type StatementService struct {
+	priceService *PriceService
+	calendar     *MarketCalendar
+}
+
+// NewStatementService creates a new statement service
+func NewStatementService(priceService *PriceService, calendar *MarketCalendar) *StatementService {
+	return &StatementService{
+		priceService: priceService,
+		calendar:     calendar,
+	}
+}
+
+// parseStatementMonth returns the bounds of a completed month: its first
+// instant in IST (inclusive) and the next month's (exclusive)
+func parseStatementMonth(month string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(statementMonthLayout, month, utils.ISTLocation())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: %q, use YYYY-MM", ErrInvalidStatementMonth, month)
+	}
+	to := from.AddDate(0, 1, 0)
+	if to.After(utils.NowUTC()) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: %s has not ended", ErrInvalidStatementMonth, month)
+	}
+	return from, to, nil
+}
+
+// PreviousStatementMonth returns the last completed IST month
+func PreviousStatementMonth() string {
+	now := utils.NowUTC().In(utils.ISTLocation())
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).
+		AddDate(0, -1, 0).
+		Format(statementMonthLayout)
+}
+
+// GenerateMonth writes statements for every user with holdings or activity
+// in a month. Existing statements are kept unless overwrite is set.
+func (s *StatementService) GenerateMonth(month string, overwrite bool) (*StatementRunResult, error) {
+	from, to, err := parseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int
+	err = db.DB.Model(&models.LedgerEntry{}).
+		Distinct("user_id").
+		Where("user_id <> 0 AND timestamp < ?", to).
+		Order("user_id").
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statement users: %w", err)
+	}
+
+	existing := make(map[int]bool)
+	if !overwrite {
+		var done []int
+		err := db.DB.Model(&models.AccountStatement{}).Where("month = ?", month).Pluck("user_id", &done).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to list existing statements: %w", err)
+		}
+		for _, userID := range done {
+			existing[userID] = true
+		}
+	}
+
+	result := &StatementRunResult{Month: month}
+	for _, userID := range userIDs {
+		if existing[userID] {
+			result.Skipped++
+			continue
+		}
+
+		generated, err := s.generate(userID, month, from, to)
+		if err != nil {
+			logrus.WithError(err).WithField("userId", userID).Errorf("Failed to generate %s statement", month)
+			result.Failed++
+			continue
+		}
+		if !generated {
+			result.Skipped++
+			continue
+		}
+		result.Generated++
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"month":     month,
+		"generated": result.Generated,
+		"skipped":   result.Skipped,
+		"failed":    result.Failed,
+	}).Info("Monthly statements generated")
+
+	return result, nil
+}
+
+// GeneratePreviousMonth generates last month's statements that are not yet stored
+func (s *StatementService) GeneratePreviousMonth() error {
+	_, err := s.GenerateMonth(PreviousStatementMonth(), false)
+	return err
+}
+
+// generate builds, renders and stores one user's statement. It returns false
+// for a user with nothing to report.
+func (s *StatementService) generate(userID int, month string, from, to time.Time) (bool, error) {
+	statement, err := s.BuildStatement(userID, month, from, to)
+	if err != nil {
+		return false, err
+	}
+	if statement.isEmpty() {
+		return false, nil
+	}
+
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode statement: %w", err)
+	}
+	csvData, err := statement.renderCSV()
+	if err != nil {
+		return false, err
+	}
+	htmlData, err := statement.renderHTML()
+	if err != nil {
+		return false, err
+	}
+
+	record := models.AccountStatement{
+		UserID:          userID,
+		Month:           month,
+		OpeningValueINR: statement.OpeningValueINR,
+		ClosingValueINR: statement.ClosingValueINR,
+		Data:            string(data),
+		CSV:             csvData,
+		HTML:            htmlData,
+		GeneratedAt:     statement.GeneratedAt,
+	}
+	err = db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "month"}},
+		DoUpdates: clause.AssignmentColumns([]string{"opening_value_inr", "closing_value_inr", "data", "csv", "html", "generated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to save statement: %w", err)
+	}
+	return true, nil
+}
+
+// BuildStatement assembles a user's statement for the month [from, to)
+func (s *StatementService) BuildStatement(userID int, month string, from, to time.Time) (*MonthlyStatement, error) {
+	statement := &MonthlyStatement{
+		UserID:           userID,
+		Month:            month,
+		From:             utils.GetDateString(from),
+		To:               utils.GetDateString(to.AddDate(0, 0, -1)),
+		Timezone:         utils.ExchangeTimezone,
+		Rewards:          []StatementActivity{},
+		Reversals:        []StatementActivity{},
+		Sales:            []StatementActivity{},
+		CorporateActions: []StatementActivity{},
+		OtherActivity:    []StatementActivity{},
+		GeneratedAt:      utils.NowUTC(),
+	}
+
+	var err error
+	if statement.OpeningHoldings, statement.OpeningValueINR, err = s.valuedHoldingsBefore(userID, from); err != nil {
+		return nil, err
+	}
+	if statement.ClosingHoldings, statement.ClosingValueINR, err = s.valuedHoldingsBefore(userID, to); err != nil {
+		return nil, err
+	}
+
+	var movements []struct {
+		ReferenceType models.ReferenceType
+		ReferenceID   uint
+		StockSymbol   string
+		Quantity      decimal.Decimal
+		AmountINR     decimal.Decimal
+		Timestamp     time.Time
+	}
+	err = db.DB.Raw(`
+		SELECT le.reference_type, le.reference_id, le.stock_symbol, le.quantity, le.amount_inr, le.timestamp
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		  AND le.timestamp >= ? AND le.timestamp < ?
+		ORDER BY le.timestamp, le.id
+	`, userID, from, to).Scan(&movements).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch statement activity: %w", err)
+	}
+
+	for _, m := range movements {
+		activity := StatementActivity{
+			Timestamp: m.Timestamp,
+			Symbol:    m.StockSymbol,
+			Quantity:  m.Quantity,
+			AmountINR: m.AmountINR,
+			Reference: fmt.Sprintf("%s #%d", m.ReferenceType, m.ReferenceID),
+		}
+		switch {
+		case m.ReferenceType == models.ReferenceReward && m.Quantity.IsPositive():
+			activity.Type = "REWARD"
+			statement.Rewards = append(statement.Rewards, activity)
+		case m.ReferenceType == models.ReferenceReward:
+			activity.Type = "REVERSAL"
+			statement.Reversals = append(statement.Reversals, activity)
+		case m.ReferenceType == models.ReferenceSale:
+			activity.Type = "SALE"
+			statement.Sales = append(statement.Sales, activity)
+		default:
+			activity.Type = string(m.ReferenceType)
+			statement.OtherActivity = append(statement.OtherActivity, activity)
+		}
+	}
+
+	return statement, nil
+}
+
+// valuedHoldingsBefore returns a user's holdings from entries booked before t,
+// valued at the last session close before t, and their total value
+func (s *StatementService) valuedHoldingsBefore(userID int, t time.Time) ([]StatementHolding, decimal.Decimal, error) {
+	var rows []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+	}
+	err := db.DB.Raw(`
+		SELECT le.stock_symbol, SUM(le.quantity) AS quantity
+		FROM ledger_entries le
+		LEFT JOIN reward_events re ON le.reward_event_id = re.id
+		WHERE le.user_id = ?
+		  AND le.entry_type = 'STOCK'
+		  AND le.stock_symbol IS NOT NULL
+		  AND re.deleted_at IS NULL
+		  AND le.timestamp < ?
+		GROUP BY le.stock_symbol
+		HAVING SUM(le.quantity) > 0
+		ORDER BY le.stock_symbol
+	`, userID, t).Scan(&rows).Error
+	if err != nil {
+		return nil, decimal.Zero, fmt.Errorf("failed to fetch holdings: %w", err)
+	}
+
+	valuationTime := s.calendar.LastSessionClose(t.Add(-time.Nanosecond))
+	holdings := make([]StatementHolding, 0, len(rows))
+	total := decimal.Zero
+	for _, row := range rows {
+		price, err := s.priceService.GetPriceAtTime(row.StockSymbol, valuationTime)
+		if err != nil {
+			return nil, decimal.Zero, fmt.Errorf("failed to price %s: %w", row.StockSymbol, err)
+		}
+		value := utils.RoundINR(price.Mul(row.Quantity))
+		holdings = append(holdings, StatementHolding{
+			Symbol:   row.StockSymbol,
+			Quantity: row.Quantity,
+			PriceINR: price,
+			ValueINR: value,
+		})
+		total = total.Add(value)
+	}
+	return holdings, total, nil
+}
+
+// GetStatement returns a stored statement
+func (s *StatementService) GetStatement(userID int, month string) (*models.AccountStatement, error) {
+	var statement models.AccountStatement
+	err := db.DB.Where("user_id = ? AND month = ?", userID, month).First(&statement).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrStatementNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch statement: %w", err)
+	}
+	return &statement, nil
+}
+
+// ListStatements returns the months a user has statements for, newest first
+func (s *StatementService) ListStatements(userID int) ([]models.AccountStatement, error) {
+	var statements []models.AccountStatement
+	err := db.DB.Select("id", "user_id", "month", "opening_value_inr", "closing_value_inr", "generated_at").
+		Where("user_id = ?", userID).
+		Order("month DESC").
+		Find(&statements).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch statements: %w", err)
+	}
+	return statements, nil
+}
+
+// renderCSV writes the statement as one row per holding or movement, tagged by section
+func (m *MonthlyStatement) renderCSV() (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	rows := [][]string{{"section", "date", "type", "symbol", "quantity", "price_inr", "amount_inr", "reference"}}
+	holdingRows := func(section, date string, holdings []StatementHolding, total decimal.Decimal) {
+		for _, h := range holdings {
+			rows = append(rows, []string{section, date, "HOLDING", h.Symbol, h.Quantity.String(), h.PriceINR.StringFixed(4), h.ValueINR.StringFixed(4), ""})
+		}
+		rows = append(rows, []string{section, date, "TOTAL", "", "", "", total.StringFixed(4), ""})
+	}
+	activityRows := func(section string, activities []StatementActivity) {
+		for _, a := range activities {
+			rows = append(rows, []string{section, a.Timestamp.UTC().Format(time.RFC3339), a.Type, a.Symbol, a.Quantity.String(), "", a.AmountINR.StringFixed(4), a.Reference})
+		}
+	}
+
+	holdingRows("opening", m.From, m.OpeningHoldings, m.OpeningValueINR)
+	activityRows("rewards", m.Rewards)
+	activityRows("reversals", m.Reversals)
+	activityRows("sales", m.Sales)
+	activityRows("corporate_actions", m.CorporateActions)
+	activityRows("other", m.OtherActivity)
+	holdingRows("closing", m.To, m.ClosingHoldings, m.ClosingValueINR)
+
+	if err := writer.WriteAll(rows); err != nil {
+		return "", fmt.Errorf("failed to write statement csv: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// statementTemplate is a printable statement; browsers can save it as PDF
+var statementTemplate = template.Must(template.New("statement").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Statement {{.Month}} - User {{.UserID}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 12px; margin: 24px; color: #222; }
+h1 { font-size: 18px; margin-bottom: 4px; }
+h2 { font-size: 14px; margin: 20px 0 6px; border-bottom: 1px solid #999; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 4px 6px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num, th.num { text-align: right; }
+tr.total td { font-weight: bold; }
+.empty { color: #777; font-style: italic; }
+@media print { body { margin: 0; } h2 { page-break-after: avoid; } }
+</style>
+</head>
+<body>
+<h1>Account Statement: {{.Month}}</h1>
+<div>User {{.UserID}} &middot; {{.From}} to {{.To}} ({{.Timezone}}) &middot; generated {{.GeneratedAt.Format "2006-01-02 15:04 MST"}}</div>
+{{define "holdings"}}
+{{if .}}<table>
+<tr><th>Symbol</th><th class="num">Quantity</th><th class="num">Price (INR)</th><th class="num">Value (INR)</th></tr>
+{{range .}}<tr><td>{{.Symbol}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.PriceINR.StringFixed 2}}</td><td class="num">{{.ValueINR.StringFixed 2}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">No holdings</p>{{end}}
+{{end}}
+{{define "activity"}}
+{{if .}}<table>
+<tr><th>Date</th><th>Symbol</th><th class="num">Quantity</th><th class="num">Amount (INR)</th><th>Reference</th></tr>
+{{range .}}<tr><td>{{.Timestamp.Format "2006-01-02 15:04"}}</td><td>{{.Symbol}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.AmountINR.StringFixed 2}}</td><td>{{.Reference}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">None</p>{{end}}
+{{end}}
+<h2>Opening holdings ({{.From}}): INR {{.OpeningValueINR.StringFixed 2}}</h2>
+{{template "holdings" .OpeningHoldings}}
+<h2>Rewards received</h2>
+{{template "activity" .Rewards}}
+<h2>Reversals</h2>
+{{template "activity" .Reversals}}
+<h2>Sales</h2>
+{{template "activity" .Sales}}
+<h2>Corporate actions</h2>
+{{template "activity" .CorporateActions}}
+{{if .OtherActivity}}<h2>Other movements</h2>
+{{template "activity" .OtherActivity}}{{end}}
+<h2>Closing holdings ({{.To}}): INR {{.ClosingValueINR.StringFixed 2}}</h2>
+{{template "holdings" .ClosingHoldings}}
+</body>
+</html>
+`))
+
+// renderHTML renders the printable statement
+func (m *MonthlyStatement) renderHTML() (string, error) {
+	var buf bytes.Buffer
+	if err := statementTemplate.Execute(&buf, m); err != nil {
+		return "", fmt.Errorf("failed to render statement html: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseStatementMonth(t *testing.T) {
+	from, to, err := parseStatementMonth("2024-02")
+	if err != nil {
+		t.Fatalf("parseStatementMonth: %v", err)
+	}
+	ist := utils.ISTLocation()
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, ist); !from.Equal(want) {
+		t.Errorf("from = %s, want %s", from, want)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, ist); !to.Equal(want) {
+		t.Errorf("to = %s, want %s", to, want)
+	}
+
+	current := utils.NowUTC().In(ist).Format(statementMonthLayout)
+	for _, month := range []string{"2024-13", "2024/02", "", current} {
+		if _, _, err := parseStatementMonth(month); !errors.Is(err, ErrInvalidStatementMonth) {
+			t.Errorf("parseStatementMonth(%q) err = %v, want ErrInvalidStatementMonth", month, err)
+		}
+	}
+
+	if _, _, err := parseStatementMonth(PreviousStatementMonth()); err != nil {
+		t.Errorf("previous month %s is not a completed month: %v", PreviousStatementMonth(), err)
+	}
+}
+
+func TestMonthlyStatementIsEmpty(t *testing.T) {
+	statement := &MonthlyStatement{}
+	if !statement.isEmpty() {
+		t.Error("statement with nothing in it is not empty")
+	}
+	statement.Reversals = []StatementActivity{{Symbol: "TCS"}}
+	if statement.isEmpty() {
+		t.Error("statement with a reversal is empty")
+	}
+}
+
+func TestRenderStatement(t *testing.T) {
+	statement := &MonthlyStatement{
+		UserID:   fixtureUserID,
+		Month:    "2024-02",
+		From:     "2024-02-01",
+		To:       "2024-02-29",
+		Timezone: "Asia/Kolkata",
+		ClosingHoldings: []StatementHolding{
+			{Symbol: "TCS", Quantity: decimal.RequireFromString("1.5"), PriceINR: decimal.NewFromInt(4000), ValueINR: decimal.NewFromInt(6000)},
+		},
+		ClosingValueINR: decimal.NewFromInt(6000),
+		Rewards: []StatementActivity{{
+			Timestamp: time.Date(2024, 2, 5, 4, 30, 0, 0, time.UTC),
+			Type:      "REWARD",
+			Symbol:    "TCS",
+			Quantity:  decimal.RequireFromString("1.5"),
+			AmountINR: decimal.NewFromInt(5850),
+			Reference: "REWARD-7",
+		}},
+		GeneratedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	csv, err := statement.renderCSV()
+	if err != nil {
+		t.Fatalf("renderCSV: %v", err)
+	}
+	want := strings.Join([]string{
+		"section,date,type,symbol,quantity,price_inr,amount_inr,reference",
+		"opening,2024-02-01,TOTAL,,,,0.0000,",
+		"rewards,2024-02-05T04:30:00Z,REWARD,TCS,1.5,,5850.0000,REWARD-7",
+		"closing,2024-02-29,HOLDING,TCS,1.5,4000.0000,6000.0000,",
+		"closing,2024-02-29,TOTAL,,,,6000.0000,",
+		"",
+	}, "\n")
+	if csv != want {
+		t.Errorf("renderCSV =\n%s\nwant\n%s", csv, want)
+	}
+
+	html, err := statement.renderHTML()
+	if err != nil {
+		t.Fatalf("renderHTML: %v", err)
+	}
+	for _, fragment := range []string{"Account Statement: 2024-02", "Closing holdings (2024-02-29): INR 6000.00", "REWARD-7", "No holdings"} {
+		if !strings.Contains(html, fragment) {
+			t.Errorf("renderHTML is missing %q", fragment)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Fractional share policies for outbound transfers
+const (
+	// FractionRefuse rejects transfers of fractional quantities
+	FractionRefuse = "refuse"
+	// FractionCash transfers the whole shares and sells the fraction for INR
+	FractionCash = "cash"
+)
+
+var (
+	// ErrInvalidTransfer is returned for a transfer request that cannot be accepted
+	ErrInvalidTransfer = errors.New("invalid transfer")
+
+	// ErrTransferNotFound is returned when a transfer does not exist for the user
+	ErrTransferNotFound = errors.New("transfer not found")
+
+	// ErrTransfersDisabled is returned when no depository is configured
+	ErrTransfersDisabled = errors.New("transfers are disabled")
+)
+
+// dematAccountPattern accepts NSDL (IN + 14 characters) and CDSL (16 digits) account IDs
+var dematAccountPattern = regexp.MustCompile(`^(IN[0-9A-Z]{14}|[0-9]{16})$`)
+
+// TransferConfig controls outbound transfers
+type TransferConfig struct {
+	// FractionPolicy is FractionRefuse or FractionCash
+	FractionPolicy string
+}
+
+// LoadTransferConfig reads TRANSFER_* environment variables
+func LoadTransferConfig() TransferConfig {
+	policy := strings.ToLower(os.Getenv("TRANSFER_FRACTION_POLICY"))
+	switch policy {
+	case FractionRefuse, FractionCash:
+	case "":
+		policy = FractionRefuse
+	default:
+		logrus.Warnf("Invalid TRANSFER_FRACTION_POLICY %q, using %s", policy, FractionRefuse)
+		policy = FractionRefuse
+	}
+	return TransferConfig{FractionPolicy: policy}
+}
+
+// TransferService moves users' reward shares to their own demat accounts
+type TransferService struct {
+	priceService *PriceService
+	depository   Depository
+	config       TransferConfig
+}
+
+// NewTransferService creates a new transfer service
+func NewTransferService(priceService *PriceService, depository Depository, config TransferConfig) *TransferService {
+	return &TransferService{
+		priceService: priceService,
+		depository:   depository,
+		config:       config,
+	}
+}
+
+// RequestTransfer reserves a quantity of a user's shares for delivery; the
+// sync job hands the whole shares to the depository. A fractional remainder is
+// refused or, under FractionCash, sold for INR when the transfer completes.
+func (s *TransferService) RequestTransfer(userID int, symbol string, quantity decimal.Decimal, dematAccount string) (*models.Transfer, error) {
+	if s.depository == nil {
+		return nil, ErrTransfersDisabled
+	}
+	if err := utils.ValidateStockSymbol(symbol); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+	if err := utils.ValidateQuantity(quantity); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+	dematAccount = strings.ToUpper(strings.TrimSpace(dematAccount))
+	if !dematAccountPattern.MatchString(dematAccount) {
+		return nil, fmt.Errorf("%w: demat account must be IN followed by 14 characters or 16 digits", ErrInvalidTransfer)
+	}
+
+	quantity = utils.RoundQuantity(quantity)
+	whole := quantity.Floor()
+	fraction := quantity.Sub(whole)
+	if fraction.IsPositive() && s.config.FractionPolicy == FractionRefuse {
+		return nil, fmt.Errorf("%w: only whole shares can be transferred", ErrInvalidTransfer)
+	}
+	if !whole.IsPositive() {
+		return nil, fmt.Errorf("%w: at least one whole share is required", ErrInvalidTransfer)
+	}
+
+	transfer := models.Transfer{
+		UserID:             userID,
+		StockSymbol:        symbol,
+		Quantity:           whole,
+		FractionalQuantity: fraction,
+		DematAccount:       dematAccount,
+		Status:             models.TransferRequested,
+		RequestedAt:        utils.NowUTC(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserHoldings(tx, userID); err != nil {
+			return err
+		}
+
+		available, err := availableHoldingInTx(tx, userID, symbol)
+		if err != nil {
+			return err
+		}
+
+		// Only settled shares can leave for another depository account
+		unsettled, err := unsettledHoldingInTx(tx, userID, symbol)
+		if err != nil {
+			return err
+		}
+		available = available.Sub(unsettled)
+		if available.LessThan(quantity) {
+			return fmt.Errorf("%w: %s settled and available %s (%s unsettled), transferring %s",
+				ErrInsufficientHoldings, symbol, available.String(), unsettled.String(), quantity.String())
+		}
+
+		if err := tx.Create(&transfer).Error; err != nil {
+			return fmt.Errorf("failed to create transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"transferId": transfer.ID,
+		"userId":     userID,
+		"symbol":     symbol,
+		"quantity":   whole,
+		"fraction":   fraction,
+	}).Info("Transfer requested")
+
+	return &transfer, nil
+}
+
+// submit hands a requested transfer to the depository and marks it processing
+func (s *TransferService) submit(transfer *models.Transfer) error {
+	ref, err := s.depository.Submit(DepositoryInstruction{
+		TransferID:   transfer.ID,
+		UserID:       transfer.UserID,
+		Symbol:       transfer.StockSymbol,
+		Quantity:     transfer.Quantity,
+		DematAccount: transfer.DematAccount,
+		RequestedAt:  transfer.RequestedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := db.DB.Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferRequested).
+		Updates(map[string]interface{}{
+			"status":         models.TransferProcessing,
+			"depository_ref": ref,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark transfer processing: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		transfer.Status = models.TransferProcessing
+		transfer.DepositoryRef = ref
+	}
+	return nil
+}
+
+// SyncTransfers submits requested transfers and settles processing ones the
+// depository has completed or failed. Submission happens only here, so
+// instructions leave from the job's leader rather than whichever instance
+// took the request.
+func (s *TransferService) SyncTransfers() error {
+	if s.depository == nil {
+		return nil
+	}
+
+	var transfers []models.Transfer
+	err := db.DB.Where("status IN ?", []models.TransferStatus{models.TransferRequested, models.TransferProcessing}).
+		Order("id").
+		Find(&transfers).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch open transfers: %w", err)
+	}
+
+	var failed int
+	for i := range transfers {
+		transfer := &transfers[i]
+		if err := s.sync(transfer); err != nil {
+			logrus.WithError(err).WithField("transferId", transfer.ID).Error("Failed to sync transfer")
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d of %d transfers", failed, len(transfers))
+	}
+	return nil
+}
+
+// sync moves one open transfer on as far as the depository allows
+func (s *TransferService) sync(transfer *models.Transfer) error {
+	if transfer.Status == models.TransferRequested {
+		return s.submit(transfer)
+	}
+
+	result, err := s.depository.Status(transfer.DepositoryRef)
+	if err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case DepositoryCompleted:
+		return s.complete(transfer.ID)
+	case DepositoryFailed:
+		return s.fail(transfer.ID, result.Reason)
+	}
+	return nil
+}
+
+// complete books a delivered transfer: the STOCK debit of the whole shares
+// and, for a fractional remainder, a cash sale at the current price
+func (s *TransferService) complete(transferID uint) error {
+	var transfer models.Transfer
+	if err := db.DB.First(&transfer, transferID).Error; err != nil {
+		return fmt.Errorf("failed to fetch transfer: %w", err)
+	}
+
+	quote, err := s.priceService.GetCurrentQuote(transfer.StockSymbol)
+	if err != nil {
+		return fmt.Errorf("failed to get stock price: %w", err)
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUserHoldings(tx, transfer.UserID); err != nil {
+			return err
+		}
+
+		// Re-read under lock so concurrent syncs book a transfer once
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transfer, transferID).Error; err != nil {
+			return fmt.Errorf("failed to lock transfer: %w", err)
+		}
+		if transfer.Status != models.TransferProcessing {
+			return nil
+		}
+
+		now := utils.NowUTC()
+		entries := []models.LedgerEntry{transferLedgerEntry(&transfer, quote, now)}
+
+		if transfer.FractionalQuantity.IsPositive() {
+			gross := utils.RoundINR(quote.PriceINR.Mul(transfer.FractionalQuantity))
+			sale := models.Sale{
+				UserID:      transfer.UserID,
+				StockSymbol: transfer.StockSymbol,
+				Quantity:    transfer.FractionalQuantity,
+				Price:       quote.Price,
+				Currency:    quote.Currency,
+				FxRate:      quote.FxRate,
+				PriceINR:    quote.PriceINR,
+				GrossINR:    gross,
+				FeesINR:     decimal.Zero,
+				NetINR:      gross,
+				Timestamp:   now,
+			}
+			if err := tx.Create(&sale).Error; err != nil {
+				return fmt.Errorf("failed to create fraction sale: %w", err)
+			}
+			entries = append(entries, saleLedgerEntries(&sale)...)
+			transfer.FractionSaleID = &sale.ID
+		}
+
+		if err := tx.Create(&entries).Error; err != nil {
+			return fmt.Errorf("failed to create ledger entries: %w", err)
+		}
+
+		transfer.Status = models.TransferCompleted
+		transfer.CompletedAt = &now
+		if err := tx.Save(&transfer).Error; err != nil {
+			return fmt.Errorf("failed to complete transfer: %w", err)
+		}
+
+		return notifyHoldingsChanged(tx, transfer.UserID, "transfer")
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"transferId": transfer.ID,
+		"userId":     transfer.UserID,
+		"symbol":     transfer.StockSymbol,
+		"quantity":   transfer.Quantity,
+	}).Info("Transfer completed")
+
+	return nil
+}
+
+// transferLedgerEntry builds the user's STOCK debit for delivered shares,
+// valued at the price on completion
+func transferLedgerEntry(transfer *models.Transfer, quote Quote, timestamp time.Time) models.LedgerEntry {
+	symbol := transfer.StockSymbol
+	return models.LedgerEntry{
+		UserID:         transfer.UserID,
+		ReferenceType:  models.ReferenceTransfer,
+		ReferenceID:    transfer.ID,
+		Account:        models.AccountUser,
+		EntryType:      models.EntryTypeStock,
+		StockSymbol:    &symbol,
+		Quantity:       transfer.Quantity.Neg(),
+		AmountINR:      utils.RoundINR(quote.PriceINR.Mul(transfer.Quantity)).Neg(),
+		Currency:       quote.Currency,
+		AmountOriginal: utils.RoundINR(quote.Price.Mul(transfer.Quantity)).Neg(),
+		FxRate:         quote.FxRate,
+		Timestamp:      timestamp,
+	}
+}
+
+// fail marks a processing transfer failed, releasing its reserved shares
+func (s *TransferService) fail(transferID uint, reason string) error {
+	reason = utils.TruncateString(reason, 255)
+	err := db.DB.Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transferID, models.TransferProcessing).
+		Updates(map[string]interface{}{
+			"status":         models.TransferFailed,
+			"failure_reason": reason,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark transfer failed: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"transferId": transferID,
+		"reason":     reason,
+	}).Warn("Transfer failed at depository")
+	return nil
+}
+
+// ListTransfers returns a user's transfers, newest first
+func (s *TransferService) ListTransfers(userID int) ([]models.Transfer, error) {
+	var transfers []models.Transfer
+	if err := db.DB.Where("user_id = ?", userID).Order("requested_at DESC").Find(&transfers).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// GetTransfer returns one of a user's transfers
+func (s *TransferService) GetTransfer(userID int, transferID uint) (*models.Transfer, error) {
+	var transfer models.Transfer
+	err := db.DB.Where("id = ? AND user_id = ?", transferID, userID).First(&transfer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTransferNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transfer: %w", err)
+	}
+	return &transfer, nil
+}
+
+// availableHoldingInTx returns a user's holding of a symbol less the shares
+// reserved by transfers still in flight
+func availableHoldingInTx(tx *gorm.DB, userID int, symbol string) (decimal.Decimal, error) {
+	held, err := symbolHoldingInTx(tx, userID, symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	var reserved decimal.NullDecimal
+	err = tx.Model(&models.Transfer{}).
+		Select("SUM(quantity + fractional_quantity)").
+		Where("user_id = ? AND stock_symbol = ? AND status IN ?", userID, symbol,
+			[]models.TransferStatus{models.TransferRequested, models.TransferProcessing}).
+		Scan(&reserved).Error
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to fetch reserved transfers: %w", err)
+	}
+
+	return held.Sub(reserved.Decimal), nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRequestTransferValidation(t *testing.T) {
+	depository, err := NewFileDepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refuse := NewTransferService(nil, depository, TransferConfig{FractionPolicy: FractionRefuse})
+	cash := NewTransferService(nil, depository, TransferConfig{FractionPolicy: FractionCash})
+
+	tests := []struct {
+		name     string
+		service  *TransferService
+		quantity string
+		demat    string
+	}{
+		{"bad demat account", refuse, "2", "IN123"},
+		{"fraction refused", refuse, "2.5", "IN30012345678901"},
+		{"no whole share", cash, "0.5", "1234567890123456"},
+		{"zero quantity", refuse, "0", "IN30012345678901"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.service.RequestTransfer(fixtureUserID, "TCS", decimal.RequireFromString(tt.quantity), tt.demat)
+			if !errors.Is(err, ErrInvalidTransfer) {
+				t.Errorf("err = %v, want ErrInvalidTransfer", err)
+			}
+		})
+	}
+
+	disabled := NewTransferService(nil, nil, TransferConfig{FractionPolicy: FractionRefuse})
+	if _, err := disabled.RequestTransfer(fixtureUserID, "TCS", decimal.NewFromInt(1), "IN30012345678901"); !errors.Is(err, ErrTransfersDisabled) {
+		t.Errorf("err = %v, want ErrTransfersDisabled", err)
+	}
+	if err := disabled.SyncTransfers(); err != nil {
+		t.Errorf("SyncTransfers without a depository: %v", err)
+	}
+}
+
+func TestTransferLifecycle(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	symbol := "TCS"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(4000),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(4000),
+		Timestamp:   now,
+	})
+	mustCreate(t, &models.LedgerEntry{
+		UserID:        fixtureUserID,
+		ReferenceType: models.ReferenceSale,
+		Account:       models.AccountUser,
+		EntryType:     models.EntryTypeStock,
+		StockSymbol:   &symbol,
+		Quantity:      decimal.NewFromInt(5),
+		AmountINR:     decimal.NewFromInt(20000),
+		Timestamp:     now,
+	})
+
+	dir := t.TempDir()
+	depository, err := NewFileDepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewTransferService(NewPriceService(NewMarketCalendar()), depository, TransferConfig{FractionPolicy: FractionRefuse})
+
+	reload := func(transfer *models.Transfer) {
+		t.Helper()
+		if err := db.DB.First(transfer, transfer.ID).Error; err != nil {
+			t.Fatalf("failed to reload transfer: %v", err)
+		}
+	}
+	respond := func(ref, body string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "responses", ref+".json"), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivered, err := service.RequestTransfer(fixtureUserID, symbol, decimal.NewFromInt(2), "IN30012345678901")
+	if err != nil {
+		t.Fatalf("RequestTransfer: %v", err)
+	}
+	rejected, err := service.RequestTransfer(fixtureUserID, symbol, decimal.NewFromInt(2), "IN30012345678901")
+	if err != nil {
+		t.Fatalf("RequestTransfer: %v", err)
+	}
+
+	// Both transfers reserve their shares, leaving one available
+	if _, err := service.RequestTransfer(fixtureUserID, symbol, decimal.NewFromInt(2), "IN30012345678901"); !errors.Is(err, ErrInsufficientHoldings) {
+		t.Errorf("over-reserving err = %v, want ErrInsufficientHoldings", err)
+	}
+
+	// Requests are only submitted by the sync job
+	if delivered.Status != models.TransferRequested {
+		t.Errorf("status = %s, want %s", delivered.Status, models.TransferRequested)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "outbox")); len(entries) != 0 {
+		t.Errorf("%d instructions submitted on request, want none", len(entries))
+	}
+
+	if err := service.SyncTransfers(); err != nil {
+		t.Fatalf("SyncTransfers: %v", err)
+	}
+	reload(delivered)
+	reload(rejected)
+	if delivered.Status != models.TransferProcessing || delivered.DepositoryRef == "" {
+		t.Fatalf("transfer = %s %q, want PROCESSING with a reference", delivered.Status, delivered.DepositoryRef)
+	}
+
+	respond(delivered.DepositoryRef, `{"status": "COMPLETED"}`)
+	respond(rejected.DepositoryRef, `{"status": "FAILED", "reason": "`+strings.Repeat("₹", 300)+`"}`)
+	if err := service.SyncTransfers(); err != nil {
+		t.Fatalf("SyncTransfers: %v", err)
+	}
+
+	reload(delivered)
+	if delivered.Status != models.TransferCompleted {
+		t.Errorf("status = %s, want %s", delivered.Status, models.TransferCompleted)
+	}
+	reload(rejected)
+	if rejected.Status != models.TransferFailed || len([]rune(rejected.FailureReason)) != 255 {
+		t.Errorf("transfer = %s with %d-character reason, want FAILED with 255", rejected.Status, len([]rune(rejected.FailureReason)))
+	}
+
+	held, err := symbolHoldingInTx(db.DB, fixtureUserID, symbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := decimal.NewFromInt(3); !held.Equal(want) {
+		t.Errorf("holding = %s, want %s", held, want)
+	}
+}
@@ -0,0 +1,527 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Treasury shortfall policies
+const (
+	// ShortfallRefuse rejects a reward the treasury cannot cover
+	ShortfallRefuse = "refuse"
+	// ShortfallIssue issues a reward the treasury cannot cover without drawing
+	// from inventory. It is only used when configured explicitly.
+	ShortfallIssue = "issue"
+	// ShortfallQueue records the reward as QUEUED and issues it when a lot arrives
+	ShortfallQueue = "queue"
+)
+
+var (
+	// ErrInsufficientInventory is returned when treasury lots cannot cover a reward
+	ErrInsufficientInventory = errors.New("insufficient treasury inventory")
+
+	// ErrInvalidTreasuryLot is returned for an unusable purchase lot
+	ErrInvalidTreasuryLot = errors.New("invalid treasury lot")
+)
+
+// lotAgeBuckets are the upper bounds (in days) of the lot ageing report
+var lotAgeBuckets = []struct {
+	label   string
+	maxDays int
+}{
+	{"0-30", 30},
+	{"31-90", 90},
+	{"91-180", 180},
+	{"181-365", 365},
+	{"365+", -1},
+}
+
+// TreasuryConfig controls how rewards draw from treasury inventory
+type TreasuryConfig struct {
+	// ShortfallPolicy is ShortfallRefuse, ShortfallQueue or ShortfallIssue
+	ShortfallPolicy string
+}
+
+// LoadTreasuryConfig reads TREASURY_* environment variables. The shortfall
+// policy defaults to refuse; an unknown value also refuses rather than
+// issuing shares the treasury does not hold.
+func LoadTreasuryConfig() TreasuryConfig {
+	policy := strings.ToLower(os.Getenv("TREASURY_SHORTFALL_POLICY"))
+	switch policy {
+	case ShortfallRefuse, ShortfallQueue, ShortfallIssue:
+	case "":
+		policy = ShortfallRefuse
+	default:
+		logrus.Warnf("Invalid TREASURY_SHORTFALL_POLICY %q, using %s", policy, ShortfallRefuse)
+		policy = ShortfallRefuse
+	}
+	return TreasuryConfig{ShortfallPolicy: policy}
+}
+
+// TreasuryLotInput describes a company purchase of shares
+type TreasuryLotInput struct {
+	Symbol      string
+	Quantity    decimal.Decimal
+	Price       decimal.Decimal
+	FeesINR     decimal.Decimal
+	PurchasedAt time.Time
+	Reference   string
+}
+
+// TreasuryService tracks the shares the company holds for rewards
+type TreasuryService struct {
+	priceService *PriceService
+	calendar     *MarketCalendar
+	config       TreasuryConfig
+}
+
+// NewTreasuryService creates a new treasury service
+func NewTreasuryService(priceService *PriceService, calendar *MarketCalendar, config TreasuryConfig) *TreasuryService {
+	return &TreasuryService{
+		priceService: priceService,
+		calendar:     calendar,
+		config:       config,
+	}
+}
+
+// IssueOnShortfall reports whether rewards are issued without inventory when it runs short
+func (s *TreasuryService) IssueOnShortfall() bool {
+	return s.config.ShortfallPolicy == ShortfallIssue
+}
+
+// QueueOnShortfall reports whether rewards are queued rather than refused when inventory runs short
+func (s *TreasuryService) QueueOnShortfall() bool {
+	return s.config.ShortfallPolicy == ShortfallQueue
+}
+
+// AddLot records a purchase lot and issues any queued rewards it can now cover.
+// The lot's INR cost uses the FX rate in force at the purchase time.
+func (s *TreasuryService) AddLot(input TreasuryLotInput) (*models.TreasuryLot, int, error) {
+	switch {
+	case !input.Quantity.IsPositive():
+		return nil, 0, fmt.Errorf("%w: quantity must be positive", ErrInvalidTreasuryLot)
+	case !input.Price.IsPositive():
+		return nil, 0, fmt.Errorf("%w: price must be positive", ErrInvalidTreasuryLot)
+	case input.FeesINR.IsNegative():
+		return nil, 0, fmt.Errorf("%w: fees cannot be negative", ErrInvalidTreasuryLot)
+	case input.PurchasedAt.After(utils.NowUTC()):
+		return nil, 0, fmt.Errorf("%w: purchase time is in the future", ErrInvalidTreasuryLot)
+	}
+
+	var config models.StockConfig
+	err := db.DB.Where("stock_symbol = ?", input.Symbol).First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ErrUnknownSymbol
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load stock config: %w", err)
+	}
+
+	fxRate, err := s.priceService.GetFxRateAt(config.Currency, input.PurchasedAt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	quantity := input.Quantity.Round(6)
+	lot := models.TreasuryLot{
+		StockSymbol:       input.Symbol,
+		Quantity:          quantity,
+		RemainingQuantity: quantity,
+		Price:             input.Price,
+		Currency:          config.Currency,
+		FxRate:            fxRate,
+		FeesINR:           utils.RoundINR(input.FeesINR),
+		CostINR:           utils.RoundINR(input.Price.Mul(fxRate).Mul(quantity).Add(input.FeesINR)),
+		Reference:         input.Reference,
+		PurchasedAt:       input.PurchasedAt.UTC(),
+	}
+	if err := db.DB.Create(&lot).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to save treasury lot: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"lotId":    lot.ID,
+		"symbol":   lot.StockSymbol,
+		"quantity": lot.Quantity,
+		"costInr":  lot.CostINR,
+	}).Info("Treasury lot recorded")
+
+	issued, err := s.IssueQueuedRewards(input.Symbol)
+	if err != nil {
+		return &lot, issued, fmt.Errorf("lot saved but queued rewards failed: %w", err)
+	}
+	return &lot, issued, nil
+}
+
+// drawForRewardInTx draws a new reward's shares from inventory. Under the queue
+// policy a reward waits behind any reward already QUEUED for the symbol, so
+// queued rewards are issued in grant order; it then returns
+// ErrInsufficientInventory without drawing.
+func (s *TreasuryService) drawForRewardInTx(tx *gorm.DB, rewardEvent *models.RewardEvent) error {
+	if err := lockTreasurySymbol(tx, rewardEvent.StockSymbol); err != nil {
+		return err
+	}
+
+	if s.QueueOnShortfall() {
+		var queued int64
+		err := tx.Model(&models.RewardEvent{}).
+			Where("stock_symbol = ? AND status = ?", rewardEvent.StockSymbol, models.RewardStatusQueued).
+			Count(&queued).Error
+		if err != nil {
+			return fmt.Errorf("failed to check queued rewards: %w", err)
+		}
+		if queued > 0 {
+			return fmt.Errorf("%w: %d earlier rewards queued for %s", ErrInsufficientInventory, queued, rewardEvent.StockSymbol)
+		}
+	}
+
+	_, err := s.allocateInTx(tx, rewardEvent)
+	return err
+}
+
+// lockTreasurySymbol serialises draws and queue issuance for a symbol until
+// the transaction ends, so a new reward cannot overtake one being queued
+func lockTreasurySymbol(tx *gorm.DB, symbol string) error {
+	key := advisoryLockKey(dataLockNamespace, "treasury:"+symbol)
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", key).Error; err != nil {
+		return fmt.Errorf("failed to lock treasury: %w", err)
+	}
+	return nil
+}
+
+// allocateInTx draws a reward's quantity from the symbol's open lots, oldest
+// first, locking them for the rest of the transaction. Nothing is drawn if
+// the lots cannot cover the whole reward.
+func (s *TreasuryService) allocateInTx(tx *gorm.DB, rewardEvent *models.RewardEvent) ([]models.TreasuryAllocation, error) {
+	var lots []models.TreasuryLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("stock_symbol = ? AND remaining_quantity > 0", rewardEvent.StockSymbol).
+		Order("purchased_at, id").
+		Find(&lots).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock treasury lots: %w", err)
+	}
+
+	allocations, err := drawFromLots(lots, rewardEvent.StockSymbol, rewardEvent.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make(map[uint]decimal.Decimal, len(lots))
+	for _, lot := range lots {
+		remaining[lot.ID] = lot.RemainingQuantity
+	}
+	for i := range allocations {
+		allocations[i].RewardEventID = rewardEvent.ID
+		left := remaining[allocations[i].LotID].Sub(allocations[i].Quantity)
+		err := tx.Model(&models.TreasuryLot{}).Where("id = ?", allocations[i].LotID).Update("remaining_quantity", left).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to draw from treasury lot: %w", err)
+		}
+	}
+
+	if err := tx.Create(&allocations).Error; err != nil {
+		return nil, fmt.Errorf("failed to save treasury allocations: %w", err)
+	}
+	return allocations, nil
+}
+
+// drawFromLots takes quantity from lots in the order given (oldest first),
+// costing each draw pro rata from its lot. Nothing is drawn if the lots cannot
+// cover the whole quantity.
+func drawFromLots(lots []models.TreasuryLot, symbol string, quantity decimal.Decimal) ([]models.TreasuryAllocation, error) {
+	available := decimal.Zero
+	for _, lot := range lots {
+		available = available.Add(lot.RemainingQuantity)
+	}
+	if available.LessThan(quantity) {
+		return nil, fmt.Errorf("%w: %s needs %s, %s available", ErrInsufficientInventory,
+			symbol, quantity.String(), available.String())
+	}
+
+	var allocations []models.TreasuryAllocation
+	needed := quantity
+	for _, lot := range lots {
+		if !needed.IsPositive() {
+			break
+		}
+		if !lot.RemainingQuantity.IsPositive() {
+			continue
+		}
+
+		take := decimal.Min(needed, lot.RemainingQuantity)
+		allocations = append(allocations, models.TreasuryAllocation{
+			LotID:    lot.ID,
+			Quantity: take,
+			CostINR:  utils.RoundINR(lot.CostINR.Mul(take).Div(lot.Quantity)),
+		})
+		needed = needed.Sub(take)
+	}
+	return allocations, nil
+}
+
+// returnAllocationsInTx puts a reversed reward's shares back into the lots it
+// drew from. Each return is recorded as a negative allocation, so it is done
+// at most once per reward.
+func returnAllocationsInTx(tx *gorm.DB, rewardEventID uint) error {
+	var allocations []models.TreasuryAllocation
+	if err := tx.Where("reward_event_id = ?", rewardEventID).Find(&allocations).Error; err != nil {
+		return fmt.Errorf("failed to fetch treasury allocations: %w", err)
+	}
+
+	var returns []models.TreasuryAllocation
+	for _, allocation := range allocations {
+		if allocation.Quantity.IsNegative() {
+			return nil
+		}
+		returns = append(returns, models.TreasuryAllocation{
+			RewardEventID: rewardEventID,
+			LotID:         allocation.LotID,
+			Quantity:      allocation.Quantity.Neg(),
+			CostINR:       allocation.CostINR.Neg(),
+		})
+	}
+	if len(returns) == 0 {
+		return nil
+	}
+
+	for _, r := range returns {
+		err := tx.Model(&models.TreasuryLot{}).
+			Where("id = ?", r.LotID).
+			Update("remaining_quantity", gorm.Expr("remaining_quantity - ?", r.Quantity)).Error
+		if err != nil {
+			return fmt.Errorf("failed to return shares to treasury lot: %w", err)
+		}
+	}
+	if err := tx.Create(&returns).Error; err != nil {
+		return fmt.Errorf("failed to record treasury returns: %w", err)
+	}
+	return nil
+}
+
+// IssueQueuedRewards issues QUEUED rewards for a symbol in the order they
+// were granted, at the current price, stopping at the first one the treasury
+// cannot cover so earlier rewards are never overtaken
+func (s *TreasuryService) IssueQueuedRewards(symbol string) (int, error) {
+	issued := 0
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockTreasurySymbol(tx, symbol); err != nil {
+			return err
+		}
+
+		var queued []models.RewardEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("stock_symbol = ? AND status = ?", symbol, models.RewardStatusQueued).
+			Order("timestamp, id").
+			Find(&queued).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch queued rewards: %w", err)
+		}
+		if len(queued) == 0 {
+			return nil
+		}
+
+		quote, err := s.priceService.GetCurrentQuote(symbol)
+		if err != nil {
+			return fmt.Errorf("failed to get stock price: %w", err)
+		}
+
+		for i := range queued {
+			reward := &queued[i]
+
+			// Each reward gets a savepoint so a shortfall leaves earlier issues intact
+			err := tx.Transaction(func(rewardTx *gorm.DB) error {
+				if _, err := s.allocateInTx(rewardTx, reward); err != nil {
+					return err
+				}
+				reward.SettlementStatus = models.SettlementUnsettled
+				reward.SettlementDate = s.calendar.SettlementDate(utils.NowUTC())
+				entries := rewardLedgerEntries(reward, quote)
+				if err := rewardTx.Create(&entries).Error; err != nil {
+					return fmt.Errorf("failed to create ledger entries: %w", err)
+				}
+				err := rewardTx.Model(reward).Updates(map[string]interface{}{
+					"status":            models.RewardStatusIssued,
+					"settlement_status": reward.SettlementStatus,
+					"settlement_date":   reward.SettlementDate,
+				}).Error
+				if err != nil {
+					return fmt.Errorf("failed to mark reward issued: %w", err)
+				}
+				return notifyHoldingsChanged(rewardTx, reward.UserID, "reward")
+			})
+			if errors.Is(err, ErrInsufficientInventory) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			issued++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if issued > 0 {
+		logrus.WithFields(logrus.Fields{
+			"symbol": symbol,
+			"issued": issued,
+		}).Info("Issued queued rewards from treasury")
+	}
+	return issued, nil
+}
+
+// InventoryLevel summarises treasury inventory for one symbol
+type InventoryLevel struct {
+	Symbol            string                     `json:"symbol"`
+	OpenLots          int                        `json:"openLots"`
+	RemainingQuantity decimal.Decimal            `json:"remainingQuantity"`
+	RemainingCostINR  decimal.Decimal            `json:"remainingCostInr"`
+	QueuedQuantity    decimal.Decimal            `json:"queuedQuantity"`
+	QueuedRewards     int64                      `json:"queuedRewards"`
+	OldestLotAgeDays  int                        `json:"oldestLotAgeDays"`
+	Ageing            map[string]decimal.Decimal `json:"ageing"`
+}
+
+// GetInventory returns remaining inventory, queued demand and lot ageing
+// (remaining quantity by days since purchase) per symbol
+func (s *TreasuryService) GetInventory() ([]InventoryLevel, error) {
+	var lots []models.TreasuryLot
+	if err := db.DB.Where("remaining_quantity > 0").Order("purchased_at").Find(&lots).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch treasury lots: %w", err)
+	}
+
+	var queued []struct {
+		StockSymbol string
+		Quantity    decimal.Decimal
+		Rewards     int64
+	}
+	err := db.DB.Model(&models.RewardEvent{}).
+		Select("stock_symbol, SUM(quantity) AS quantity, COUNT(*) AS rewards").
+		Where("status = ?", models.RewardStatusQueued).
+		Group("stock_symbol").
+		Scan(&queued).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch queued rewards: %w", err)
+	}
+
+	levels := make(map[string]*InventoryLevel)
+	level := func(symbol string) *InventoryLevel {
+		if l, ok := levels[symbol]; ok {
+			return l
+		}
+		l := &InventoryLevel{
+			Symbol:            symbol,
+			RemainingQuantity: decimal.Zero,
+			RemainingCostINR:  decimal.Zero,
+			QueuedQuantity:    decimal.Zero,
+			Ageing:            make(map[string]decimal.Decimal, len(lotAgeBuckets)),
+		}
+		for _, bucket := range lotAgeBuckets {
+			l.Ageing[bucket.label] = decimal.Zero
+		}
+		levels[symbol] = l
+		return l
+	}
+
+	now := utils.NowUTC()
+	for _, lot := range lots {
+		l := level(lot.StockSymbol)
+		age := lotAgeDays(lot, now)
+		if l.OpenLots == 0 {
+			l.OldestLotAgeDays = age
+		}
+		l.OpenLots++
+		l.RemainingQuantity = l.RemainingQuantity.Add(lot.RemainingQuantity)
+		l.RemainingCostINR = l.RemainingCostINR.Add(remainingCost(lot))
+
+		label := ageBucket(age)
+		l.Ageing[label] = l.Ageing[label].Add(lot.RemainingQuantity)
+	}
+	for _, q := range queued {
+		l := level(q.StockSymbol)
+		l.QueuedQuantity = q.Quantity
+		l.QueuedRewards = q.Rewards
+	}
+
+	result := make([]InventoryLevel, 0, len(levels))
+	for _, l := range levels {
+		result = append(result, *l)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result, nil
+}
+
+// ListLots returns lots, oldest first, optionally for one symbol and only those with shares left
+func (s *TreasuryService) ListLots(symbol string, openOnly bool) ([]map[string]interface{}, error) {
+	query := db.DB.Order("purchased_at, id")
+	if symbol != "" {
+		query = query.Where("stock_symbol = ?", symbol)
+	}
+	if openOnly {
+		query = query.Where("remaining_quantity > 0")
+	}
+
+	var lots []models.TreasuryLot
+	if err := query.Find(&lots).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch treasury lots: %w", err)
+	}
+
+	now := utils.NowUTC()
+	result := make([]map[string]interface{}, 0, len(lots))
+	for _, lot := range lots {
+		result = append(result, map[string]interface{}{
+			"lot":              lot,
+			"ageDays":          lotAgeDays(lot, now),
+			"remainingCostInr": remainingCost(lot),
+		})
+	}
+	return result, nil
+}
+
+// ListQueuedRewards returns rewards waiting for inventory, oldest first
+func (s *TreasuryService) ListQueuedRewards() ([]models.RewardEvent, error) {
+	var rewards []models.RewardEvent
+	err := db.DB.Where("status = ?", models.RewardStatusQueued).
+		Order("timestamp, id").
+		Find(&rewards).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch queued rewards: %w", err)
+	}
+	return rewards, nil
+}
+
+// lotAgeDays is the number of whole days since a lot was bought
+func lotAgeDays(lot models.TreasuryLot, now time.Time) int {
+	return int(now.Sub(lot.PurchasedAt).Hours() / 24)
+}
+
+// remainingCost is the share of a lot's cost still held
+func remainingCost(lot models.TreasuryLot) decimal.Decimal {
+	return utils.RoundINR(lot.CostINR.Mul(lot.RemainingQuantity).Div(lot.Quantity))
+}
+
+// ageBucket returns the ageing bucket label for an age in days
+func ageBucket(days int) string {
+	for _, bucket := range lotAgeBuckets {
+		if bucket.maxDays < 0 || days <= bucket.maxDays {
+			return bucket.label
+		}
+	}
+	return lotAgeBuckets[len(lotAgeBuckets)-1].label
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func treasuryLot(id uint, quantity, remaining, cost string) models.TreasuryLot {
+	return models.TreasuryLot{
+		ID:                id,
+		StockSymbol:       "TCS",
+		Quantity:          decimal.RequireFromString(quantity),
+		RemainingQuantity: decimal.RequireFromString(remaining),
+		CostINR:           decimal.RequireFromString(cost),
+	}
+}
+
+func TestDrawFromLots(t *testing.T) {
+	lots := []models.TreasuryLot{
+		treasuryLot(1, "10", "2", "1000"),
+		treasuryLot(2, "5", "0", "600"),
+		treasuryLot(3, "4", "4", "500"),
+		treasuryLot(4, "3", "3", "390"),
+	}
+
+	tests := []struct {
+		name     string
+		quantity string
+		want     []models.TreasuryAllocation
+	}{
+		{
+			name:     "within the oldest lot",
+			quantity: "1.5",
+			want: []models.TreasuryAllocation{
+				{LotID: 1, Quantity: decimal.RequireFromString("1.5"), CostINR: decimal.RequireFromString("150")},
+			},
+		},
+		{
+			name:     "across lots, skipping empty ones",
+			quantity: "5",
+			want: []models.TreasuryAllocation{
+				{LotID: 1, Quantity: decimal.RequireFromString("2"), CostINR: decimal.RequireFromString("200")},
+				{LotID: 3, Quantity: decimal.RequireFromString("3"), CostINR: decimal.RequireFromString("375")},
+			},
+		},
+		{
+			name:     "every remaining share",
+			quantity: "9",
+			want: []models.TreasuryAllocation{
+				{LotID: 1, Quantity: decimal.RequireFromString("2"), CostINR: decimal.RequireFromString("200")},
+				{LotID: 3, Quantity: decimal.RequireFromString("4"), CostINR: decimal.RequireFromString("500")},
+				{LotID: 4, Quantity: decimal.RequireFromString("3"), CostINR: decimal.RequireFromString("390")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := drawFromLots(lots, "TCS", decimal.RequireFromString(tt.quantity))
+			if err != nil {
+				t.Fatalf("drawFromLots: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d allocations, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].LotID != tt.want[i].LotID || !got[i].Quantity.Equal(tt.want[i].Quantity) || !got[i].CostINR.Equal(tt.want[i].CostINR) {
+					t.Errorf("allocation %d = lot %d qty %s cost %s, want lot %d qty %s cost %s", i,
+						got[i].LotID, got[i].Quantity, got[i].CostINR,
+						tt.want[i].LotID, tt.want[i].Quantity, tt.want[i].CostINR)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawFromLotsShortfall(t *testing.T) {
+	lots := []models.TreasuryLot{
+		treasuryLot(1, "10", "2", "1000"),
+		treasuryLot(2, "4", "4", "500"),
+	}
+
+	got, err := drawFromLots(lots, "TCS", decimal.RequireFromString("6.5"))
+	if !errors.Is(err, ErrInsufficientInventory) {
+		t.Fatalf("err = %v, want ErrInsufficientInventory", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %d allocations on shortfall, want none", len(got))
+	}
+}
+
+func TestIssueQueuedRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	calendar := NewMarketCalendar()
+	priceService := NewPriceService(calendar)
+	treasury := NewTreasuryService(priceService, calendar, TreasuryConfig{ShortfallPolicy: ShortfallQueue})
+
+	now := utils.NowUTC()
+	queued := []*models.RewardEvent{
+		{UserID: fixtureUserID, StockSymbol: "TCS", Quantity: decimal.NewFromInt(2), Status: models.RewardStatusQueued, Timestamp: now.Add(-2 * time.Hour)},
+		{UserID: fixtureUserID, StockSymbol: "TCS", Quantity: decimal.NewFromInt(3), Status: models.RewardStatusQueued, Timestamp: now.Add(-time.Hour)},
+		{UserID: fixtureUserID, StockSymbol: "TCS", Quantity: decimal.NewFromInt(1), Status: models.RewardStatusQueued, Timestamp: now},
+	}
+	for _, reward := range queued {
+		mustCreate(t, reward)
+	}
+	lot := treasuryLot(0, "4", "4", "4000")
+	lot.PurchasedAt = now
+	mustCreate(t, &lot)
+
+	// The second reward cannot be covered, so the third must wait behind it
+	issued, err := treasury.IssueQueuedRewards("TCS")
+	if err != nil {
+		t.Fatalf("IssueQueuedRewards: %v", err)
+	}
+	if issued != 1 {
+		t.Fatalf("issued %d rewards, want 1", issued)
+	}
+
+	wantStatus := []models.RewardStatus{models.RewardStatusIssued, models.RewardStatusQueued, models.RewardStatusQueued}
+	for i, reward := range queued {
+		var stored models.RewardEvent
+		if err := db.DB.First(&stored, reward.ID).Error; err != nil {
+			t.Fatalf("failed to reload reward: %v", err)
+		}
+		if stored.Status != wantStatus[i] {
+			t.Errorf("reward %d status = %s, want %s", i, stored.Status, wantStatus[i])
+		}
+	}
+
+	if err := db.DB.First(&lot, lot.ID).Error; err != nil {
+		t.Fatalf("failed to reload lot: %v", err)
+	}
+	if !lot.RemainingQuantity.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("lot remaining = %s, want 2", lot.RemainingQuantity)
+	}
+
+	// Reversing the issued reward returns its shares to the lot
+	if err := NewLedgerService().CreateReversalEntries(queued[0]); err != nil {
+		t.Fatalf("CreateReversalEntries: %v", err)
+	}
+	if err := db.DB.First(&lot, lot.ID).Error; err != nil {
+		t.Fatalf("failed to reload lot: %v", err)
+	}
+	if !lot.RemainingQuantity.Equal(decimal.NewFromInt(4)) {
+		t.Errorf("lot remaining after reversal = %s, want 4", lot.RemainingQuantity)
+	}
+}
+
+func TestCreateRewardQueuesBehindQueuedRewards(t *testing.T) {
+	rollback := beginTestTx(t)
+	defer rollback()
+
+	const symbol = "QUETEST"
+	now := utils.NowUTC()
+	mustCreate(t, &models.PriceHistory{
+		StockSymbol: symbol,
+		Price:       decimal.NewFromInt(100),
+		Currency:    "INR",
+		PriceINR:    decimal.NewFromInt(100),
+		Timestamp:   now,
+	})
+
+	calendar := NewMarketCalendar()
+	priceService := NewPriceService(calendar)
+	treasury := NewTreasuryService(priceService, calendar, TreasuryConfig{ShortfallPolicy: ShortfallQueue})
+	service := NewRewardService(priceService, NewLedgerService(), treasury, NewBrokerService(priceService, nil, calendar, BrokerConfig{}), calendar)
+
+	earlier := models.RewardEvent{
+		UserID:      fixtureUserID,
+		StockSymbol: symbol,
+		Quantity:    decimal.NewFromInt(5),
+		Status:      models.RewardStatusQueued,
+		Timestamp:   now.Add(-time.Hour),
+	}
+	mustCreate(t, &earlier)
+	lot := treasuryLot(0, "2", "2", "200")
+	lot.StockSymbol = symbol
+	lot.PurchasedAt = now
+	mustCreate(t, &lot)
+
+	// The lot could cover the new reward, but it must not overtake the queued one
+	reward, err := service.CreateReward(fixtureUserID, symbol, decimal.NewFromInt(1), now, "")
+	if err != nil {
+		t.Fatalf("CreateReward: %v", err)
+	}
+	if reward.Status != models.RewardStatusQueued {
+		t.Errorf("reward status = %s, want QUEUED", reward.Status)
+	}
+	if err := db.DB.First(&lot, lot.ID).Error; err != nil {
+		t.Fatalf("failed to reload lot: %v", err)
+	}
+	if !lot.RemainingQuantity.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("lot remaining = %s, want 2", lot.RemainingQuantity)
+	}
+
+	// Once the earlier reward is covered both are issued, in grant order
+	more := treasuryLot(0, "4", "4", "400")
+	more.StockSymbol = symbol
+	more.PurchasedAt = now
+	mustCreate(t, &more)
+	issued, err := treasury.IssueQueuedRewards(symbol)
+	if err != nil {
+		t.Fatalf("IssueQueuedRewards: %v", err)
+	}
+	if issued != 2 {
+		t.Errorf("issued %d rewards, want 2", issued)
+	}
+}
+
+func TestLoadTreasuryConfig(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ShortfallRefuse},
+		{"refuse", ShortfallRefuse},
+		{"QUEUE", ShortfallQueue},
+		{"issue", ShortfallIssue},
+		{"borrow", ShortfallRefuse},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TREASURY_SHORTFALL_POLICY", tt.value)
+		if got := LoadTreasuryConfig().ShortfallPolicy; got != tt.want {
+			t.Errorf("policy %q = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLotAgeing(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		purchasedAt time.Time
+		days        int
+		bucket      string
+	}{
+		{now.Add(-23 * time.Hour), 0, "0-30"},
+		{now.AddDate(0, 0, -30), 30, "0-30"},
+		{now.AddDate(0, 0, -31), 31, "31-90"},
+		{now.AddDate(0, 0, -180), 180, "91-180"},
+		{now.AddDate(0, 0, -365), 365, "181-365"},
+		{now.AddDate(0, 0, -366), 366, "365+"},
+	}
+
+	for _, tt := range tests {
+		days := lotAgeDays(models.TreasuryLot{PurchasedAt: tt.purchasedAt}, now)
+		if days != tt.days {
+			t.Errorf("lotAgeDays(%s) = %d, want %d", tt.purchasedAt, days, tt.days)
+		}
+		if got := ageBucket(days); got != tt.bucket {
+			t.Errorf("ageBucket(%d) = %s, want %s", days, got, tt.bucket)
+		}
+	}
+}
+
+func TestRemainingCost(t *testing.T) {
+	tests := []struct {
+		lot  models.TreasuryLot
+		want string
+	}{
+		{treasuryLot(1, "10", "10", "1000"), "1000"},
+		{treasuryLot(1, "10", "2.5", "1000"), "250"},
+		{treasuryLot(1, "3", "1", "100"), "33.3333"},
+		{treasuryLot(1, "3", "0", "100"), "0"},
+	}
+
+	for _, tt := range tests {
+		if got := remainingCost(tt.lot); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("remainingCost(%s of %s @ %s) = %s, want %s",
+				tt.lot.RemainingQuantity, tt.lot.Quantity, tt.lot.CostINR, got, tt.want)
+		}
+	}
+}
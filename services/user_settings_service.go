@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky-backend/db"
+	"stocky-backend/models"
+	"stocky-backend/utils"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidTimezone is returned when a timezone name cannot be resolved
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// UserSettingsService handles per-user preferences
+type UserSettingsService struct{}
+
+// NewUserSettingsService creates a new user settings service
+func NewUserSettingsService() *UserSettingsService {
+	return &UserSettingsService{}
+}
+
+// GetSettings returns a user's settings, with defaults if none are stored
+func (s *UserSettingsService) GetSettings(userID int) (*models.UserSettings, error) {
+	settings := models.UserSettings{UserID: userID}
+	result := db.DB.Where("user_id = ?", userID).Limit(1).Find(&settings)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch user settings: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		settings.Timezone = utils.DefaultUserTimezone
+	}
+	return &settings, nil
+}
+
+// GetLocation returns the timezone a user's days are drawn in
+func (s *UserSettingsService) GetLocation(userID int) (*time.Location, error) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := utils.LoadTimezone(settings.Timezone)
+	if err != nil {
+		logrus.Warnf("User %d has unusable timezone %q, using %s", userID, settings.Timezone, utils.DefaultUserTimezone)
+		return utils.LoadTimezone(utils.DefaultUserTimezone)
+	}
+	return loc, nil
+}
+
+// SetTimezone stores a user's timezone
+func (s *UserSettingsService) SetTimezone(userID int, timezone string) (*models.UserSettings, error) {
+	loc, err := utils.LoadTimezone(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, timezone)
+	}
+
+	settings := models.UserSettings{
+		UserID:   userID,
+		Timezone: loc.String(),
+	}
+	err = db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"timezone", "updated_at"}),
+	}).Create(&settings).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save user settings: %w", err)
+	}
+
+	return &settings, nil
+}
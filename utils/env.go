@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DurationFromEnv reads a positive Go duration (e.g. "15m") from the
+// environment, falling back to the default when unset or invalid
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	return durationFromEnv(key, fallback, false)
+}
+
+// NonNegativeDurationFromEnv reads a Go duration from the environment where
+// zero is meaningful (e.g. "no delay"), falling back to the default when
+// unset or invalid
+func NonNegativeDurationFromEnv(key string, fallback time.Duration) time.Duration {
+	return durationFromEnv(key, fallback, true)
+}
+
+func durationFromEnv(key string, fallback time.Duration, allowZero bool) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 || (parsed == 0 && !allowZero) {
+		logrus.Warnf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// IntFromEnv reads a positive integer from the environment,
+// falling back to the default when unset or invalid
+func IntFromEnv(key string, fallback int) int {
+	return intFromEnv(key, fallback, false)
+}
+
+// NonNegativeIntFromEnv reads an integer from the environment where zero is
+// meaningful, falling back to the default when unset or invalid
+func NonNegativeIntFromEnv(key string, fallback int) int {
+	return intFromEnv(key, fallback, true)
+}
+
+func intFromEnv(key string, fallback int, allowZero bool) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 || (parsed == 0 && !allowZero) {
+		logrus.Warnf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
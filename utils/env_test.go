@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationFromEnv(t *testing.T) {
+	const fallback = time.Hour
+
+	tests := []struct {
+		value           string
+		want            time.Duration
+		wantNonNegative time.Duration
+	}{
+		{"", fallback, fallback},
+		{"15m", 15 * time.Minute, 15 * time.Minute},
+		{"0", fallback, 0},
+		{"0s", fallback, 0},
+		{"-1m", fallback, fallback},
+		{"soon", fallback, fallback},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := DurationFromEnv("TEST_DURATION", fallback); got != tt.want {
+			t.Errorf("DurationFromEnv(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+		if got := NonNegativeDurationFromEnv("TEST_DURATION", fallback); got != tt.wantNonNegative {
+			t.Errorf("NonNegativeDurationFromEnv(%q) = %s, want %s", tt.value, got, tt.wantNonNegative)
+		}
+	}
+}
+
+func TestIntFromEnv(t *testing.T) {
+	const fallback = 10
+
+	tests := []struct {
+		value           string
+		want            int
+		wantNonNegative int
+	}{
+		{"", fallback, fallback},
+		{"25", 25, 25},
+		{"0", fallback, 0},
+		{"-5", fallback, fallback},
+		{"1.5", fallback, fallback},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TEST_INT", tt.value)
+		if got := IntFromEnv("TEST_INT", fallback); got != tt.want {
+			t.Errorf("IntFromEnv(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+		if got := NonNegativeIntFromEnv("TEST_INT", fallback); got != tt.wantNonNegative {
+			t.Errorf("NonNegativeIntFromEnv(%q) = %d, want %d", tt.value, got, tt.wantNonNegative)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/subtle"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -62,3 +64,34 @@ func ErrorHandler() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminAuth guards admin endpoints with the X-Admin-Key header.
+// Admin endpoints are disabled entirely when ADMIN_API_KEY is not set.
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := os.Getenv("ADMIN_API_KEY")
+		if expected == "" {
+			c.AbortWithStatusJSON(403, gin.H{
+				"success": false,
+				"error":   "Admin API is disabled: ADMIN_API_KEY is not set",
+			})
+			return
+		}
+
+		provided := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			logrus.WithFields(logrus.Fields{
+				"path": c.Request.URL.Path,
+				"ip":   c.ClientIP(),
+			}).Warn("Rejected admin request")
+
+			c.AbortWithStatusJSON(401, gin.H{
+				"success": false,
+				"error":   "Invalid admin key",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -15,9 +16,11 @@ func init() {
 	rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
-// PriceGenerator generates mock stock prices
+// PriceGenerator generates mock stock prices (in each instrument's currency) and FX rates
 type PriceGenerator struct {
+	mu         sync.Mutex
 	basePrices map[string]decimal.Decimal
+	baseRates  map[string]decimal.Decimal
 }
 
 // NewPriceGenerator creates a new price generator with base prices
@@ -34,12 +37,26 @@ func NewPriceGenerator() *PriceGenerator {
 			"ITC":         decimal.NewFromFloat(455.60),
 			"KOTAKBANK":   decimal.NewFromFloat(1725.35),
 			"LT":          decimal.NewFromFloat(3420.70),
+			"AAPL":        decimal.NewFromFloat(189.85),
+			"MSFT":        decimal.NewFromFloat(415.30),
+			"GOOGL":       decimal.NewFromFloat(172.60),
+		},
+		baseRates: map[string]decimal.Decimal{
+			"USD": decimal.NewFromFloat(83.45),
 		},
 	}
 }
 
 // GeneratePrice generates a random price for a stock with variation
 func (pg *PriceGenerator) GeneratePrice(symbol string) decimal.Decimal {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	return pg.generatePrice(symbol)
+}
+
+// generatePrice generates a price; the caller must hold pg.mu
+func (pg *PriceGenerator) generatePrice(symbol string) decimal.Decimal {
 	basePrice, exists := pg.basePrices[symbol]
 	if !exists {
 		// Default base price if symbol not found
@@ -61,10 +78,13 @@ func (pg *PriceGenerator) GeneratePrice(symbol string) decimal.Decimal {
 
 // GeneratePricesForAllStocks generates prices for all configured stocks
 func (pg *PriceGenerator) GeneratePricesForAllStocks() map[string]decimal.Decimal {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
 	prices := make(map[string]decimal.Decimal)
 	
 	for symbol := range pg.basePrices {
-		prices[symbol] = pg.GeneratePrice(symbol)
+		prices[symbol] = pg.generatePrice(symbol)
 	}
 	
 	return prices
@@ -72,9 +92,31 @@ func (pg *PriceGenerator) GeneratePricesForAllStocks() map[string]decimal.Decima
 
 // UpdateBasePrice updates the base price for a symbol (for gradual price movement)
 func (pg *PriceGenerator) UpdateBasePrice(symbol string, newPrice decimal.Decimal) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
 	pg.basePrices[symbol] = newPrice
 }
 
+// GenerateFxRate generates an INR rate for one unit of currency with up to ±0.5% drift.
+// It returns zero for a currency with no base rate.
+func (pg *PriceGenerator) GenerateFxRate(currency string) decimal.Decimal {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	baseRate, exists := pg.baseRates[currency]
+	if !exists {
+		logrus.Warnf("No base FX rate for %s", currency)
+		return decimal.Zero
+	}
+
+	variation := decimal.NewFromFloat(((rng.Float64() * 1) - 0.5) / 100)
+	rate := baseRate.Mul(decimal.NewFromInt(1).Add(variation)).Round(6)
+
+	pg.baseRates[currency] = rate
+	return rate
+}
+
 // CalculateFees calculates brokerage, STT, and GST fees
 func CalculateFees(pricePerShare, quantity decimal.Decimal) (brokerage, stt, gst, total decimal.Decimal) {
 	totalValue := pricePerShare.Mul(quantity)
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestGenerateFxRate(t *testing.T) {
+	pg := NewPriceGenerator()
+
+	rate := pg.GenerateFxRate("USD")
+	low, high := decimal.NewFromFloat(83.45*0.995), decimal.NewFromFloat(83.45*1.005)
+	if rate.LessThan(low) || rate.GreaterThan(high) {
+		t.Errorf("USD rate %s outside %s-%s", rate, low, high)
+	}
+
+	if rate := pg.GenerateFxRate("XYZ"); !rate.IsZero() {
+		t.Errorf("unknown currency rate = %s, want 0", rate)
+	}
+}
@@ -0,0 +1,14 @@
+package utils
+
+// TruncateString shortens s to at most max characters without splitting a
+// UTF-8 sequence, matching how Postgres sizes varchar columns
+func TruncateString(s string, max int) string {
+	count := 0
+	for i := range s {
+		if count == max {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		want  string
+	}{
+		{"", 5, ""},
+		{"short", 5, "short"},
+		{"longer", 5, "longe"},
+		{"₹₹₹₹₹₹", 5, "₹₹₹₹₹"},
+		{"ab₹cd", 3, "ab₹"},
+		{"abc", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := TruncateString(tt.value, tt.max); got != tt.want {
+			t.Errorf("TruncateString(%q, %d) = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("é", 300)
+	if got := TruncateString(long, 255); len([]rune(got)) != 255 {
+		t.Errorf("truncated to %d characters, want 255", len([]rune(got)))
+	}
+}
@@ -1,9 +1,53 @@
 package utils
 
 import (
+	"fmt"
 	"time"
+
+	// Embedded zone database so user timezones resolve on hosts without tzdata
+	_ "time/tzdata"
 )
 
+// ExchangeTimezone is the timezone NSE trading sessions are defined in
+const ExchangeTimezone = "Asia/Kolkata"
+
+// DefaultUserTimezone draws "today" and daily valuation boundaries for users
+// who have not chosen a timezone
+const DefaultUserTimezone = ExchangeTimezone
+
+// ISTLocation returns the Asia/Kolkata location, falling back to a fixed
+// +05:30 offset when the timezone database is unavailable
+func ISTLocation() *time.Location {
+	loc, err := time.LoadLocation(ExchangeTimezone)
+	if err != nil {
+		return time.FixedZone("IST", 5*60*60+30*60)
+	}
+	return loc
+}
+
+// LoadTimezone resolves an IANA timezone name such as "Asia/Kolkata".
+// Names are also passed to Postgres, so only IANA names are accepted.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return loc, nil
+}
+
+// StartOfDayIn returns the start of the day containing t in loc
+func StartOfDayIn(t time.Time, loc *time.Location) time.Time {
+	return StartOfDay(t.In(loc))
+}
+
+// EndOfDayIn returns the end of the day containing t in loc
+func EndOfDayIn(t time.Time, loc *time.Location) time.Time {
+	return EndOfDay(t.In(loc))
+}
+
 // StartOfDay returns the start of the day (00:00:00) for a given time
 func StartOfDay(t time.Time) time.Time {
 	year, month, day := t.Date()
@@ -66,3 +110,12 @@ func GetYesterday() time.Time {
 func NowUTC() time.Time {
 	return time.Now().UTC()
 }
+
+// ParseClock parses a HH:MM time of day and returns minutes after midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"09:15", 9*60 + 15, false},
+		{"00:00", 0, false},
+		{"23:59", 23*60 + 59, false},
+		{"24:00", 0, true},
+		{"9:15", 9*60 + 15, false},
+		{"09:60", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClock(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	for _, name := range []string{"Asia/Kolkata", "America/New_York", "UTC"} {
+		loc, err := LoadTimezone(name)
+		if err != nil || loc.String() != name {
+			t.Errorf("LoadTimezone(%q) = %v, %v", name, loc, err)
+		}
+	}
+	for _, name := range []string{"", "Local", "IST", "Mars/Olympus"} {
+		if _, err := LoadTimezone(name); err == nil {
+			t.Errorf("LoadTimezone(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestDayBoundsIn(t *testing.T) {
+	tokyo := time.FixedZone("+09:00", 9*3600)
+	// 20:00 UTC on 2 May is already 3 May in +09:00
+	at := time.Date(2024, 5, 2, 20, 0, 0, 0, time.UTC)
+
+	if got, want := StartOfDayIn(at, tokyo), time.Date(2024, 5, 3, 0, 0, 0, 0, tokyo); !got.Equal(want) {
+		t.Errorf("StartOfDayIn = %s, want %s", got, want)
+	}
+	if got, want := EndOfDayIn(at, tokyo), time.Date(2024, 5, 3, 23, 59, 59, 999999999, tokyo); !got.Equal(want) {
+		t.Errorf("EndOfDayIn = %s, want %s", got, want)
+	}
+	if got, want := StartOfDayIn(at, time.UTC), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("StartOfDayIn(UTC) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrXIRRUndefined is returned when cash flows have no meaningful money-weighted
+// return, e.g. they span less than a day or all have the same sign
+var ErrXIRRUndefined = errors.New("xirr undefined for cash flows")
+
+// CashFlow is a dated amount; outflows are negative
+type CashFlow struct {
+	Amount decimal.Decimal
+	Date   time.Time
+}
+
+const (
+	xirrTolerance     = 1e-9
+	xirrMaxIterations = 100
+	daysPerYear       = 365.0
+)
+
+// XIRR returns the annualised money-weighted rate of return of irregular cash
+// flows as a fraction (0.12 = 12%). Newton's method is tried first; if it does
+// not converge the rate is bracketed and found by bisection.
+func XIRR(flows []CashFlow) (float64, error) {
+	if len(flows) < 2 {
+		return 0, ErrXIRRUndefined
+	}
+
+	sorted := make([]CashFlow, len(flows))
+	copy(sorted, flows)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	amounts := make([]float64, len(sorted))
+	years := make([]float64, len(sorted))
+	hasIn, hasOut := false, false
+	for i, flow := range sorted {
+		amounts[i] = flow.Amount.InexactFloat64()
+		years[i] = flow.Date.Sub(sorted[0].Date).Hours() / 24 / daysPerYear
+		hasIn = hasIn || amounts[i] > 0
+		hasOut = hasOut || amounts[i] < 0
+	}
+	if !hasIn || !hasOut || years[len(years)-1] < 1/daysPerYear {
+		return 0, ErrXIRRUndefined
+	}
+
+	npv := func(rate float64) float64 {
+		total := 0.0
+		for i, amount := range amounts {
+			total += amount / math.Pow(1+rate, years[i])
+		}
+		return total
+	}
+	derivative := func(rate float64) float64 {
+		total := 0.0
+		for i, amount := range amounts {
+			total -= years[i] * amount / math.Pow(1+rate, years[i]+1)
+		}
+		return total
+	}
+
+	rate := 0.1
+	for i := 0; i < xirrMaxIterations; i++ {
+		d := derivative(rate)
+		if d == 0 || math.IsNaN(d) {
+			break
+		}
+		next := rate - npv(rate)/d
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		if math.Abs(next-rate) < xirrTolerance {
+			return next, nil
+		}
+		rate = next
+	}
+
+	return bisectXIRR(npv)
+}
+
+// bisectXIRR brackets a sign change of npv above -100% and bisects it
+func bisectXIRR(npv func(float64) float64) (float64, error) {
+	low, high := -0.999999, 1.0
+	for npv(low)*npv(high) > 0 {
+		high *= 10
+		if high > 1e12 {
+			return 0, ErrXIRRUndefined
+		}
+	}
+
+	for i := 0; i < 1000 && high-low > xirrTolerance; i++ {
+		mid := (low + high) / 2
+		if npv(low)*npv(mid) <= 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestXIRR(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	flow := func(amount string, days int) CashFlow {
+		return CashFlow{Amount: decimal.RequireFromString(amount), Date: start.AddDate(0, 0, days)}
+	}
+
+	tests := []struct {
+		name  string
+		flows []CashFlow
+		want  float64
+	}{
+		{"one year gain", []CashFlow{flow("-1000", 0), flow("1100", 365)}, 0.10},
+		{"two year gain", []CashFlow{flow("-1000", 0), flow("1210", 730)}, 0.10},
+		{"one year loss", []CashFlow{flow("-1000", 0), flow("500", 365)}, -0.5},
+		{"unsorted input", []CashFlow{flow("1100", 365), flow("-1000", 0)}, 0.10},
+		{"large return", []CashFlow{flow("-100", 0), flow("10000", 365)}, 99},
+		{"break even", []CashFlow{flow("-500", 0), flow("-500", 100), flow("1000", 365)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := XIRR(tt.flows)
+			if err != nil {
+				t.Fatalf("XIRR: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("XIRR = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXIRRConverges(t *testing.T) {
+	// Monthly contributions with a final valuation: the rate found must
+	// discount the flows to zero
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var flows []CashFlow
+	for month := 0; month < 12; month++ {
+		flows = append(flows, CashFlow{Amount: decimal.NewFromInt(-100), Date: start.AddDate(0, month, 0)})
+	}
+	end := start.AddDate(1, 0, 0)
+	flows = append(flows, CashFlow{Amount: decimal.NewFromInt(1300), Date: end})
+
+	rate, err := XIRR(flows)
+	if err != nil {
+		t.Fatalf("XIRR: %v", err)
+	}
+	npv := 0.0
+	for _, flow := range flows {
+		years := flow.Date.Sub(start).Hours() / 24 / daysPerYear
+		npv += flow.Amount.InexactFloat64() / math.Pow(1+rate, years)
+	}
+	if math.Abs(npv) > 1e-6 {
+		t.Errorf("NPV at %v = %v, want 0", rate, npv)
+	}
+}
+
+func TestXIRRUndefined(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	flow := func(amount int64, at time.Time) CashFlow {
+		return CashFlow{Amount: decimal.NewFromInt(amount), Date: at}
+	}
+
+	tests := []struct {
+		name  string
+		flows []CashFlow
+	}{
+		{"no flows", nil},
+		{"single flow", []CashFlow{flow(-1000, start)}},
+		{"only outflows", []CashFlow{flow(-1000, start), flow(-500, start.AddDate(0, 6, 0))}},
+		{"only inflows", []CashFlow{flow(1000, start), flow(500, start.AddDate(0, 6, 0))}},
+		{"less than a day", []CashFlow{flow(-1000, start), flow(1100, start.Add(12*time.Hour))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := XIRR(tt.flows); !errors.Is(err, ErrXIRRUndefined) {
+				t.Errorf("err = %v, want ErrXIRRUndefined", err)
+			}
+		})
+	}
+}
+
+func TestBisectXIRR(t *testing.T) {
+	rate, err := bisectXIRR(func(r float64) float64 { return 0.25 - r })
+	if err != nil {
+		t.Fatalf("bisectXIRR: %v", err)
+	}
+	if math.Abs(rate-0.25) > 1e-6 {
+		t.Errorf("rate = %v, want 0.25", rate)
+	}
+
+	// No sign change anywhere above -100%
+	if _, err := bisectXIRR(func(float64) float64 { return 1 }); !errors.Is(err, ErrXIRRUndefined) {
+		t.Errorf("err = %v, want ErrXIRRUndefined", err)
+	}
+}